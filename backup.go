@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"go.dalton.dog/bubbleup"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	backupStampFormat = "20060102-150405.000"
+	backupDayFormat   = "20060102"
+)
+
+// backup is one file in the backup directory. Backups are plain task
+// documents whatever the store, so any of them can be restored into any
+// backend.
+type backup struct {
+	Path string
+	// Kind is "save" for the rotating per-save copies or "daily".
+	Kind  string
+	Stamp string
+	Time  time.Time
+}
+
+func (b *backup) FilterValue() string { return b.Stamp }
+func (b *backup) Title() string {
+	if b.Kind == "daily" {
+		return "🗓 Daily snapshot of " + b.Time.Format("02/01/06")
+	}
+	return "💾 Saved " + b.Time.Format("02/01/06 15:04:05")
+}
+func (b *backup) Description() string { return filepath.Base(b.Path) }
+
+// backups keeps the last Saves saves plus one snapshot for each of the last
+// Days days in Dir.
+type backups struct {
+	Dir   string
+	Saves int
+	Days  int
+}
+
+func newBackups(configPath string, settings Settings) *backups {
+	return &backups{Dir: configPath + ".backups", Saves: settings.BackupSaves, Days: settings.BackupDays}
+}
+
+// snapshot backs up root after a save and drops the backups that rotated out.
+func (b *backups) snapshot(root *TaskFolder, now time.Time) error {
+	if b == nil || b.Saves <= 0 && b.Days <= 0 {
+		return nil
+	}
+	if err := os.MkdirAll(b.Dir, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %w", b.Dir, err)
+	}
+	doc := newFileDoc(root, 0)
+	if b.Saves > 0 {
+		path := filepath.Join(b.Dir, "save-"+now.Format(backupStampFormat)+".json")
+		if err := MarshalToFile(path, doc); err != nil {
+			return fmt.Errorf("error writing backup: %w", err)
+		}
+	}
+	if b.Days > 0 {
+		path := filepath.Join(b.Dir, "daily-"+now.Format(backupDayFormat)+".json")
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			if err := MarshalToFile(path, doc); err != nil {
+				return fmt.Errorf("error writing backup: %w", err)
+			}
+		}
+	}
+	return b.prune()
+}
+
+func (b *backups) prune() error {
+	all, err := b.list()
+	if err != nil {
+		return err
+	}
+	kept := map[string]int{}
+	for _, bk := range all {
+		kept[bk.Kind]++
+		limit := b.Saves
+		if bk.Kind == "daily" {
+			limit = b.Days
+		}
+		if kept[bk.Kind] > limit {
+			if err := os.Remove(bk.Path); err != nil {
+				return fmt.Errorf("error rotating backups: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// list returns the backups, newest first.
+func (b *backups) list() ([]*backup, error) {
+	entries, err := os.ReadDir(b.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", b.Dir, err)
+	}
+	var out []*backup
+	for _, e := range entries {
+		kind, stamp, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".json"), "-")
+		if !ok || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		format := backupStampFormat
+		if kind == "daily" {
+			format = backupDayFormat
+		} else if kind != "save" {
+			continue
+		}
+		t, err := time.ParseInLocation(format, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		out = append(out, &backup{Path: filepath.Join(b.Dir, e.Name()), Kind: kind, Stamp: stamp, Time: t})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.After(out[j].Time) })
+	return out, nil
+}
+
+// find looks a backup up by its timestamp, or any unambiguous prefix of it.
+func (b *backups) find(stamp string) (*backup, error) {
+	all, err := b.list()
+	if err != nil {
+		return nil, err
+	}
+	var found []*backup
+	for _, bk := range all {
+		if bk.Stamp == stamp {
+			return bk, nil
+		}
+		if strings.HasPrefix(bk.Stamp, stamp) {
+			found = append(found, bk)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no backup from %s, see todoit backup list", stamp)
+	case 1:
+		return found[0], nil
+	}
+	return nil, fmt.Errorf("%d backups match %s, give more of the timestamp", len(found), stamp)
+}
+
+func loadBackup(path string) (*TaskFolder, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading backup: %w", err)
+	}
+	root, _, err := decodeDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("backup %s is unreadable: %w", filepath.Base(path), err)
+	}
+	root.Parent = nil
+	reconstructFolderFromJSON(root)
+	return root, nil
+}
+
+// restoreBackup replaces what store holds with the backup at path. The tree
+// being replaced is backed up first, so a restore can itself be rolled back.
+func restoreBackup(store Store, b *backups, path string) (*TaskFolder, error) {
+	root, err := loadBackup(path)
+	if err != nil {
+		return nil, err
+	}
+	current, err := store.Load()
+	var corrupt *CorruptError
+	if js, ok := store.(*JSONStore); ok && errors.As(err, &corrupt) {
+		return js.recover(func() (*TaskFolder, error) { return root, nil })
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := b.snapshot(current, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := store.Save(root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// runBackupCommand implements `todoit backup list` and
+// `todoit backup restore <timestamp>`.
+func runBackupCommand(args []string, store Store, b *backups) error {
+	if len(args) == 0 {
+		return errors.New("usage: todoit backup list | todoit backup restore <timestamp>")
+	}
+	switch args[0] {
+	case "list":
+		all, err := b.list()
+		if err != nil {
+			return err
+		}
+		if len(all) == 0 {
+			fmt.Println("No backups in", b.Dir)
+		}
+		for _, bk := range all {
+			fmt.Printf("%-20s %-6s %s\n", bk.Stamp, bk.Kind, bk.Time.Format("2006-01-02 15:04:05"))
+		}
+		return nil
+	case "restore":
+		if len(args) != 2 {
+			return errors.New("usage: todoit backup restore <timestamp>")
+		}
+		bk, err := b.find(args[1])
+		if err != nil {
+			return err
+		}
+		if _, err := restoreBackup(store, b, bk.Path); err != nil {
+			return err
+		}
+		// the undo history no longer matches the tasks
+		if err := os.Remove(config_path + ".history"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		fmt.Println("Restored", filepath.Base(bk.Path))
+		return nil
+	}
+	return fmt.Errorf("unknown backup command %q (list, restore)", args[0])
+}
+
+// showBackups lists the backups to restore from.
+func (m *model) showBackups() tea.Cmd {
+	all, err := m.backups.list()
+	if err != nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, err.Error())
+	}
+	if len(all) == 0 {
+		return m.alert.NewAlertCmd(bubbleup.InfoKey, "No backups yet, they are made as you save")
+	}
+	var items []list.Item
+	for _, b := range all {
+		items = append(items, b)
+	}
+	m.backupMode = true
+	m.statusString = "Backups: enter restores the selected one, esc leaves"
+	m.list.SetItems(items)
+	m.list.Title = fmt.Sprintf("Backups \n %d kept in %s", len(items), m.backups.Dir)
+	m.list.Select(0)
+	return nil
+}
+
+// restoreBackup rolls the tasks back to b. Undo doesn't reach past a restore,
+// the tasks it replaced are in the newest backup instead.
+func (m *model) restoreBackup(b *backup) tea.Cmd {
+	root, err := restoreBackup(m.store, m.backups, b.Path)
+	if err != nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, "Restore failed: "+err.Error())
+	}
+	m.backupMode = false
+	m.history = newHistory(m.settings.HistorySize, m.history.path)
+	m.adopt(root)
+	saved := m.saved("restore the backup from " + b.Time.Format("2006-01-02 15:04:05"))
+	m.statusString = "Restored the backup from " + b.Time.Format("02/01/06 15:04:05")
+	if err := m.history.save(); err != nil {
+		return tea.Batch(saved, m.alert.NewAlertCmd(bubbleup.WarnKey, err.Error()))
+	}
+	return tea.Batch(saved, m.alert.NewAlertCmd(bubbleup.InfoKey, "Restored "+filepath.Base(b.Path)))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupRotation(t *testing.T) {
+	at := func(day, hour int) time.Time { return time.Date(2026, 10, day, hour, 0, 0, 0, time.Local) }
+	saves := []time.Time{at(18, 9), at(18, 17), at(19, 9), at(20, 9), at(20, 12), at(20, 15)}
+	tests := []struct {
+		name        string
+		saves, days int
+		want        []string
+	}{
+		{name: "off", saves: 0, days: 0},
+		{name: "last saves", saves: 2, days: 0, want: []string{
+			"save-20261020-150000.000", "save-20261020-120000.000",
+		}},
+		{name: "daily snapshots", saves: 0, days: 2, want: []string{
+			"daily-20261020", "daily-20261019",
+		}},
+		{name: "both", saves: 1, days: 3, want: []string{
+			"save-20261020-150000.000", "daily-20261020", "daily-20261019", "daily-20261018",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &backups{Dir: filepath.Join(t.TempDir(), "tasks.json.backups"), Saves: tt.saves, Days: tt.days}
+			root := sampleTree()
+			for _, now := range saves {
+				root.Name = now.Format(time.RFC3339)
+				if err := b.snapshot(root, now); err != nil {
+					t.Fatalf("snapshot() error = %v", err)
+				}
+			}
+			all, err := b.list()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, bk := range all {
+				got = append(got, strings.TrimSuffix(filepath.Base(bk.Path), ".json"))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("backups = %v, want %v", got, tt.want)
+			}
+			// a daily snapshot is the first save of its day
+			for _, bk := range all {
+				saved, err := loadBackup(bk.Path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bk.Kind == "daily" && saved.Name != at(bk.Time.Day(), 9).Format(time.RFC3339) {
+					t.Errorf("%s holds the save from %s, want the first of the day", bk.Stamp, saved.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestFindBackup(t *testing.T) {
+	b := &backups{Dir: filepath.Join(t.TempDir(), "tasks.json.backups"), Saves: 5}
+	for _, now := range []time.Time{
+		time.Date(2026, 10, 19, 9, 0, 0, 0, time.Local),
+		time.Date(2026, 10, 20, 9, 0, 0, 0, time.Local),
+		time.Date(2026, 10, 20, 9, 30, 0, 0, time.Local),
+	} {
+		if err := b.snapshot(sampleTree(), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		stamp   string
+		want    string
+		wantErr string
+	}{
+		{stamp: "20261020-093000.000", want: "20261020-093000.000"},
+		{stamp: "20261019", want: "20261019-090000.000"},
+		{stamp: "20261020", wantErr: "2 backups match"},
+		{stamp: "20261021", wantErr: "no backup from"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stamp, func(t *testing.T) {
+			got, err := b.find(tt.stamp)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("find() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("find() error = %v", err)
+			}
+			if got.Stamp != tt.want {
+				t.Errorf("find() = %s, want %s", got.Stamp, tt.want)
+			}
+		})
+	}
+}
@@ -3,3 +3,4 @@ package main
 import "github.com/charmbracelet/lipgloss"
 
 var renderWarning = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF593B")).Render
+var renderNotice = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFED33")).Render
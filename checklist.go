@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"go.dalton.dog/bubbleup"
+	"slices"
+	"strings"
+	"time"
+)
+
+// CheckItem is one step of a task's checklist.
+type CheckItem struct {
+	ID     string
+	Name   string
+	Done   bool
+	DoneAt time.Time
+}
+
+func (c *CheckItem) FilterValue() string { return c.Name }
+func (c *CheckItem) Title() string {
+	if c.Done {
+		return "☑ " + c.Name
+	}
+	return "☐ " + c.Name
+}
+func (c *CheckItem) Description() string {
+	if c.Done {
+		return "done " + c.DoneAt.Local().Format("02/01/06 15:04")
+	}
+	return ""
+}
+
+// checklistDone counts the checked steps of t.
+func (t *Task) checklistDone() int {
+	done := 0
+	for _, c := range t.Checklist {
+		if c.Done {
+			done++
+		}
+	}
+	return done
+}
+
+// progress is how far along t is, a completed task counting as done whatever
+// its checklist says.
+func (t *Task) progress() float64 {
+	switch {
+	case t.Completed:
+		return 1
+	case len(t.Checklist) == 0:
+		return 0
+	}
+	return float64(t.checklistDone()) / float64(len(t.Checklist))
+}
+
+// checklistBar is the partial completion shown in a task's row, e.g.
+// "☑ 2/5 ▰▰▱▱▱".
+func (t *Task) checklistBar() string {
+	n := len(t.Checklist)
+	if n == 0 {
+		return ""
+	}
+	done := t.checklistDone()
+	width := min(n, 10)
+	filled := done * width / n
+	return fmt.Sprintf("☑ %d/%d %s%s", done, n, strings.Repeat("▰", filled), strings.Repeat("▱", width-filled))
+}
+
+// checklistTask is the task whose checklist is on screen, nil once it is
+// gone.
+func (m *model) checklistTask() *Task {
+	return findTask(m.rootFolder, m.checklistID)
+}
+
+// showChecklist drills into the steps of t.
+func (m *model) showChecklist(t *Task) tea.Cmd {
+	m.checklistMode, m.checklistID = true, t.ID
+	m.statusString = "Checklist: enter checks, n adds, e renames, d removes, K/J move, c completes the task, esc leaves"
+	m.recreateChecklist(0)
+	return nil
+}
+
+// recreateChecklist lists the steps of the open task again, leaving the
+// checklist when the task no longer exists.
+func (m *model) recreateChecklist(selected int) {
+	t := m.checklistTask()
+	if t == nil {
+		m.leaveChecklist()
+		return
+	}
+	var items []list.Item
+	for i := range t.Checklist {
+		items = append(items, &t.Checklist[i])
+	}
+	m.list.SetItems(items)
+	m.list.Title = fmt.Sprintf("%s > %s \n %d/%d steps done", t.ParentFolder.returnPath(), t.Name, t.checklistDone(), len(t.Checklist))
+	if t.Completed {
+		m.list.Title += ", task completed"
+	}
+	m.list.Select(selected)
+}
+
+// leaveChecklist goes back to the task's folder with the task selected.
+func (m *model) leaveChecklist() {
+	m.checklistMode, m.checkInputActive = false, false
+	t := m.checklistTask()
+	if t == nil {
+		m.recreateList(m.currentFolder, 0)
+		return
+	}
+	m.recreateListAt(t.ParentFolder, t.ID)
+}
+
+// editChecklist replaces the checklist of the open task with what change
+// makes of a copy of it, as one undoable edit.
+func (m *model) editChecklist(change func(steps []CheckItem) []CheckItem, selected int) tea.Cmd {
+	t := m.checklistTask()
+	if t == nil {
+		m.leaveChecklist()
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, "That task no longer exists")
+	}
+	edit := &editCommand{ID: t.ID, Before: fieldsOf(t)}
+	edit.After = edit.Before
+	edit.After.Checklist = toCheckDocs(change(slices.Clone(t.Checklist)))
+	cmd := m.execute(edit)
+	m.recreateChecklist(selected)
+	return cmd
+}
+
+// startCheckInput asks for the name of a new step, or a new name for the
+// step with the given ID.
+func (m *model) startCheckInput(id, name string) {
+	m.checkInputActive, m.checkEditID = true, id
+	m.checkInput.SetValue(name)
+	m.checkInput.Focus()
+}
+
+// updateChecklist handles a key in the checklist, reporting whether it did.
+// Anything else goes on to the list, e.g. to move the cursor.
+func (m *model) updateChecklist(msg tea.KeyMsg) (tea.Cmd, bool) {
+	index := m.list.Index()
+	if m.checkInputActive {
+		switch msg.String() {
+		case "enter":
+			name := strings.TrimSpace(m.checkInput.Value())
+			m.checkInputActive = false
+			m.checkInput.Blur()
+			if name == "" {
+				return nil, true
+			}
+			if m.checkEditID == "" {
+				t := m.checklistTask()
+				if t == nil {
+					return nil, true
+				}
+				return m.editChecklist(func(steps []CheckItem) []CheckItem {
+					return append(steps, CheckItem{ID: newID(), Name: name})
+				}, len(t.Checklist)), true
+			}
+			id := m.checkEditID
+			return m.editChecklist(func(steps []CheckItem) []CheckItem {
+				for i := range steps {
+					if steps[i].ID == id {
+						steps[i].Name = name
+					}
+				}
+				return steps
+			}, index), true
+		case "esc":
+			m.checkInputActive = false
+			m.checkInput.Blur()
+			return nil, true
+		}
+		var cmd tea.Cmd
+		m.checkInput, cmd = m.checkInput.Update(msg)
+		return cmd, true
+	}
+	step, _ := m.list.SelectedItem().(*CheckItem)
+	switch msg.String() {
+	case "enter", " ":
+		if step == nil {
+			return nil, true
+		}
+		id := step.ID
+		cmd := m.editChecklist(func(steps []CheckItem) []CheckItem {
+			for i := range steps {
+				if steps[i].ID == id {
+					steps[i].Done = !steps[i].Done
+					steps[i].DoneAt = time.Time{}
+					if steps[i].Done {
+						steps[i].DoneAt = time.Now()
+					}
+				}
+			}
+			return steps
+		}, index)
+		if t := m.checklistTask(); t != nil && !t.Completed && t.checklistDone() == len(t.Checklist) {
+			m.statusString = "Every step of " + t.Name + " is done, c completes it"
+		}
+		return cmd, true
+	case "n":
+		m.startCheckInput("", "")
+		return nil, true
+	case "e":
+		if step != nil {
+			m.startCheckInput(step.ID, step.Name)
+		}
+		return nil, true
+	case "d":
+		if step == nil {
+			return nil, true
+		}
+		id := step.ID
+		return m.editChecklist(func(steps []CheckItem) []CheckItem {
+			return slices.DeleteFunc(steps, func(c CheckItem) bool { return c.ID == id })
+		}, max(index-1, 0)), true
+	case "K", "J":
+		t := m.checklistTask()
+		if step == nil || t == nil {
+			return nil, true
+		}
+		from := slices.IndexFunc(t.Checklist, func(c CheckItem) bool { return c.ID == step.ID })
+		to := from - 1
+		if msg.String() == "J" {
+			to = from + 1
+		}
+		if from < 0 || to < 0 || to >= len(t.Checklist) {
+			return nil, true
+		}
+		return m.editChecklist(func(steps []CheckItem) []CheckItem {
+			steps[from], steps[to] = steps[to], steps[from]
+			return steps
+		}, to), true
+	case "c", "F":
+		t := m.checklistTask()
+		if t == nil {
+			return nil, true
+		}
+		cmd := m.completeTask(t, msg.String() == "F")
+		m.recreateChecklist(index)
+		return cmd, true
+	case "u":
+		cmd := m.undo()
+		m.recreateChecklist(index)
+		return cmd, true
+	case "ctrl+r":
+		cmd := m.redo()
+		m.recreateChecklist(index)
+		return cmd, true
+	case "esc", "o", "b":
+		m.leaveChecklist()
+		m.statusString = "Left the checklist"
+		return nil, true
+	case "ctrl+c", "q":
+		return tea.Quit, true
+	}
+	return nil, false
+}
@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestChecklistProgress(t *testing.T) {
+	steps := func(done ...bool) []CheckItem {
+		var out []CheckItem
+		for _, d := range done {
+			out = append(out, CheckItem{Name: "step", Done: d})
+		}
+		return out
+	}
+	tests := []struct {
+		name string
+		task *Task
+		want float64
+		bar  string
+	}{
+		{name: "no steps", task: &Task{}, want: 0, bar: ""},
+		{name: "none done", task: &Task{Checklist: steps(false, false)}, want: 0, bar: "☑ 0/2 ▱▱"},
+		{name: "half done", task: &Task{Checklist: steps(true, false, true, false)}, want: 0.5, bar: "☑ 2/4 ▰▰▱▱"},
+		{name: "all done", task: &Task{Checklist: steps(true, true, true)}, want: 1, bar: "☑ 3/3 ▰▰▰"},
+		{name: "completed with steps left", task: &Task{Completed: true, Checklist: steps(true, false)}, want: 1, bar: "☑ 1/2 ▰▱"},
+		{name: "completed without steps", task: &Task{Completed: true}, want: 1, bar: ""},
+		{
+			name: "long checklist",
+			task: &Task{Checklist: steps(true, true, true, true, true, false, false, false, false, false, false, false, false, false, false, false, false, false, false, false)},
+			want: 0.25,
+			bar:  "☑ 5/20 ▰▰▱▱▱▱▱▱▱▱",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.task.progress(); got != tt.want {
+				t.Errorf("progress() = %v, want %v", got, tt.want)
+			}
+			if got := tt.task.checklistBar(); got != tt.bar {
+				t.Errorf("checklistBar() = %q, want %q", got, tt.bar)
+			}
+			// the folder counts the task as far as it got, next to an
+			// untouched one
+			f := &TaskFolder{ChildrenTasks: []*Task{tt.task, {}}}
+			if got := updateStatus(f, true); got.Total != 2 || got.Progress != tt.want {
+				t.Errorf("folder status = %+v, want 2 tasks with progress %v", got, tt.want)
+			}
+		})
+	}
+}
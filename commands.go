@@ -0,0 +1,417 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/progress"
+	"slices"
+	"sort"
+	"time"
+)
+
+// command is a reversible mutation of the tree. Every change made from
+// model.Update goes through one so it can be undone. Commands address items
+// by ID and carry their data as file DTOs, so they stay valid across reloads
+// and can be persisted.
+type command interface {
+	apply(root *TaskFolder) (Change, error)
+	revert(root *TaskFolder) (Change, error)
+	String() string
+}
+
+func findFolder(f *TaskFolder, id string) *TaskFolder {
+	if f.ID == id {
+		return f
+	}
+	for _, child := range f.ChildrenTaskFolders {
+		if found := findFolder(child, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func findTask(f *TaskFolder, id string) *Task {
+	for _, t := range f.ChildrenTasks {
+		if t.ID == id {
+			return t
+		}
+	}
+	for _, child := range f.ChildrenTaskFolders {
+		if t := findTask(child, id); t != nil {
+			return t
+		}
+	}
+	return nil
+}
+
+func mustFindFolder(root *TaskFolder, id string) (*TaskFolder, error) {
+	if f := findFolder(root, id); f != nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("folder %s no longer exists", id)
+}
+
+// insertItem puts a task or folder into parent at index, or at the end when
+// index is out of range.
+func insertItem(parent *TaskFolder, index int, item list.Item) {
+	switch v := item.(type) {
+	case *Task:
+		v.ParentFolder = parent
+		if index < 0 || index > len(parent.ChildrenTasks) {
+			index = len(parent.ChildrenTasks)
+		}
+		parent.ChildrenTasks = append(parent.ChildrenTasks[:index], append([]*Task{v}, parent.ChildrenTasks[index:]...)...)
+	case *TaskFolder:
+		v.Parent = parent
+		if index < 0 || index > len(parent.ChildrenTaskFolders) {
+			index = len(parent.ChildrenTaskFolders)
+		}
+		parent.ChildrenTaskFolders = append(parent.ChildrenTaskFolders[:index], append([]*TaskFolder{v}, parent.ChildrenTaskFolders[index:]...)...)
+	}
+}
+
+// removeItem takes the task or folder with the given ID out of parent and
+// returns it with the index it had.
+func removeItem(parent *TaskFolder, id string) (list.Item, int, error) {
+	for i, t := range parent.ChildrenTasks {
+		if t.ID == id {
+			parent.ChildrenTasks, _ = SlicePop(parent.ChildrenTasks, i)
+			return t, i, nil
+		}
+	}
+	for i, f := range parent.ChildrenTaskFolders {
+		if f.ID == id {
+			parent.ChildrenTaskFolders, _ = SlicePop(parent.ChildrenTaskFolders, i)
+			return f, i, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("item %s is not in %q", id, parent.Name)
+}
+
+func itemFromDocs(task *taskDoc, folder *folderDoc) list.Item {
+	if task != nil {
+		return fromTaskDoc(task)
+	}
+	f := fromFolderDoc(folder)
+	reconstructFolderFromJSON(f)
+	f.Progress = progress.New()
+	return f
+}
+
+func itemName(item list.Item) string {
+	switch v := item.(type) {
+	case *Task:
+		return v.Name
+	case *TaskFolder:
+		return v.Name
+	}
+	return ""
+}
+
+type createCommand struct {
+	FolderID string     `json:"folder_id"`
+	Task     *taskDoc   `json:"task,omitempty"`
+	Folder   *folderDoc `json:"folder,omitempty"`
+}
+
+func newCreateCommand(parent *TaskFolder, item list.Item) *createCommand {
+	c := &createCommand{FolderID: parent.ID}
+	switch v := item.(type) {
+	case *Task:
+		c.Task = toTaskDoc(v)
+	case *TaskFolder:
+		c.Folder = toFolderDoc(v)
+	}
+	return c
+}
+
+func (c *createCommand) apply(root *TaskFolder) (Change, error) {
+	parent, err := mustFindFolder(root, c.FolderID)
+	if err != nil {
+		return Change{}, err
+	}
+	item := itemFromDocs(c.Task, c.Folder)
+	insertItem(parent, -1, item)
+	return Change{Kind: ChangeCreate, Folder: parent, Items: []list.Item{item}}, nil
+}
+
+func (c *createCommand) revert(root *TaskFolder) (Change, error) {
+	parent, err := mustFindFolder(root, c.FolderID)
+	if err != nil {
+		return Change{}, err
+	}
+	item, _, err := removeItem(parent, docID(c.Task, c.Folder))
+	if err != nil {
+		return Change{}, err
+	}
+	return Change{Kind: ChangeDelete, Folder: parent, Items: []list.Item{item}}, nil
+}
+
+func (c *createCommand) String() string {
+	if c.Task != nil {
+		return fmt.Sprintf("create task %q", c.Task.Name)
+	}
+	return fmt.Sprintf("create folder %q", c.Folder.Name)
+}
+
+func docID(t *taskDoc, f *folderDoc) string {
+	if t != nil {
+		return t.ID
+	}
+	return f.ID
+}
+
+// itemFields are the user editable fields of a task or folder.
+type itemFields struct {
+	Name       string      `json:"name"`
+	Desc       string      `json:"desc"`
+	DueDate    time.Time   `json:"due_date"`
+	StartDate  time.Time   `json:"start_date"`
+	Scheduled  time.Time   `json:"scheduled_date"`
+	DeferUntil time.Time   `json:"defer_until"`
+	Priority   int         `json:"priority"`
+	Recurrence string      `json:"recurrence,omitempty"`
+	DependsOn  []string    `json:"depends_on,omitempty"`
+	Checklist  []*checkDoc `json:"checklist,omitempty"`
+	Tags       []string    `json:"tags,omitempty"`
+	// TimeEntries, Estimate and Reminders are only set for tasks.
+	TimeEntries []*timeDoc     `json:"time_entries,omitempty"`
+	Estimate    time.Duration  `json:"estimate,omitempty"`
+	Reminders   []*reminderDoc `json:"reminders,omitempty"`
+}
+
+func fieldsOf(item list.Item) itemFields {
+	switch v := item.(type) {
+	case *Task:
+		return itemFields{Name: v.Name, Desc: v.Desc, DueDate: v.DueDate, StartDate: v.StartDate, Scheduled: v.ScheduledDate, DeferUntil: v.DeferUntil, Priority: v.Priority, Recurrence: v.Recurrence, DependsOn: v.DependsOn, Checklist: toCheckDocs(v.Checklist), Tags: v.Tags, TimeEntries: toTimeDocs(v.TimeEntries), Estimate: v.Estimate, Reminders: toReminderDocs(v.Reminders)}
+	case *TaskFolder:
+		return itemFields{Name: v.Name, Desc: v.Desc, Tags: v.Tags}
+	}
+	return itemFields{}
+}
+
+type editCommand struct {
+	ID     string     `json:"id"`
+	Before itemFields `json:"before"`
+	After  itemFields `json:"after"`
+}
+
+func (c *editCommand) apply(root *TaskFolder) (Change, error)  { return c.set(root, c.After) }
+func (c *editCommand) revert(root *TaskFolder) (Change, error) { return c.set(root, c.Before) }
+
+func (c *editCommand) set(root *TaskFolder, fields itemFields) (Change, error) {
+	if t := findTask(root, c.ID); t != nil {
+		t.Name, t.Desc, t.DueDate, t.Priority, t.Recurrence = fields.Name, fields.Desc, fields.DueDate, fields.Priority, fields.Recurrence
+		t.StartDate, t.ScheduledDate, t.DeferUntil = fields.StartDate, fields.Scheduled, fields.DeferUntil
+		t.TimeEntries, t.Estimate = fromTimeDocs(fields.TimeEntries), fields.Estimate
+		t.Reminders = keepReminderState(t.Reminders, fromReminderDocs(fields.Reminders))
+		t.DependsOn, t.Checklist, t.Tags = slices.Clone(fields.DependsOn), fromCheckDocs(fields.Checklist), slices.Clone(fields.Tags)
+		t.setTimeStatus()
+		return Change{Kind: ChangeEdit, Folder: t.ParentFolder, Items: []list.Item{t}}, nil
+	}
+	if f := findFolder(root, c.ID); f != nil && f.Parent != nil {
+		f.Name, f.Desc, f.Tags = fields.Name, fields.Desc, slices.Clone(fields.Tags)
+		return Change{Kind: ChangeEdit, Folder: f.Parent, Items: []list.Item{f}}, nil
+	}
+	return Change{}, fmt.Errorf("item %s no longer exists", c.ID)
+}
+
+func (c *editCommand) String() string { return fmt.Sprintf("edit %q", c.After.Name) }
+
+type toggleCommand struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// CompletedAt is the completion time the last toggle cleared, given back
+	// when it is undone or redone.
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+}
+
+func (c *toggleCommand) apply(root *TaskFolder) (Change, error)  { return c.toggle(root) }
+func (c *toggleCommand) revert(root *TaskFolder) (Change, error) { return c.toggle(root) }
+
+func (c *toggleCommand) toggle(root *TaskFolder) (Change, error) {
+	t := findTask(root, c.ID)
+	if t == nil {
+		return Change{}, fmt.Errorf("task %s no longer exists", c.ID)
+	}
+	cleared := t.CompletedAt
+	t.setCompletionStatus(!t.Completed)
+	if t.Completed && !c.CompletedAt.IsZero() {
+		t.CompletedAt = c.CompletedAt
+	}
+	c.CompletedAt = cleared
+	return Change{Kind: ChangeToggle, Folder: t.ParentFolder, Items: []list.Item{t}}, nil
+}
+
+func (c *toggleCommand) String() string { return fmt.Sprintf("toggle %q", c.Name) }
+
+type deletedItem struct {
+	Index  int        `json:"index"`
+	Task   *taskDoc   `json:"task,omitempty"`
+	Folder *folderDoc `json:"folder,omitempty"`
+}
+
+// deleteCommand moves items to the trash.
+type deleteCommand struct {
+	FolderID string        `json:"folder_id"`
+	Items    []deletedItem `json:"items"`
+}
+
+func newDeleteCommand(parent *TaskFolder, items []list.Item) *deleteCommand {
+	c := &deleteCommand{FolderID: parent.ID}
+	for _, item := range items {
+		switch v := item.(type) {
+		case *Task:
+			for i, t := range parent.ChildrenTasks {
+				if t.ID == v.ID {
+					c.Items = append(c.Items, deletedItem{Index: i, Task: toTaskDoc(v)})
+				}
+			}
+		case *TaskFolder:
+			for i, f := range parent.ChildrenTaskFolders {
+				if f.ID == v.ID {
+					c.Items = append(c.Items, deletedItem{Index: i, Folder: toFolderDoc(v)})
+				}
+			}
+		}
+	}
+	// reinserting in index order puts everything back where it was
+	sort.SliceStable(c.Items, func(i, j int) bool { return c.Items[i].Index < c.Items[j].Index })
+	return c
+}
+
+func (c *deleteCommand) apply(root *TaskFolder) (Change, error) {
+	parent, err := mustFindFolder(root, c.FolderID)
+	if err != nil {
+		return Change{}, err
+	}
+	now := time.Now()
+	var removed []list.Item
+	for _, d := range c.Items {
+		item, _, err := removeItem(parent, docID(d.Task, d.Folder))
+		if err != nil {
+			return Change{}, err
+		}
+		root.Trash = append(root.Trash, newTrashedItem(parent, item, d.Index, now))
+		removed = append(removed, item)
+	}
+	return Change{Kind: ChangeTrash, Folder: parent, Items: removed}, nil
+}
+
+func (c *deleteCommand) revert(root *TaskFolder) (Change, error) {
+	parent, err := mustFindFolder(root, c.FolderID)
+	if err != nil {
+		return Change{}, err
+	}
+	var restored []list.Item
+	for _, d := range c.Items {
+		t, err := takeFromTrash(root, docID(d.Task, d.Folder))
+		if err != nil {
+			return Change{}, err
+		}
+		insertItem(parent, d.Index, t.item())
+		restored = append(restored, t.item())
+	}
+	return Change{Kind: ChangeRestore, Folder: parent, Items: restored}, nil
+}
+
+func (c *deleteCommand) String() string {
+	if len(c.Items) == 1 {
+		d := c.Items[0]
+		if d.Task != nil {
+			return fmt.Sprintf("delete %q", d.Task.Name)
+		}
+		return fmt.Sprintf("delete %q", d.Folder.Name)
+	}
+	return fmt.Sprintf("delete %d items", len(c.Items))
+}
+
+type sortCommand struct {
+	FolderID string   `json:"folder_id"`
+	By       string   `json:"by"`
+	Before   []string `json:"before"`
+	After    []string `json:"after"`
+}
+
+func newSortCommand(folder *TaskFolder, by string, sorted []*Task) *sortCommand {
+	c := &sortCommand{FolderID: folder.ID, By: by}
+	for _, t := range folder.ChildrenTasks {
+		c.Before = append(c.Before, t.ID)
+	}
+	for _, t := range sorted {
+		c.After = append(c.After, t.ID)
+	}
+	return c
+}
+
+func (c *sortCommand) apply(root *TaskFolder) (Change, error)  { return c.order(root, c.After) }
+func (c *sortCommand) revert(root *TaskFolder) (Change, error) { return c.order(root, c.Before) }
+
+func (c *sortCommand) order(root *TaskFolder, ids []string) (Change, error) {
+	folder, err := mustFindFolder(root, c.FolderID)
+	if err != nil {
+		return Change{}, err
+	}
+	pos := map[string]int{}
+	for i, id := range ids {
+		pos[id] = i
+	}
+	ordered := make([]*Task, len(folder.ChildrenTasks))
+	copy(ordered, folder.ChildrenTasks)
+	// tasks added since keep their relative order at the end
+	sort.SliceStable(ordered, func(i, j int) bool {
+		pi, iok := pos[ordered[i].ID]
+		pj, jok := pos[ordered[j].ID]
+		if iok != jok {
+			return iok
+		}
+		return pi < pj
+	})
+	folder.ChildrenTasks = ordered
+	return Change{Kind: ChangeSort, Folder: folder}, nil
+}
+
+func (c *sortCommand) String() string { return "sort by " + c.By }
+
+type moveCommand struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	FromID    string `json:"from_id"`
+	FromIndex int    `json:"from_index"`
+	ToID      string `json:"to_id"`
+}
+
+func (c *moveCommand) apply(root *TaskFolder) (Change, error) {
+	return c.move(root, c.FromID, c.ToID, -1)
+}
+
+func (c *moveCommand) revert(root *TaskFolder) (Change, error) {
+	return c.move(root, c.ToID, c.FromID, c.FromIndex)
+}
+
+func (c *moveCommand) move(root *TaskFolder, fromID, toID string, index int) (Change, error) {
+	from, err := mustFindFolder(root, fromID)
+	if err != nil {
+		return Change{}, err
+	}
+	to, err := mustFindFolder(root, toID)
+	if err != nil {
+		return Change{}, err
+	}
+	if f := findFolder(root, c.ID); f != nil && findFolder(f, to.ID) != nil {
+		return Change{}, errors.New("cannot move a folder into itself")
+	}
+	item, i, err := removeItem(from, c.ID)
+	if err != nil {
+		return Change{}, err
+	}
+	if index < 0 {
+		c.FromIndex = i
+	}
+	insertItem(to, index, item)
+	return Change{Kind: ChangeMove, Folder: to, From: from, Items: []list.Item{item}}, nil
+}
+
+func (c *moveCommand) String() string { return fmt.Sprintf("move %q", c.Name) }
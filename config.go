@@ -6,15 +6,16 @@ import (
 	"fmt"
 	"github.com/charmbracelet/bubbles/progress"
 	"os"
+	"slices"
 )
 
 func MarshalToFile(filename string, v interface{}) error {
 	data, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("error encoding tasks: %w", err)
 	}
 
-	err = os.WriteFile(filename, data, 0644)
+	err = writeFile(filename, data)
 	if err != nil {
 		return fmt.Errorf("error writing to file: %w", err)
 	}
@@ -22,15 +23,33 @@ func MarshalToFile(filename string, v interface{}) error {
 	return nil
 }
 
+// CorruptError is returned when the task file exists but can't be decoded.
+type CorruptError struct {
+	Path string
+	Err  error
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("%s is corrupt: %v", e.Path, e.Err)
+}
+
+func (e *CorruptError) Unwrap() error { return e.Err }
+
 func (f *TaskFolder) DeepCopy() *TaskFolder {
 	if f == nil {
 		return nil
 	}
 
 	newF := &TaskFolder{
-		Name:   f.Name,
-		Desc:   f.Desc,
-		Status: f.Status,
+		ID:          f.ID,
+		Name:        f.Name,
+		Desc:        f.Desc,
+		Status:      f.Status,
+		CreatedAt:   f.CreatedAt,
+		UpdatedAt:   f.UpdatedAt,
+		CompletedAt: f.CompletedAt,
+		Tags:        slices.Clone(f.Tags),
+		Events:      slices.Clone(f.Events),
 	}
 
 	if f.ChildrenTasks != nil {
@@ -57,24 +76,52 @@ func (t *Task) deepCopy() *Task {
 	}
 
 	newTask := &Task{
-		Name:      t.Name,
-		Desc:      t.Desc,
-		Completed: t.Completed,
-		DueDate:   t.DueDate,
-		Overdue:   t.Overdue,
-		Priority:  t.Priority,
+		ID:            t.ID,
+		Name:          t.Name,
+		Desc:          t.Desc,
+		Completed:     t.Completed,
+		State:         t.State,
+		DueDate:       t.DueDate,
+		StartDate:     t.StartDate,
+		ScheduledDate: t.ScheduledDate,
+		DeferUntil:    t.DeferUntil,
+		Overdue:       t.Overdue,
+		DueSoon:       t.DueSoon,
+		Priority:      t.Priority,
+		CreatedAt:     t.CreatedAt,
+		UpdatedAt:     t.UpdatedAt,
+		CompletedAt:   t.CompletedAt,
+		Recurrence:    t.Recurrence,
+		Completions:   slices.Clone(t.Completions),
+		DependsOn:     slices.Clone(t.DependsOn),
+		BlockedBy:     slices.Clone(t.BlockedBy),
+		Checklist:     slices.Clone(t.Checklist),
+		Tags:          slices.Clone(t.Tags),
+		TimeEntries:   slices.Clone(t.TimeEntries),
+		Estimate:      t.Estimate,
+		Reminders:     slices.Clone(t.Reminders),
+		Events:        slices.Clone(t.Events),
 	}
 	return newTask
 }
 
-func loadIntoTaskFolder(path string) (*TaskFolder, error) {
-	f, err := os.ReadFile(path)
+// loadIntoTaskFolder reads a task file, upgrading it to the current schema
+// in memory. It also returns the schema version the file was written in.
+func loadIntoTaskFolder(path string) (*TaskFolder, int, error) {
+	f, err := readFile(path)
 	if errors.Is(err, os.ErrNotExist) == true {
-		os.WriteFile(path, []byte("{}"), 0644)
+		if err := MarshalToFile(path, newFileDoc(&TaskFolder{}, 0)); err != nil {
+			return nil, 0, fmt.Errorf("error creating %s: %w", path, err)
+		}
+		return &TaskFolder{}, currentSchemaVersion, nil
+	} else if err != nil {
+		return nil, 0, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	Folder, version, err := decodeDocument(f)
+	if err != nil {
+		return nil, version, &CorruptError{Path: path, Err: err}
 	}
-	var Folder TaskFolder
-	_ = json.Unmarshal(f, &Folder)
-	return &Folder, nil
+	return Folder, version, nil
 }
 func reconstructFolderFromJSON(Folder *TaskFolder) {
 	for _, item := range Folder.ChildrenTaskFolders {
@@ -86,9 +133,7 @@ func reconstructFolderFromJSON(Folder *TaskFolder) {
 	}
 	if Folder.Parent != nil {
 		Folder.Progress = progress.New()
-		if Folder.Status.Total > 0 {
-			Folder.Progress.SetPercent(float64(Folder.Status.Completed/Folder.Status.Total) * 100)
-		}
+		Folder.Progress.SetPercent(Folder.Status.percent())
 
 	}
 
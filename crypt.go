@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/crypto/scrypt"
+	"os"
+	"path/filepath"
+)
+
+// scrypt cost parameters for new files, the ones a file was sealed with are
+// stored in it.
+const (
+	scryptN   = 1 << 15
+	scryptR   = 8
+	scryptP   = 1
+	keyLength = 32
+)
+
+var (
+	errLocked          = errors.New("the task file is encrypted, a passphrase is needed")
+	errWrongPassphrase = errors.New("wrong passphrase, or the file was tampered with")
+)
+
+// activeVault encrypts everything written next to the task file once it has
+// been unlocked, nil while the file is stored in plain JSON.
+var activeVault *vault
+
+// sealedPrefix starts every sealed file, the JSON encoder keeps field order.
+var sealedPrefix = []byte(`{"encryption":`)
+
+// sealedDoc wraps an encrypted document: the plain JSON, sealed with
+// AES-256-GCM under a key derived from the passphrase with scrypt.
+type sealedDoc struct {
+	Encryption encryptionDoc `json:"encryption"`
+	Nonce      []byte        `json:"nonce"`
+	Data       []byte        `json:"data"`
+}
+
+type encryptionDoc struct {
+	KDF    string `json:"kdf"`
+	N      int    `json:"n"`
+	R      int    `json:"r"`
+	P      int    `json:"p"`
+	Salt   []byte `json:"salt"`
+	Cipher string `json:"cipher"`
+}
+
+// vault holds the passphrase and the keys derived from it. Files sealed
+// under another salt, e.g. backups from before a passphrase change, still
+// open as long as the passphrase matches.
+type vault struct {
+	passphrase string
+	params     encryptionDoc
+	keys       map[string]cipher.AEAD
+}
+
+func newVault(passphrase string) (*vault, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("error generating salt: %w", err)
+	}
+	return &vault{
+		passphrase: passphrase,
+		params:     encryptionDoc{KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: salt, Cipher: "aes-256-gcm"},
+		keys:       map[string]cipher.AEAD{},
+	}, nil
+}
+
+// unlockVault checks passphrase against the sealed data and keeps sealing
+// with the same parameters.
+func unlockVault(passphrase string, data []byte) (*vault, error) {
+	var doc sealedDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error reading encrypted file: %w", err)
+	}
+	v := &vault{passphrase: passphrase, params: doc.Encryption, keys: map[string]cipher.AEAD{}}
+	if _, err := v.open(data); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func isSealed(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), sealedPrefix)
+}
+
+func (v *vault) key(params encryptionDoc) (cipher.AEAD, error) {
+	if params.KDF != "scrypt" || params.Cipher != "aes-256-gcm" {
+		return nil, fmt.Errorf("unsupported encryption %s/%s", params.KDF, params.Cipher)
+	}
+	if aead, ok := v.keys[string(params.Salt)]; ok {
+		return aead, nil
+	}
+	key, err := scrypt.Key([]byte(v.passphrase), params.Salt, params.N, params.R, params.P, keyLength)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	v.keys[string(params.Salt)] = aead
+	return aead, nil
+}
+
+// seal encrypts plain, a nil vault leaves it as is.
+func (v *vault) seal(plain []byte) ([]byte, error) {
+	if v == nil {
+		return plain, nil
+	}
+	aead, err := v.key(v.params)
+	if err != nil {
+		return nil, err
+	}
+	doc := sealedDoc{Encryption: v.params, Nonce: make([]byte, aead.NonceSize())}
+	if _, err := rand.Read(doc.Nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	doc.Data = aead.Seal(nil, doc.Nonce, plain, nil)
+	return json.Marshal(doc)
+}
+
+// open decrypts sealed data, anything else is returned as is.
+func (v *vault) open(data []byte) ([]byte, error) {
+	if !isSealed(data) {
+		return data, nil
+	}
+	if v == nil {
+		return nil, errLocked
+	}
+	var doc sealedDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error reading encrypted file: %w", err)
+	}
+	aead, err := v.key(doc.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, doc.Nonce, doc.Data, nil)
+	if err != nil {
+		return nil, errWrongPassphrase
+	}
+	return plain, nil
+}
+
+// filePerm keeps encrypted files private to their owner.
+func (v *vault) filePerm() os.FileMode {
+	if v == nil {
+		return 0644
+	}
+	return 0600
+}
+
+// readFile reads a file written by writeFile, decrypting it if needed.
+func readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return activeVault.open(data)
+}
+
+// writeFile atomically writes data, encrypted once the vault is unlocked.
+func writeFile(path string, data []byte) error {
+	sealed, err := activeVault.seal(data)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, sealed, activeVault.filePerm())
+}
+
+// unlockTaskFile asks for the passphrase when the task file is encrypted.
+// TODOIT_PASSPHRASE is used instead when set, for scripts.
+func unlockTaskFile(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+	if !isSealed(data) {
+		return nil
+	}
+	if passphrase, ok := os.LookupEnv("TODOIT_PASSPHRASE"); ok {
+		activeVault, err = unlockVault(passphrase, data)
+		return err
+	}
+	prompt := "Passphrase for " + filepath.Base(path)
+	for tries := 0; tries < 3; tries++ {
+		passphrase, err := promptPassphrase(prompt)
+		if err != nil {
+			return err
+		}
+		if activeVault, err = unlockVault(passphrase, data); err == nil {
+			return nil
+		} else if !errors.Is(err, errWrongPassphrase) {
+			return err
+		}
+		prompt = "Wrong passphrase, try again"
+	}
+	return errWrongPassphrase
+}
+
+// newPassphrase asks for a new passphrase twice.
+func newPassphrase() (string, error) {
+	first, err := promptPassphrase("New passphrase")
+	if err != nil {
+		return "", err
+	}
+	if first == "" {
+		return "", errors.New("the passphrase can't be empty")
+	}
+	second, err := promptPassphrase("Repeat the new passphrase")
+	if err != nil {
+		return "", err
+	}
+	if first != second {
+		return "", errors.New("the passphrases don't match")
+	}
+	return first, nil
+}
+
+// rekey rewrites the task file and everything kept next to it under to, nil
+// to store them in plain JSON again. If any of it fails the files are put
+// back as they were and the old key stays in use.
+func rekey(store *JSONStore, to *vault) (err error) {
+	root, err := store.Load()
+	if err != nil {
+		return err
+	}
+	others, _ := filepath.Glob(store.Path + ".v*.bak")
+	corrupt, _ := filepath.Glob(store.Path + ".corrupt-*")
+	backups, _ := filepath.Glob(store.Path + ".backups/*.json")
+	others = append(append(append(others, corrupt...), backups...), store.Path+".history")
+	contents := map[string][]byte{}
+	for _, path := range others {
+		data, err := readFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", path, err)
+		}
+		contents[path] = data
+	}
+	if err := store.lock.Lock(); err != nil {
+		return fmt.Errorf("error locking %s: %w", store.Path, err)
+	}
+	defer store.lock.Unlock()
+	// the revision has to be read with the old key
+	revision, err := fileRevision(store.Path)
+	if err != nil {
+		return err
+	}
+	if revision != store.revision {
+		return &StaleError{Path: store.Path}
+	}
+	// keep every file as it is on disk, missing ones are removed again
+	originals := map[string][]byte{}
+	for _, path := range append([]string{store.Path, store.journalPath(), store.snapshotPath()}, others...) {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			originals[path] = nil
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", path, err)
+		}
+		originals[path] = data
+	}
+	old, seen := activeVault, store.seen
+	defer func() {
+		if err == nil {
+			return
+		}
+		activeVault, store.revision, store.seen = old, revision, seen
+		// reopened from the restored file on the next save
+		store.journal = nil
+		for path, data := range originals {
+			var rerr error
+			if data == nil {
+				rerr = os.Remove(path)
+			} else {
+				rerr = writeFileAtomic(path, data, old.filePerm())
+			}
+			if rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+				err = fmt.Errorf("%w, and restoring %s failed: %v", err, path, rerr)
+			}
+		}
+	}()
+	activeVault = to
+	if err := MarshalToFile(store.Path, newFileDoc(root, revision+1)); err != nil {
+		return err
+	}
+	store.revision = revision + 1
+	if store.seen, err = hashFile(store.Path); err != nil {
+		return err
+	}
+	if err := store.journal.compact(root); err != nil {
+		return err
+	}
+	// the last good snapshot is still sealed the old way
+	if err := store.keepSnapshot(); err != nil {
+		return err
+	}
+	for path, data := range contents {
+		if err := writeFile(path, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runCryptCommand implements `todoit encrypt`, `todoit passphrase` and
+// `todoit decrypt`. The task file has been unlocked already.
+func runCryptCommand(command string, store Store) error {
+	js, ok := store.(*JSONStore)
+	if !ok {
+		return errors.New("encryption is only supported by the json store")
+	}
+	switch command {
+	case "encrypt", "passphrase":
+		if command == "encrypt" && activeVault != nil {
+			return errors.New("the task file is encrypted already, use todoit passphrase to change the passphrase")
+		}
+		if command == "passphrase" && activeVault == nil {
+			return errors.New("the task file isn't encrypted, use todoit encrypt")
+		}
+		passphrase, err := newPassphrase()
+		if err != nil {
+			return err
+		}
+		v, err := newVault(passphrase)
+		if err != nil {
+			return err
+		}
+		if err := rekey(js, v); err != nil {
+			return err
+		}
+		fmt.Println("Encrypted", js.Path, "and the files next to it")
+	case "decrypt":
+		if activeVault == nil {
+			return errors.New("the task file isn't encrypted")
+		}
+		if err := rekey(js, nil); err != nil {
+			return err
+		}
+		fmt.Println("Decrypted", js.Path, "back to plain JSON")
+	}
+	return nil
+}
+
+// passphraseModel is the small TUI asking for a passphrase before the task
+// view starts.
+type passphraseModel struct {
+	prompt    string
+	input     textinput.Model
+	cancelled bool
+}
+
+func promptPassphrase(prompt string) (string, error) {
+	input := textinput.New()
+	input.EchoMode = textinput.EchoPassword
+	input.EchoCharacter = '•'
+	input.Width = 40
+	input.Focus()
+	result, err := tea.NewProgram(passphraseModel{prompt: prompt, input: input}).Run()
+	if err != nil {
+		return "", fmt.Errorf("error asking for the passphrase: %w", err)
+	}
+	m := result.(passphraseModel)
+	if m.cancelled {
+		return "", errors.New("cancelled")
+	}
+	return m.input.Value(), nil
+}
+
+func (m passphraseModel) Init() tea.Cmd { return textinput.Blink }
+
+func (m passphraseModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "enter":
+			return m, tea.Quit
+		case "esc", "ctrl+c":
+			m.cancelled = true
+			return m, tea.Quit
+		}
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m passphraseModel) View() string {
+	return docStyle.Render(fmt.Sprintf("🔒 %s\n\n%s\n\nenter to unlock, esc to cancel", m.prompt, m.input.View()))
+}
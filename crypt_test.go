@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTaskFiles saves the sample tree at path along with a history file and
+// a backup, all sealed under the active vault.
+func writeTaskFiles(t *testing.T, path string) *JSONStore {
+	t.Helper()
+	store := NewJSONStore(path)
+	if err := store.Save(sampleTree()); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(path+".history", []byte(`{"undo":[],"redo":[]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(path+".backups", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(filepath.Join(path+".backups", "save-20261020-090000.000.json"), []byte(`{"schema_version":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// readDir returns the raw contents of every file under dir.
+func readDir(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		files[path] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestRekey(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+	}{
+		{name: "encrypt", to: "secret"},
+		{name: "change passphrase", from: "old", to: "new"},
+		{name: "decrypt", from: "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() { activeVault = nil })
+			vaultFor := func(passphrase string) *vault {
+				if passphrase == "" {
+					return nil
+				}
+				v, err := newVault(passphrase)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return v
+			}
+			path := filepath.Join(t.TempDir(), "tasks.json")
+			activeVault = vaultFor(tt.from)
+			store := writeTaskFiles(t, path)
+			if err := rekey(store, vaultFor(tt.to)); err != nil {
+				t.Fatalf("rekey() error = %v", err)
+			}
+			for file, data := range readDir(t, filepath.Dir(path)) {
+				if filepath.Ext(file) == ".lock" {
+					continue
+				}
+				if isSealed([]byte(data)) != (tt.to != "") {
+					t.Errorf("%s sealed = %v, want %v", filepath.Base(file), isSealed([]byte(data)), tt.to != "")
+				}
+			}
+
+			// a new session unlocks it with the new passphrase only
+			activeVault = nil
+			if tt.to != "" {
+				t.Setenv("TODOIT_PASSPHRASE", tt.from)
+				if err := unlockTaskFile(path); tt.from != "" && !errors.Is(err, errWrongPassphrase) {
+					t.Errorf("unlocking with the old passphrase: error = %v, want %v", err, errWrongPassphrase)
+				}
+				t.Setenv("TODOIT_PASSPHRASE", tt.to)
+			}
+			if err := unlockTaskFile(path); err != nil {
+				t.Fatalf("unlockTaskFile() error = %v", err)
+			}
+			root, err := NewJSONStore(path).Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got, want := treeJSON(t, root), treeJSON(t, sampleTree()); got != want {
+				t.Errorf("tree after rekey:\n got %s\nwant %s", got, want)
+			}
+			if history, err := readFile(path + ".history"); err != nil || string(history) != `{"undo":[],"redo":[]}` {
+				t.Errorf("history = %q, error %v", history, err)
+			}
+		})
+	}
+}
+
+func TestRekeyRollback(t *testing.T) {
+	t.Cleanup(func() { activeVault = nil })
+	old, err := newVault("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// scrypt refuses N that isn't a power of two, so nothing seals under it
+	broken, err := newVault("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken.params.N = 3
+
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	activeVault = old
+	store := writeTaskFiles(t, path)
+	if _, err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+	before, revision := readDir(t, filepath.Dir(path)), store.revision
+	if err := rekey(store, broken); err == nil {
+		t.Fatal("rekey() succeeded with a broken key")
+	}
+	if activeVault != old {
+		t.Error("rekey() left the broken key active")
+	}
+	if store.revision != revision {
+		t.Errorf("revision = %d, want %d", store.revision, revision)
+	}
+	after := readDir(t, filepath.Dir(path))
+	for file, data := range before {
+		if after[file] != data {
+			t.Errorf("%s changed", filepath.Base(file))
+		}
+	}
+	for file := range after {
+		if _, ok := before[file]; !ok {
+			t.Errorf("%s was left behind", filepath.Base(file))
+		}
+	}
+	// the store goes on saving under the old key
+	if err := store.Save(sampleTree()); err != nil {
+		t.Fatalf("Save() after a failed rekey error = %v", err)
+	}
+	if _, err := NewJSONStore(path).Load(); err != nil {
+		t.Errorf("Load() after a failed rekey error = %v", err)
+	}
+}
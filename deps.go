@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"go.dalton.dog/bubbleup"
+	"slices"
+	"strings"
+	"time"
+)
+
+// indexTasks maps the ID of every task in the tree, outside the trash, to
+// the task.
+func indexTasks(root *TaskFolder) map[string]*Task {
+	index := map[string]*Task{}
+	var walk func(f *TaskFolder)
+	walk = func(f *TaskFolder) {
+		for _, t := range f.ChildrenTasks {
+			index[t.ID] = t
+		}
+		for _, child := range f.ChildrenTaskFolders {
+			walk(child)
+		}
+	}
+	walk(root)
+	return index
+}
+
+// markBlocked fills in which open prerequisites every task is waiting for.
+// Prerequisites that were deleted don't block anything.
+func markBlocked(root *TaskFolder) {
+	index := indexTasks(root)
+	for _, t := range index {
+		t.BlockedBy = nil
+		for _, id := range t.DependsOn {
+			if dep, ok := index[id]; ok && !dep.Completed {
+				t.BlockedBy = append(t.BlockedBy, dep.Name)
+			}
+		}
+	}
+}
+
+// dependencyCycle is the chain of task names that adding a dependency of id
+// on dep would close, e.g. [A B C A], or nil when there is none.
+func dependencyCycle(index map[string]*Task, id, dep string) []string {
+	seen := map[string]bool{}
+	var path []string
+	var walk func(at string) bool
+	walk = func(at string) bool {
+		t, ok := index[at]
+		if !ok || seen[at] {
+			return false
+		}
+		seen[at] = true
+		path = append(path, t.Name)
+		if at == id {
+			return true
+		}
+		for _, next := range t.DependsOn {
+			if walk(next) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if !walk(dep) {
+		return nil
+	}
+	return append([]string{index[id].Name}, path...)
+}
+
+// dependencyChain renders what t waits for, prerequisites of prerequisites
+// indented below them.
+func dependencyChain(root *TaskFolder, t *Task) string {
+	index := indexTasks(root)
+	s := "Dependencies of " + t.Name + "\n"
+	if len(t.DependsOn) == 0 {
+		return s + " none, press D to add one\n"
+	}
+	var walk func(t *Task, depth int, seen map[string]bool)
+	walk = func(t *Task, depth int, seen map[string]bool) {
+		for _, id := range t.DependsOn {
+			pad := strings.Repeat("  ", depth)
+			dep, ok := index[id]
+			switch {
+			case !ok:
+				s += pad + " ? " + id + " (deleted)\n"
+				continue
+			case seen[id]:
+				// only a cycle that came in through a merge gets here
+				s += pad + " ↻ " + dep.Name + "\n"
+				continue
+			case dep.Completed:
+				s += pad + " ✓ " + dep.Name + "\n"
+			case len(dep.BlockedBy) > 0:
+				s += pad + " " + renderWarning("⛔ "+dep.Name) + "\n"
+			default:
+				s += pad + " ○ " + dep.Name + "\n"
+			}
+			seen[id] = true
+			walk(dep, depth+1, seen)
+			delete(seen, id)
+		}
+	}
+	walk(t, 0, map[string]bool{t.ID: true})
+	return s
+}
+
+// linkDependency makes m.dependent depend on t, or drops that dependency
+// when it is already there.
+func (m *model) linkDependency(t *Task) tea.Cmd {
+	from := findTask(m.rootFolder, m.dependent.ID)
+	m.dependent = nil
+	if from == nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, "That task no longer exists")
+	}
+	if from.ID == t.ID {
+		m.statusString = "Cancelled linking " + from.Name
+		return nil
+	}
+	edit := &editCommand{ID: from.ID, Before: fieldsOf(from)}
+	edit.After = edit.Before
+	if i := slices.Index(from.DependsOn, t.ID); i >= 0 {
+		edit.After.DependsOn = slices.Delete(slices.Clone(from.DependsOn), i, i+1)
+		m.statusString = fmt.Sprintf("%s no longer depends on %s", from.Name, t.Name)
+	} else {
+		if cycle := dependencyCycle(indexTasks(m.rootFolder), from.ID, t.ID); cycle != nil {
+			return m.alert.NewAlertCmd(bubbleup.ErrorKey, "That would be a cycle: "+strings.Join(cycle, " → "))
+		}
+		edit.After.DependsOn = append(slices.Clone(from.DependsOn), t.ID)
+		m.statusString = fmt.Sprintf("%s now depends on %s", from.Name, t.Name)
+	}
+	cmd := m.execute(edit)
+	m.recreateList(m.currentFolder, m.list.GlobalIndex())
+	return cmd
+}
+
+// completeTask completes or reopens t, refusing to complete a blocked task
+// unless force is set.
+func (m *model) completeTask(t *Task, force bool) tea.Cmd {
+	if !t.Completed && len(t.BlockedBy) > 0 && !force {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, fmt.Sprintf("Blocked by %s, F completes it anyway", strings.Join(t.BlockedBy, ", ")))
+	}
+	recur, err := newRecurCommand(t, time.Now())
+	if err != nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, err.Error())
+	}
+	var cmd tea.Cmd
+	if recur != nil {
+		cmd = m.execute(recur)
+		if !recur.Next.IsZero() {
+			m.statusString = fmt.Sprintf("Completed %s, next due %s", t.Name, recur.Next.Format("02/01/06 15:04"))
+		}
+	} else {
+		to := doneState()
+		if t.Completed {
+			to = taskStates[0]
+		}
+		cmd = m.execute(&stateCommand{ID: t.ID, Name: t.Name, From: t.state().Name, To: to.Name})
+	}
+	m.recreateList(m.currentFolder, m.list.GlobalIndex())
+	return cmd
+}
+
+// unblockedTasks are the open tasks whose prerequisites are all complete.
+func unblockedTasks(root *TaskFolder) []list.Item {
+	var out []list.Item
+	var walk func(f *TaskFolder)
+	walk = func(f *TaskFolder) {
+		for _, t := range f.ChildrenTasks {
+			if !t.Completed && len(t.DependsOn) > 0 && len(t.BlockedBy) == 0 {
+				out = append(out, t)
+			}
+		}
+		for _, child := range f.ChildrenTaskFolders {
+			walk(child)
+		}
+	}
+	walk(root)
+	return out
+}
+
+// showUnblocked lists the tasks that can be worked on now that what they
+// depended on is done.
+func (m *model) showUnblocked() tea.Cmd {
+	items := unblockedTasks(m.rootFolder)
+	if len(items) == 0 {
+		return m.alert.NewAlertCmd(bubbleup.InfoKey, "No task is waiting on finished prerequisites")
+	}
+	m.unblockedMode = true
+	m.statusString = "Unblocked tasks: enter opens the task's folder, esc leaves"
+	m.list.SetItems(items)
+	m.list.Title = fmt.Sprintf("Unblocked now \n %d ready", len(items))
+	m.list.Select(0)
+	return nil
+}
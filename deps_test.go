@@ -0,0 +1,95 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// depsTree has a folder of tasks where c depends on a and b, and b on a.
+func depsTree() *TaskFolder {
+	root := &TaskFolder{ID: "root", Name: "Root"}
+	work := &TaskFolder{ID: "work", Name: "Work", Parent: root}
+	root.ChildrenTaskFolders = []*TaskFolder{work}
+	a := &Task{ID: "a", Name: "A", ParentFolder: root}
+	b := &Task{ID: "b", Name: "B", ParentFolder: work, DependsOn: []string{"a"}}
+	c := &Task{ID: "c", Name: "C", ParentFolder: work, DependsOn: []string{"a", "b"}}
+	root.ChildrenTasks = []*Task{a}
+	work.ChildrenTasks = []*Task{b, c}
+	return root
+}
+
+func TestMarkBlocked(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(root *TaskFolder)
+		blockedB  []string
+		blockedC  []string
+		unblocked []string
+	}{
+		{name: "nothing done", change: func(root *TaskFolder) {}, blockedB: []string{"A"}, blockedC: []string{"A", "B"}},
+		{
+			name:      "first step done",
+			change:    func(root *TaskFolder) { findTask(root, "a").Completed = true },
+			blockedC:  []string{"B"},
+			unblocked: []string{"b"},
+		},
+		{
+			name: "everything before done",
+			change: func(root *TaskFolder) {
+				findTask(root, "a").Completed = true
+				findTask(root, "b").Completed = true
+			},
+			unblocked: []string{"c"},
+		},
+		{
+			name:      "prerequisite deleted",
+			change:    func(root *TaskFolder) { root.ChildrenTasks = nil },
+			blockedC:  []string{"B"},
+			unblocked: []string{"b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := depsTree()
+			tt.change(root)
+			markBlocked(root)
+			if got := findTask(root, "b").BlockedBy; !slices.Equal(got, tt.blockedB) {
+				t.Errorf("B blocked by %v, want %v", got, tt.blockedB)
+			}
+			if got := findTask(root, "c").BlockedBy; !slices.Equal(got, tt.blockedC) {
+				t.Errorf("C blocked by %v, want %v", got, tt.blockedC)
+			}
+			var unblocked []string
+			for _, item := range unblockedTasks(root) {
+				unblocked = append(unblocked, itemID(item))
+			}
+			if !slices.Equal(unblocked, tt.unblocked) {
+				t.Errorf("unblocked = %v, want %v", unblocked, tt.unblocked)
+			}
+		})
+	}
+}
+
+func TestDependencyCycle(t *testing.T) {
+	tests := []struct {
+		name    string
+		id, dep string
+		want    []string
+	}{
+		{name: "on itself", id: "a", dep: "a", want: []string{"A", "A"}},
+		{name: "back on a dependent", id: "a", dep: "b", want: []string{"A", "B", "A"}},
+		{name: "through a chain", id: "a", dep: "c", want: []string{"A", "C", "A"}},
+		{name: "along the chain", id: "c", dep: "b"},
+		{name: "new prerequisite", id: "b", dep: "d"},
+		{name: "deleted prerequisite", id: "a", dep: "gone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := depsTree()
+			root.ChildrenTasks = append(root.ChildrenTasks, &Task{ID: "d", Name: "D", ParentFolder: root})
+			if got := dependencyCycle(indexTasks(root), tt.id, tt.dep); !slices.Equal(got, tt.want) {
+				t.Errorf("dependencyCycle(%s, %s) = %v, want %v", tt.id, tt.dep, got, tt.want)
+			}
+		})
+	}
+}
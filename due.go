@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	tea "github.com/charmbracelet/bubbletea"
+	"go.dalton.dog/bubbleup"
+	"strings"
+	"time"
+)
+
+// dueCheckMsg is sent by the ticker that re-evaluates due dates.
+type dueCheckMsg time.Time
+
+// scheduleDueCheck asks for the next due date check, nil when the checks are
+// turned off.
+func (m *model) scheduleDueCheck() tea.Cmd {
+	if m.settings.DueCheckSeconds <= 0 {
+		return nil
+	}
+	return tea.Tick(time.Duration(m.settings.DueCheckSeconds)*time.Second, func(t time.Time) tea.Msg {
+		return dueCheckMsg(t)
+	})
+}
+
+// refreshDueDates recomputes the overdue and due soon state of every open
+// task, returning the tasks that went overdue and those due within soon.
+func refreshDueDates(f *TaskFolder, now time.Time, soon time.Duration) (overdue, dueSoon []*Task) {
+	for _, t := range f.ChildrenTasks {
+		was := t.Overdue
+		t.Overdue = !t.DueDate.IsZero() && now.After(t.DueDate)
+		t.DueSoon = !t.DueDate.IsZero() && !t.Overdue && t.DueDate.Sub(now) <= soon
+		if t.Completed || t.deferred(now) {
+			continue
+		}
+		if t.Overdue && !was {
+			overdue = append(overdue, t)
+		}
+		if t.DueSoon {
+			dueSoon = append(dueSoon, t)
+		}
+	}
+	for _, child := range f.ChildrenTaskFolders {
+		o, s := refreshDueDates(child, now, soon)
+		overdue, dueSoon = append(overdue, o...), append(dueSoon, s...)
+	}
+	return overdue, dueSoon
+}
+
+// checkDueDates brings the overdue state up to date and redraws the list,
+// alerting about tasks that crossed their deadline or came due soon since
+// the last check.
+func (m *model) checkDueDates(now time.Time) tea.Cmd {
+	if m.rootFolder == nil {
+		return nil
+	}
+	overdue, dueSoon := refreshDueDates(m.rootFolder, now, time.Duration(m.settings.DueSoonMinutes)*time.Minute)
+	rollupStatus(m.rootFolder, m.settings)
+	var fresh []*Task
+	alerted := map[string]bool{}
+	for _, t := range dueSoon {
+		if !m.dueSoonAlerted[t.ID] {
+			fresh = append(fresh, t)
+		}
+		alerted[t.ID] = true
+	}
+	// a task is announced again once it leaves the window, e.g. when its
+	// due date is pushed back
+	m.dueSoonAlerted = alerted
+	if m.listShowsFolder() {
+		m.recreateList(m.currentFolder, m.list.Index())
+	}
+	var messages []string
+	if len(overdue) > 0 {
+		messages = append(messages, dueAlert(overdue, "is overdue", "are overdue"))
+	}
+	if len(fresh) > 0 {
+		messages = append(messages, dueAlert(fresh, "is due soon", "are due soon"))
+	}
+	var planned []string
+	if !m.lastDueCheck.IsZero() {
+		planned = planAlerts(m.rootFolder, m.lastDueCheck, now)
+	}
+	m.lastDueCheck = now
+	messages = append(messages, planned...)
+	// a reminder was asked for, so it outranks the other alerts, the rows
+	// still show what is overdue
+	if cmd := m.fireReminders(now); cmd != nil {
+		return cmd
+	}
+	switch {
+	case len(overdue) > 0:
+		return m.alert.NewAlertCmd(bubbleup.WarnKey, strings.Join(messages, ", "))
+	case len(messages) > 0:
+		return m.alert.NewAlertCmd(bubbleup.InfoKey, strings.Join(messages, ", "))
+	}
+	return nil
+}
+
+func dueAlert(tasks []*Task, one, many string) string {
+	if len(tasks) == 1 {
+		return fmt.Sprintf("%s %s (%s)", tasks[0].Name, one, tasks[0].DueDate.Format("02/01/06 15:04"))
+	}
+	var names []string
+	for _, t := range tasks {
+		names = append(names, t.Name)
+	}
+	return fmt.Sprintf("%d tasks %s: %s", len(tasks), many, strings.Join(names, ", "))
+}
+
+// listShowsFolder is whether the list holds the current folder, rather than
+// the trash or another screen, and no form is open over it.
+func (m *model) listShowsFolder() bool {
+	return m.currentFolder != nil && !m.createNewUI.creatingTask && !m.trashMode && !m.backupMode && !m.workspaceMode && !m.historyMode && !m.eventMode && !m.unblockedMode && !m.checklistMode && !m.tagMode && !m.stateMode && !m.timeMode && !m.reportMode && m.merge == nil
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"go.dalton.dog/bubbleup"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is one entry in an item's change log: a field going from Old to New,
+// or the item being created, deleted, restored or moved.
+type Event struct {
+	At    time.Time
+	Actor string
+	Field string
+	Old   string
+	New   string
+}
+
+func (e *Event) FilterValue() string { return e.Field }
+func (e *Event) Title() string {
+	icon, ok := eventIcons[e.Field]
+	if !ok {
+		icon = "✏"
+	}
+	return icon + " " + e.summary()
+}
+func (e *Event) Description() string {
+	return e.At.Local().Format("02/01/06 15:04:05") + " by " + orNone(e.Actor)
+}
+
+var eventIcons = map[string]string{"created": "✨", "deleted": "🗑", "restored": "♻", "folder": "📁", "completions": "🔁"}
+
+func (e *Event) summary() string {
+	switch e.Field {
+	case "created":
+		return "created in " + e.New
+	case "deleted":
+		return "deleted from " + e.Old
+	case "restored":
+		return "restored to " + e.New
+	case "folder":
+		return "moved from " + e.Old + " to " + e.New
+	}
+	return fmt.Sprintf("%s: %s → %s", strings.ReplaceAll(e.Field, "_", " "), orNone(e.Old), orNone(e.New))
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// loggedFields are the fields whose changes are logged, in display order.
+var loggedFields = []string{"name", "desc", "due_date", "start_date", "scheduled_date", "defer_until", "priority", "completed", "state", "recurrence", "completions", "checklist", "tags", "estimate", "time_spent", "reminders"}
+
+// eventFields renders the logged fields of item the way they are written to
+// its log.
+func eventFields(item list.Item) map[string]string {
+	switch v := item.(type) {
+	case *Task:
+		fields := map[string]string{"name": v.Name, "desc": v.Desc, "completed": "no", "state": v.state().Name, "recurrence": v.Recurrence, "tags": strings.Join(v.Tags, " ")}
+		if !v.DueDate.IsZero() {
+			fields["due_date"] = v.DueDate.Format("02/01/06 15:04")
+		}
+		fields["start_date"], fields["scheduled_date"], fields["defer_until"] = formDate(v.StartDate), formDate(v.ScheduledDate), formDate(v.DeferUntil)
+		if v.Priority > 0 && v.Priority < len(priorityNames) {
+			fields["priority"] = priorityNames[v.Priority]
+		}
+		if v.Completed {
+			fields["completed"] = "yes"
+		}
+		if n := len(v.Completions); n > 0 {
+			fields["completions"] = strconv.Itoa(n)
+		}
+		if v.Estimate > 0 {
+			fields["estimate"] = formatDuration(v.Estimate)
+		}
+		if spent := v.trackedDone(); spent > 0 {
+			fields["time_spent"] = formatDuration(spent)
+		}
+		if len(v.Reminders) > 0 {
+			fields["reminders"] = formReminders(v.Reminders)
+		}
+		if n := len(v.Checklist); n > 0 {
+			fields["checklist"] = fmt.Sprintf("%d/%d", v.checklistDone(), n)
+		}
+		return fields
+	case *TaskFolder:
+		return map[string]string{"name": strings.TrimPrefix(v.Name, "📁 "), "desc": v.Desc, "tags": strings.Join(v.Tags, " ")}
+	}
+	return nil
+}
+
+// loggedItem is an item as it was last saved.
+type loggedItem struct {
+	fields map[string]string
+	where  string
+}
+
+func indexLoggedItems(root *folderDoc) map[string]loggedItem {
+	index := map[string]loggedItem{}
+	var walk func(f *folderDoc, where string)
+	walk = func(f *folderDoc, where string) {
+		for _, t := range f.Tasks {
+			index[t.ID] = loggedItem{fields: eventFields(fromTaskDoc(t)), where: where}
+		}
+		for _, child := range f.Folders {
+			index[child.ID] = loggedItem{fields: eventFields(&TaskFolder{Name: child.Name, Desc: child.Desc, Tags: child.Tags}), where: where}
+			walk(child, where+" > "+strings.TrimPrefix(child.Name, "📁 "))
+		}
+	}
+	if root != nil {
+		walk(root, "Root")
+	}
+	return index
+}
+
+func itemEvents(item list.Item) *[]Event {
+	switch v := item.(type) {
+	case *Task:
+		return &v.Events
+	case *TaskFolder:
+		return &v.Events
+	}
+	return nil
+}
+
+func itemFolder(item list.Item) *TaskFolder {
+	switch v := item.(type) {
+	case *Task:
+		return v.ParentFolder
+	case *TaskFolder:
+		return v.Parent
+	}
+	return nil
+}
+
+// logEvents appends to the log of every item change touched what changed
+// since before, the tree as last saved. Items deleted for good have no log
+// left to write to.
+func logEvents(before *folderDoc, change Change, settings Settings, now time.Time) {
+	if settings.EventLogSize <= 0 || change.Kind == ChangeDelete || change.Kind == ChangePurge {
+		return
+	}
+	index := indexLoggedItems(before)
+	actor := settings.actor()
+	for _, item := range change.Items {
+		var events []Event
+		add := func(field, old, new string) {
+			events = append(events, Event{At: now, Actor: actor, Field: field, Old: old, New: new})
+		}
+		old, ok := index[itemID(item)]
+		switch {
+		case change.Kind == ChangeTrash:
+			add("deleted", old.where, "")
+		case change.Kind == ChangeRestore:
+			add("restored", "", namePath(change.Folder))
+		case !ok:
+			add("created", "", namePath(change.Folder))
+		default:
+			fields := eventFields(item)
+			for _, f := range loggedFields {
+				if old.fields[f] != fields[f] {
+					add(f, old.fields[f], fields[f])
+				}
+			}
+			if where := namePath(itemFolder(item)); where != old.where {
+				add("folder", old.where, where)
+			}
+		}
+		if log := itemEvents(item); log != nil && len(events) > 0 {
+			*log = trimEvents(append(*log, events...), settings, now)
+		}
+	}
+}
+
+// trimEvents keeps the newest EventLogSize events younger than EventLogDays.
+func trimEvents(events []Event, settings Settings, now time.Time) []Event {
+	if settings.EventLogDays > 0 {
+		cutoff := now.AddDate(0, 0, -settings.EventLogDays)
+		i := 0
+		for i < len(events) && events[i].At.Before(cutoff) {
+			i++
+		}
+		events = events[i:]
+	}
+	if len(events) > settings.EventLogSize {
+		events = events[len(events)-settings.EventLogSize:]
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	return events
+}
+
+// pruneEventLogs applies the retention settings to every log in the tree,
+// including the trash, returning whether anything was dropped.
+func pruneEventLogs(root *TaskFolder, settings Settings, now time.Time) bool {
+	pruned := false
+	prune := func(item list.Item) {
+		log := itemEvents(item)
+		if n := len(*log); n > 0 {
+			*log = trimEvents(*log, settings, now)
+			pruned = pruned || len(*log) < n
+		}
+	}
+	var walk func(f *TaskFolder)
+	walk = func(f *TaskFolder) {
+		prune(f)
+		for _, t := range f.ChildrenTasks {
+			prune(t)
+		}
+		for _, child := range f.ChildrenTaskFolders {
+			walk(child)
+		}
+	}
+	walk(root)
+	for _, t := range root.Trash {
+		if f, ok := t.item().(*TaskFolder); ok {
+			walk(f)
+		} else {
+			prune(t.item())
+		}
+	}
+	return pruned
+}
+
+// eventFilter narrows down todoit log.
+type eventFilter struct {
+	Item  string
+	Field string
+	Actor string
+	Since time.Time
+}
+
+// loggedEvent is an event together with the item it belongs to.
+type loggedEvent struct {
+	Event
+	Path string
+}
+
+func (f eventFilter) matchesItem(id, name string) bool {
+	query := strings.ToLower(f.Item)
+	return query == "" || id == f.Item || strings.Contains(strings.ToLower(name), query)
+}
+
+// queryEvents collects the events of every item, trashed ones included,
+// oldest first.
+func queryEvents(root *TaskFolder, filter eventFilter) []loggedEvent {
+	var out []loggedEvent
+	collect := func(item list.Item, path string) {
+		name := strings.TrimPrefix(itemName(item), "📁 ")
+		if !filter.matchesItem(itemID(item), name) {
+			return
+		}
+		for _, e := range *itemEvents(item) {
+			if filter.Field != "" && e.Field != filter.Field || filter.Actor != "" && e.Actor != filter.Actor || e.At.Before(filter.Since) {
+				continue
+			}
+			out = append(out, loggedEvent{Event: e, Path: path + " > " + name})
+		}
+	}
+	var walk func(f *TaskFolder, path string)
+	walk = func(f *TaskFolder, path string) {
+		for _, t := range f.ChildrenTasks {
+			collect(t, path)
+		}
+		for _, child := range f.ChildrenTaskFolders {
+			collect(child, path)
+			walk(child, path+" > "+strings.TrimPrefix(child.Name, "📁 "))
+		}
+	}
+	walk(root, "Root")
+	for _, t := range root.Trash {
+		collect(t.item(), "Trash")
+		if f, ok := t.item().(*TaskFolder); ok {
+			walk(f, "Trash > "+strings.TrimPrefix(f.Name, "📁 "))
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].At.Before(out[j].At) })
+	return out
+}
+
+// runLogCommand implements `todoit log [-field f] [-actor a] [-since date]
+// [item]`, item being an ID or part of a name.
+func runLogCommand(args []string, store Store) error {
+	fs := flag.NewFlagSet("log", flag.ContinueOnError)
+	var filter eventFilter
+	var since string
+	fs.StringVar(&filter.Field, "field", "", "only changes to this field ("+strings.Join(loggedFields, ", ")+", folder, created, deleted, restored)")
+	fs.StringVar(&filter.Actor, "actor", "", "only changes made by this actor")
+	fs.StringVar(&since, "since", "", "only changes from this day on, YYYY-MM-DD")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errors.New("usage: todoit log [-field f] [-actor a] [-since YYYY-MM-DD] [item]")
+	}
+	filter.Item = fs.Arg(0)
+	if since != "" {
+		t, err := time.ParseInLocation("2006-01-02", since, time.Local)
+		if err != nil {
+			return fmt.Errorf("bad -since %q, expected YYYY-MM-DD", since)
+		}
+		filter.Since = t
+	}
+	root, err := store.Load()
+	if err != nil {
+		return err
+	}
+	events := queryEvents(root, filter)
+	if len(events) == 0 {
+		fmt.Println("No changes logged")
+	}
+	for _, e := range events {
+		fmt.Printf("%s  %-10s  %s: %s\n", e.At.Local().Format("2006-01-02 15:04:05"), orNone(e.Actor), e.Path, e.summary())
+	}
+	return nil
+}
+
+// showEvents lists the change log of the selected item, newest first.
+func (m *model) showEvents() tea.Cmd {
+	item := m.list.SelectedItem()
+	log := itemEvents(item)
+	if log == nil {
+		return nil
+	}
+	if len(*log) == 0 {
+		return m.alert.NewAlertCmd(bubbleup.InfoKey, "No changes logged for "+itemName(item)+" yet")
+	}
+	var items []list.Item
+	for i := len(*log) - 1; i >= 0; i-- {
+		items = append(items, &(*log)[i])
+	}
+	m.eventMode = true
+	m.statusString = "Change log: esc leaves"
+	m.list.SetItems(items)
+	m.list.Title = fmt.Sprintf("Changes to %s \n %d logged", strings.TrimPrefix(itemName(item), "📁 "), len(items))
+	m.list.Select(0)
+	return nil
+}
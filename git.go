@@ -0,0 +1,555 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"go.dalton.dog/bubbleup"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// gitLogLimit bounds how far back the history screen looks.
+const gitLogLimit = 200
+
+// gitRepo commits the task file to the git repository around it.
+type gitRepo struct {
+	dir string
+	// file is the task file relative to dir.
+	file string
+	env  []string
+	// last is closed once the latest background commit is done, they run
+	// one at a time in the order the saves happened.
+	last chan struct{}
+}
+
+// gitCommitMsg reports a background commit that failed.
+type gitCommitMsg struct {
+	err error
+}
+
+// openGitRepo finds the repository holding path, creating one in its
+// directory when there is none.
+func openGitRepo(path string) (*gitRepo, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, errors.New("git mode needs git on the PATH")
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(abs)
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	g := &gitRepo{dir: dir}
+	top, err := g.run("rev-parse", "--show-toplevel")
+	if err != nil {
+		if _, err := g.run("init", "-q"); err != nil {
+			return nil, err
+		}
+		top = dir
+	}
+	g.dir = strings.TrimSpace(top)
+	rel, err := filepath.Rel(g.dir, filepath.Join(dir, filepath.Base(abs)))
+	if err != nil {
+		return nil, err
+	}
+	g.file = filepath.ToSlash(rel)
+	if err := g.exclude(); err != nil {
+		return nil, err
+	}
+	// commits still need an author when git has none configured
+	if email, _ := g.run("config", "user.email"); strings.TrimSpace(email) == "" {
+		g.env = []string{"GIT_AUTHOR_NAME=ToDoIt", "GIT_AUTHOR_EMAIL=todoit@localhost", "GIT_COMMITTER_NAME=ToDoIt", "GIT_COMMITTER_EMAIL=todoit@localhost"}
+	}
+	return g, nil
+}
+
+// exclude keeps the journal, lock, snapshots and backups next to the task
+// file out of git status, without touching the repository's .gitignore.
+func (g *gitRepo) exclude() error {
+	out, err := g.run("rev-parse", "--git-path", "info/exclude")
+	if err != nil {
+		return err
+	}
+	path := strings.TrimSpace(out)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(g.dir, path)
+	}
+	pattern := "/" + g.file + ".*"
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == pattern {
+			return nil
+		}
+	}
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, pattern+"\n"...), 0644)
+}
+
+func (g *gitRepo) run(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.dir
+	cmd.Env = append(os.Environ(), g.env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(stderr.String()+" "+err.Error()))
+	}
+	return stdout.String(), nil
+}
+
+// commit records the task file as it is on disk, if it changed.
+func (g *gitRepo) commit(message string) error {
+	if _, err := g.run("add", "--", g.file); err != nil {
+		return err
+	}
+	if _, err := g.run("diff", "--cached", "--quiet", "--", g.file); err == nil {
+		return nil
+	}
+	_, err := g.run("commit", "-q", "-m", message, "--", g.file)
+	return err
+}
+
+// commitCmd commits in the background after the commits queued before it,
+// so a save doesn't wait for git. A failure comes back as a gitCommitMsg.
+func (g *gitRepo) commitCmd(message string) tea.Cmd {
+	prev, done := g.last, make(chan struct{})
+	g.last = done
+	result := make(chan error, 1)
+	go func() {
+		defer close(done)
+		if prev != nil {
+			<-prev
+		}
+		result <- g.commit(message)
+	}()
+	return func() tea.Msg {
+		if err := <-result; err != nil {
+			return gitCommitMsg{err: err}
+		}
+		return nil
+	}
+}
+
+// wait blocks until the background commits are done.
+func (g *gitRepo) wait() {
+	if g.last != nil {
+		<-g.last
+	}
+}
+
+// readDoc decodes the task file as of rev.
+func (g *gitRepo) readDoc(rev string) (*folderDoc, error) {
+	out, err := g.run("show", rev+":"+g.file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := activeVault.open([]byte(out))
+	if err != nil {
+		return nil, err
+	}
+	root, _, err := decodeDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s at %.7s: %w", g.file, rev, err)
+	}
+	return toFolderDoc(root), nil
+}
+
+// describeChange is the commit message for a change, e.g.
+// "complete task Ship it in Root > Work > Sprint 12".
+func describeChange(c Change) string {
+	var names []string
+	kind := "item"
+	for _, item := range c.Items {
+		kind = "task"
+		if _, ok := item.(*TaskFolder); ok {
+			kind = "folder"
+		}
+		names = append(names, strings.TrimPrefix(itemName(item), "📁 "))
+	}
+	if len(names) > 1 {
+		kind += "s"
+	}
+	what := kind + " " + strings.Join(names, ", ")
+	where := namePath(c.Folder)
+	switch c.Kind {
+	case ChangeToggle:
+		verb := "reopen"
+		if t, ok := c.Items[len(c.Items)-1].(*Task); ok {
+			switch state := t.state(); {
+			case state.Done:
+				verb = "complete"
+			case state.Cancelled:
+				verb = "cancel"
+			case state.Name != taskStates[0].Name:
+				return fmt.Sprintf("mark %s %s in %s", what, state.Name, where)
+			}
+		}
+		return fmt.Sprintf("%s %s in %s", verb, what, where)
+	case ChangeRecur:
+		if t, ok := c.Items[len(c.Items)-1].(*Task); ok && !t.Completed {
+			return fmt.Sprintf("complete %s in %s, next due %s", what, where, t.DueDate.Format("2006-01-02 15:04"))
+		}
+		return fmt.Sprintf("complete %s in %s", what, where)
+	case ChangeSort:
+		return "sort " + where
+	case ChangeMove:
+		return fmt.Sprintf("move %s from %s to %s", what, namePath(c.From), where)
+	case ChangeTrash, ChangeDelete:
+		return fmt.Sprintf("delete %s from %s", what, where)
+	case ChangeRestore:
+		return fmt.Sprintf("restore %s to %s", what, where)
+	case ChangePurge:
+		return fmt.Sprintf("purge %s from the trash", what)
+	}
+	return fmt.Sprintf("%s %s in %s", c.Kind, what, where)
+}
+
+// itemRevision is an item as one commit left it. Node is nil when the item
+// didn't exist yet, or any more.
+type itemRevision struct {
+	Hash    string
+	Subject string
+	Time    time.Time
+	Node    *mergeNode
+	Where   string
+}
+
+func (r *itemRevision) FilterValue() string { return r.Subject }
+func (r *itemRevision) Title() string       { return r.Subject }
+func (r *itemRevision) Description() string {
+	where := r.Where
+	if r.Node == nil {
+		where = "deleted"
+	}
+	return fmt.Sprintf("%.7s %s, %s", r.Hash, r.Time.Format("02/01/06 15:04"), where)
+}
+
+// itemLog lists the commits that changed the item with id, newest first.
+func (g *gitRepo) itemLog(id string) ([]*itemRevision, error) {
+	out, err := g.run("log", fmt.Sprintf("-n%d", gitLogLimit), "--format=%H%x1f%aI%x1f%s", "--", g.file)
+	if err != nil {
+		// a repository without commits yet has no history
+		if _, herr := g.run("rev-parse", "--verify", "-q", "HEAD"); herr != nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	var revs []*itemRevision
+	var newer *itemRevision
+	// walk oldest to newest, keeping the commits where the item differs
+	for i := len(lines) - 1; i >= 0; i-- {
+		parts := strings.SplitN(lines[i], "\x1f", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		rev := &itemRevision{Hash: parts[0], Subject: parts[2]}
+		rev.Time, _ = time.Parse(time.RFC3339, parts[1])
+		if doc, err := g.readDoc(rev.Hash); err == nil {
+			nodes := flattenDoc(doc)
+			if rev.Node = nodes[id]; rev.Node != nil {
+				rev.Where = nodePath(nodes, rev.Node.Parent)
+			}
+		}
+		if newer == nil && rev.Node == nil || newer != nil && sameRevision(newer.Node, rev.Node) {
+			continue
+		}
+		revs = append([]*itemRevision{rev}, revs...)
+		newer = rev
+	}
+	return revs, nil
+}
+
+// sameRevision ignores the item's index, which moves whenever a sibling comes
+// or goes.
+func sameRevision(a, b *mergeNode) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Parent == b.Parent && reflect.DeepEqual(a.Fields, b.Fields) && reflect.DeepEqual(a.Trash, b.Trash)
+}
+
+func nodePath(nodes map[string]*mergeNode, id string) string {
+	var parts []string
+	for n := nodes[id]; n != nil && n.Parent != ""; n = nodes[n.Parent] {
+		if n.Parent == trashParent {
+			return "Trash"
+		}
+		name, _ := n.Fields["name"].(string)
+		parts = append([]string{strings.TrimPrefix(name, "📁 ")}, parts...)
+	}
+	return strings.Join(append([]string{"Root"}, parts...), " > ")
+}
+
+// diffRevisions lists what changed in the item from a to b.
+func diffRevisions(a, b *itemRevision) string {
+	if a.Node == nil || b.Node == nil {
+		if a.Node == nil {
+			return fmt.Sprintf("created in %s", b.Where)
+		}
+		return fmt.Sprintf("deleted from %s", a.Where)
+	}
+	keys := map[string]bool{}
+	for k := range a.Node.Fields {
+		keys[k] = true
+	}
+	for k := range b.Node.Fields {
+		keys[k] = true
+	}
+	var fields []string
+	for k := range keys {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	var lines []string
+	for _, k := range fields {
+		if k != "updated_at" && k != "events" && !reflect.DeepEqual(a.Node.Fields[k], b.Node.Fields[k]) {
+			lines = append(lines, fmt.Sprintf("%s: %s → %s", k, fieldValue(a.Node.Fields[k]), fieldValue(b.Node.Fields[k])))
+		}
+	}
+	if a.Where != b.Where {
+		lines = append(lines, fmt.Sprintf("location: %s → %s", a.Where, b.Where))
+	}
+	if len(lines) == 0 {
+		return "no changes"
+	}
+	return strings.Join(lines, "\n")
+}
+
+func fieldValue(v any) string {
+	if v == nil {
+		return "none"
+	}
+	return fmt.Sprint(v)
+}
+
+// showItemHistory lists the commits that changed the selected item.
+func (m *model) showItemHistory() tea.Cmd {
+	if m.git == nil {
+		return m.alert.NewAlertCmd(bubbleup.InfoKey, "Turn on git in the settings to keep a history")
+	}
+	item := m.list.SelectedItem()
+	if item == nil {
+		return nil
+	}
+	// the latest saves may still be on their way into the log
+	m.git.wait()
+	revs, err := m.git.itemLog(itemID(item))
+	if err != nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, err.Error())
+	}
+	if len(revs) == 0 {
+		return m.alert.NewAlertCmd(bubbleup.InfoKey, "No history for "+itemName(item)+" yet")
+	}
+	var items []list.Item
+	for _, r := range revs {
+		items = append(items, r)
+	}
+	m.historyMode, m.historyItem, m.historyMark = true, item, nil
+	m.statusString = "History: space marks a version, d diffs against the mark or the version before, enter restores, esc leaves"
+	m.list.SetItems(items)
+	m.list.Title = fmt.Sprintf("History of %s \n %d versions", itemName(item), len(items))
+	m.list.Select(0)
+	return nil
+}
+
+// diffSelected shows how the selected version differs from the marked one,
+// or from the version before it.
+func (m *model) diffSelected() {
+	rev, ok := m.list.SelectedItem().(*itemRevision)
+	if !ok {
+		return
+	}
+	from := m.historyMark
+	if from == nil {
+		items := m.list.Items()
+		if i := m.list.Index(); i+1 < len(items) {
+			from = items[i+1].(*itemRevision)
+		} else {
+			from = &itemRevision{}
+		}
+	}
+	older, newer := from, rev
+	if older.Time.After(newer.Time) {
+		older, newer = newer, older
+	}
+	m.statusString = fmt.Sprintf("%.7s → %.7s\n%s", older.Hash, newer.Hash, diffRevisions(older, newer))
+}
+
+// restoreRevision puts the item back the way the selected version had it,
+// through undoable commands.
+func (m *model) restoreRevision() tea.Cmd {
+	rev, ok := m.list.SelectedItem().(*itemRevision)
+	if !ok {
+		return nil
+	}
+	if rev.Node == nil {
+		return m.alert.NewAlertCmd(bubbleup.InfoKey, "The item didn't exist in this version")
+	}
+	id := itemID(m.historyItem)
+	var current list.Item
+	if t := findTask(m.rootFolder, id); t != nil {
+		current = t
+	} else if f := findFolder(m.rootFolder, id); f != nil {
+		current = f
+	} else {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, "The item no longer exists, restore it from the trash first")
+	}
+	var old list.Item
+	if rev.Node.Folder {
+		var d folderDoc
+		fromFields(rev.Node.Fields, &d)
+		old = fromFolderDoc(&d)
+	} else {
+		var d taskDoc
+		fromFields(rev.Node.Fields, &d)
+		old = fromTaskDoc(&d)
+	}
+	var cmds []tea.Cmd
+	if before, after := fieldsOf(current), fieldsOf(old); before.Name != after.Name || before.Desc != after.Desc ||
+		!before.DueDate.Equal(after.DueDate) || !before.StartDate.Equal(after.StartDate) || !before.Scheduled.Equal(after.Scheduled) || !before.DeferUntil.Equal(after.DeferUntil) || before.Priority != after.Priority || before.Recurrence != after.Recurrence ||
+		!slices.Equal(before.DependsOn, after.DependsOn) || !reflect.DeepEqual(before.Checklist, after.Checklist) || !reflect.DeepEqual(before.TimeEntries, after.TimeEntries) || before.Estimate != after.Estimate || !reflect.DeepEqual(before.Reminders, after.Reminders) || !slices.Equal(before.Tags, after.Tags) {
+		cmds = append(cmds, m.execute(&editCommand{ID: id, Before: before, After: after}))
+	}
+	if t, ok := current.(*Task); ok && t.state().Name != old.(*Task).state().Name {
+		cmds = append(cmds, m.execute(&stateCommand{ID: id, Name: t.Name, From: t.state().Name, To: old.(*Task).state().Name}))
+	}
+	m.historyMode = false
+	m.recreateList(m.currentFolder, 0)
+	if len(cmds) == 0 {
+		return m.alert.NewAlertCmd(bubbleup.InfoKey, "The item already looks like this version")
+	}
+	m.statusString = fmt.Sprintf("Restored %s as of %.7s", itemName(current), rev.Hash)
+	return tea.Batch(cmds...)
+}
+
+// runSync commits what is pending, merges the remote branch into the task
+// file with the same three-way merge two sessions use, and pushes.
+func runSync(store Store, settings Settings) error {
+	js, ok := store.(*JSONStore)
+	if !ok {
+		return errors.New("git mode is only supported by the json store")
+	}
+	g, err := openGitRepo(js.Path)
+	if err != nil {
+		return err
+	}
+	ours, err := js.Load()
+	if err != nil {
+		return err
+	}
+	if err := g.commit("record changes made outside ToDoIt"); err != nil {
+		return err
+	}
+	out, err := g.run("rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return err
+	}
+	branch := strings.TrimSpace(out)
+	remote := settings.GitRemote
+	if _, err := g.run("fetch", "-q", remote); err != nil {
+		return err
+	}
+	upstream := remote + "/" + branch
+	if _, err := g.run("rev-parse", "--verify", "-q", upstream); err != nil {
+		if _, err := g.run("push", "-q", "-u", remote, "HEAD:"+branch); err != nil {
+			return err
+		}
+		fmt.Println("Pushed", branch, "to", remote)
+		return nil
+	}
+	head, _ := g.run("rev-parse", "HEAD")
+	theirs, _ := g.run("rev-parse", upstream)
+	base, err := g.run("merge-base", "HEAD", upstream)
+	if err != nil {
+		return fmt.Errorf("%s shares no history with %s", branch, upstream)
+	}
+	switch strings.TrimSpace(base) {
+	case strings.TrimSpace(theirs):
+		// nothing new on the remote
+	case strings.TrimSpace(head):
+		if _, err := g.run("merge", "-q", "--ff-only", upstream); err != nil {
+			return err
+		}
+		fmt.Println("Fast-forwarded to", upstream)
+	default:
+		if err := mergeUpstream(js, g, ours, strings.TrimSpace(base), upstream, settings); err != nil {
+			return err
+		}
+	}
+	if _, err := g.run("push", "-q", remote, "HEAD:"+branch); err != nil {
+		return err
+	}
+	fmt.Println("Synced", branch, "with", remote)
+	return nil
+}
+
+func mergeUpstream(js *JSONStore, g *gitRepo, ours *TaskFolder, base, upstream string, settings Settings) error {
+	baseDoc, err := g.readDoc(base)
+	if err != nil {
+		return err
+	}
+	theirsDoc, err := g.readDoc(upstream)
+	if err != nil {
+		return err
+	}
+	merge := mergeTrees(baseDoc, toFolderDoc(ours), theirsDoc)
+	for i, c := range merge.conflicts {
+		fmt.Printf("Conflict %d/%d: %q was changed on both sides\n%s\n(m) keep mine / (t) take theirs\n", i+1, len(merge.conflicts), c.Name, merge.describe(c))
+		var choice string
+		fmt.Scanln(&choice)
+		if strings.ToLower(choice) == "m" {
+			merge.keepMine(c)
+		}
+	}
+	// let git merge whatever else the repository holds, the task file is
+	// put back to ours and then replaced by the tree merge
+	// a conflict in the task file stops the merge with an error too, so it
+	// only counts when git didn't get as far as MERGE_HEAD
+	_, mergeErr := g.run("merge", "-q", "--no-commit", "--no-ff", upstream)
+	if _, err := g.run("rev-parse", "-q", "--verify", "MERGE_HEAD"); err != nil {
+		if mergeErr != nil {
+			return fmt.Errorf("git couldn't start merging %s: %w", upstream, mergeErr)
+		}
+		return fmt.Errorf("git couldn't start merging %s", upstream)
+	}
+	if _, err := g.run("checkout", "HEAD", "--", g.file); err != nil {
+		g.run("merge", "--abort")
+		return err
+	}
+	merged := fromFolderDoc(merge.result())
+	reconstructFolderFromJSON(merged)
+	rollupStatus(merged, settings)
+	if err := js.Save(merged); err != nil {
+		g.run("merge", "--abort")
+		return err
+	}
+	if _, err := g.run("add", "--", g.file); err != nil {
+		return err
+	}
+	if _, err := g.run("commit", "-q", "-m", "merge "+upstream); err != nil {
+		g.run("merge", "--abort")
+		return fmt.Errorf("merge of %s failed, nothing was changed: %w", upstream, err)
+	}
+	fmt.Printf("Merged %s, %d conflicts\n", upstream, len(merge.conflicts))
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGitCommitCmd(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't on the PATH")
+	}
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	g, err := openGitRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each save queues a commit before the one before it is done
+	var cmds []func() error
+	for _, save := range []string{"first", "second", "third"} {
+		if err := os.WriteFile(path, []byte(save), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cmd := g.commitCmd("save " + save)
+		cmds = append(cmds, func() error {
+			if msg, ok := cmd().(gitCommitMsg); ok {
+				return msg.err
+			}
+			return nil
+		})
+	}
+	g.wait()
+	for _, cmd := range cmds {
+		if err := cmd(); err != nil {
+			t.Errorf("commit error = %v", err)
+		}
+	}
+	out, err := g.run("log", "--reverse", "--format=%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a commit finds the file as it is by then, later ones may find nothing
+	// left to commit, but they never go out of order
+	saves := []string{"save first", "save second", "save third"}
+	last := -1
+	for _, subject := range strings.Split(strings.TrimSpace(out), "\n") {
+		i := slices.Index(saves, subject)
+		if i <= last {
+			t.Fatalf("log = %q, want the saves in order", out)
+		}
+		last = i
+	}
+	if data, err := g.run("show", "HEAD:tasks.json"); err != nil || data != "third" {
+		t.Errorf("committed %q, error %v, want the last save", data, err)
+	}
+}
+
+func TestMergeUpstreamError(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't on the PATH")
+	}
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	g, err := openGitRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewJSONStore(path)
+	if err := store.Save(sampleTree()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.commit("base"); err != nil {
+		t.Fatal(err)
+	}
+	root, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := g.run("rev-parse", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// upstream adds a file the working tree has untracked, so git refuses to
+	// merge before it starts
+	notes := filepath.Join(filepath.Dir(path), "notes.txt")
+	for _, args := range [][]string{
+		{"checkout", "-q", "-b", "upstream"},
+		{"add", "notes.txt"},
+		{"commit", "-q", "-m", "notes"},
+		{"checkout", "-q", "-"},
+	} {
+		if args[0] == "add" {
+			if err := os.WriteFile(notes, []byte("theirs"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := g.run(args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(notes, []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = mergeUpstream(store, g, root, strings.TrimSpace(base), "upstream", defaultSettings())
+	if err == nil || !strings.Contains(err.Error(), "would be overwritten by merge") {
+		t.Errorf("mergeUpstream() error = %v, want git's own error", err)
+	}
+}
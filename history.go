@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"go.dalton.dog/bubbleup"
+)
+
+// history is the bounded undo/redo stack. When path is set it is written
+// there after every change so it survives restarts.
+type history struct {
+	undo  []command
+	redo  []command
+	limit int
+	path  string
+}
+
+func newHistory(limit int, path string) *history {
+	return &history{limit: limit, path: path}
+}
+
+func (h *history) push(c command) {
+	h.undo = append(h.undo, c)
+	if h.limit > 0 && len(h.undo) > h.limit {
+		h.undo = h.undo[len(h.undo)-h.limit:]
+	}
+	h.redo = nil
+}
+
+// commandTypes maps the names used in the history file to their commands.
+var commandTypes = map[string]func() command{
+	"create":  func() command { return &createCommand{} },
+	"edit":    func() command { return &editCommand{} },
+	"toggle":  func() command { return &toggleCommand{} },
+	"delete":  func() command { return &deleteCommand{} },
+	"sort":    func() command { return &sortCommand{} },
+	"move":    func() command { return &moveCommand{} },
+	"restore": func() command { return &restoreCommand{} },
+	"recur":   func() command { return &recurCommand{} },
+	"state":   func() command { return &stateCommand{} },
+}
+
+func commandType(c command) string {
+	switch c.(type) {
+	case *createCommand:
+		return "create"
+	case *editCommand:
+		return "edit"
+	case *toggleCommand:
+		return "toggle"
+	case *deleteCommand:
+		return "delete"
+	case *sortCommand:
+		return "sort"
+	case *moveCommand:
+		return "move"
+	case *restoreCommand:
+		return "restore"
+	case *recurCommand:
+		return "recur"
+	case *stateCommand:
+		return "state"
+	}
+	return ""
+}
+
+type historyEntry struct {
+	Type    string          `json:"type"`
+	Command json.RawMessage `json:"command"`
+}
+
+type historyFile struct {
+	Undo []historyEntry `json:"undo"`
+	Redo []historyEntry `json:"redo"`
+}
+
+func encodeCommands(cmds []command) ([]historyEntry, error) {
+	var out []historyEntry
+	for _, c := range cmds {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, historyEntry{Type: commandType(c), Command: data})
+	}
+	return out, nil
+}
+
+func decodeCommands(entries []historyEntry) ([]command, error) {
+	var out []command
+	for _, e := range entries {
+		newCmd, ok := commandTypes[e.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown history entry %q", e.Type)
+		}
+		c := newCmd()
+		if err := json.Unmarshal(e.Command, c); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func (h *history) save() error {
+	if h.path == "" {
+		return nil
+	}
+	var f historyFile
+	var err error
+	if f.Undo, err = encodeCommands(h.undo); err != nil {
+		return fmt.Errorf("error encoding history: %w", err)
+	}
+	if f.Redo, err = encodeCommands(h.redo); err != nil {
+		return fmt.Errorf("error encoding history: %w", err)
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("error encoding history: %w", err)
+	}
+	return writeFile(h.path, data)
+}
+
+func loadHistory(limit int, path string) (*history, error) {
+	h := newHistory(limit, path)
+	data, err := readFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return h, fmt.Errorf("error reading history: %w", err)
+	}
+	var f historyFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return h, fmt.Errorf("error parsing history: %w", err)
+	}
+	if h.undo, err = decodeCommands(f.Undo); err != nil {
+		return newHistory(limit, path), fmt.Errorf("error parsing history: %w", err)
+	}
+	if h.redo, err = decodeCommands(f.Redo); err != nil {
+		return newHistory(limit, path), fmt.Errorf("error parsing history: %w", err)
+	}
+	if limit > 0 && len(h.undo) > limit {
+		h.undo = h.undo[len(h.undo)-limit:]
+	}
+	return h, nil
+}
+
+// execute applies c to the tree, records it for undo and persists it.
+func (m *model) execute(c command) tea.Cmd {
+	change, err := c.apply(m.rootFolder)
+	if err != nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, "Error: "+err.Error())
+	}
+	m.history.push(c)
+	return tea.Batch(m.save(change), m.saveHistory())
+}
+
+func (m *model) undo() tea.Cmd {
+	if len(m.history.undo) == 0 {
+		return m.alert.NewAlertCmd(bubbleup.InfoKey, "Nothing to undo")
+	}
+	c := m.history.undo[len(m.history.undo)-1]
+	change, err := c.revert(m.rootFolder)
+	if err != nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, "Cannot undo: "+err.Error())
+	}
+	m.history.undo = m.history.undo[:len(m.history.undo)-1]
+	m.history.redo = append(m.history.redo, c)
+	m.statusString = "Undid: " + c.String()
+	cmd := tea.Batch(m.save(change), m.saveHistory())
+	m.refreshAfter()
+	return cmd
+}
+
+func (m *model) redo() tea.Cmd {
+	if len(m.history.redo) == 0 {
+		return m.alert.NewAlertCmd(bubbleup.InfoKey, "Nothing to redo")
+	}
+	c := m.history.redo[len(m.history.redo)-1]
+	change, err := c.apply(m.rootFolder)
+	if err != nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, "Cannot redo: "+err.Error())
+	}
+	m.history.redo = m.history.redo[:len(m.history.redo)-1]
+	m.history.undo = append(m.history.undo, c)
+	m.statusString = "Redid: " + c.String()
+	cmd := tea.Batch(m.save(change), m.saveHistory())
+	m.refreshAfter()
+	return cmd
+}
+
+func (m *model) saveHistory() tea.Cmd {
+	if err := m.history.save(); err != nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, err.Error())
+	}
+	return nil
+}
+
+// refreshAfter redraws the current folder, falling back to the root when an
+// undo removed the folder being shown.
+func (m *model) refreshAfter() {
+	if _, err := folderPath(m.currentFolder); err != nil {
+		m.recreateList(m.rootFolder, 0)
+		return
+	}
+	m.recreateList(m.currentFolder, m.list.Index())
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+// treeJSON is the tree as it is saved, for comparing trees. Deletion times
+// are left out, a redone delete is deleted again now.
+func treeJSON(t *testing.T, root *TaskFolder) string {
+	t.Helper()
+	doc := toFolderDoc(root)
+	for _, entry := range doc.Trash {
+		entry.DeletedAt = time.Time{}
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestUndoRedo(t *testing.T) {
+	tests := []struct {
+		name    string
+		command func(t *testing.T, root *TaskFolder) command
+	}{
+		{name: "create", command: func(t *testing.T, root *TaskFolder) command {
+			return newCreateCommand(findFolder(root, "work"), &Task{ID: "new", Name: "New"})
+		}},
+		{name: "edit", command: func(t *testing.T, root *TaskFolder) command {
+			report := findTask(root, "report")
+			after := fieldsOf(report)
+			after.Name, after.Priority, after.DueDate = "Summary", 1, time.Time{}
+			return &editCommand{ID: report.ID, Before: fieldsOf(report), After: after}
+		}},
+		{name: "toggle", command: func(t *testing.T, root *TaskFolder) command {
+			return &toggleCommand{ID: "milk", Name: "Milk"}
+		}},
+		{name: "delete", command: func(t *testing.T, root *TaskFolder) command {
+			return newDeleteCommand(root, []list.Item{findFolder(root, "work"), findTask(root, "milk")})
+		}},
+		{name: "restore", command: func(t *testing.T, root *TaskFolder) command {
+			if _, err := newDeleteCommand(root, []list.Item{findTask(root, "milk")}).apply(root); err != nil {
+				t.Fatal(err)
+			}
+			return newRestoreCommand(root.Trash[0])
+		}},
+		{name: "sort", command: func(t *testing.T, root *TaskFolder) command {
+			work := findFolder(root, "work")
+			work.ChildrenTasks = append(work.ChildrenTasks, &Task{ID: "draft", Name: "Draft", ParentFolder: work})
+			return newSortCommand(work, "name", []*Task{work.ChildrenTasks[1], work.ChildrenTasks[0]})
+		}},
+		{name: "move", command: func(t *testing.T, root *TaskFolder) command {
+			return &moveCommand{ID: "milk", Name: "Milk", FromID: "root", ToID: "work"}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := sampleTree()
+			c := tt.command(t, root)
+			before := treeJSON(t, root)
+			if _, err := c.apply(root); err != nil {
+				t.Fatalf("apply() error = %v", err)
+			}
+			after := treeJSON(t, root)
+			if after == before {
+				t.Fatal("apply() didn't change the tree")
+			}
+
+			// the command is undone and redone as read back from the history
+			// file, the way it is after a restart
+			path := filepath.Join(t.TempDir(), "history.json")
+			h := newHistory(10, path)
+			h.push(c)
+			if err := h.save(); err != nil {
+				t.Fatal(err)
+			}
+			if h, err := loadHistory(10, path); err != nil || len(h.undo) != 1 {
+				t.Fatalf("loadHistory() = %d commands, error %v, want 1", len(h.undo), err)
+			} else {
+				c = h.undo[0]
+			}
+			if _, err := c.revert(root); err != nil {
+				t.Fatalf("revert() error = %v", err)
+			}
+			if got := treeJSON(t, root); got != before {
+				t.Errorf("after undo:\n got %s\nwant %s", got, before)
+			}
+			if _, err := c.apply(root); err != nil {
+				t.Fatalf("apply() again error = %v", err)
+			}
+			if got := treeJSON(t, root); got != after {
+				t.Errorf("after redo:\n got %s\nwant %s", got, after)
+			}
+		})
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	h := newHistory(2, "")
+	h.redo = []command{&toggleCommand{ID: "redo"}}
+	for _, id := range []string{"a", "b", "c"} {
+		h.push(&toggleCommand{ID: id})
+	}
+	if len(h.undo) != 2 || h.undo[0].(*toggleCommand).ID != "b" || h.undo[1].(*toggleCommand).ID != "c" {
+		t.Errorf("undo = %v, want the last two commands", h.undo)
+	}
+	if len(h.redo) != 0 {
+		t.Errorf("redo = %v, want it cleared by a new command", h.redo)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	journalBase       = "base"
+	journalCheckpoint = "checkpoint"
+	// journalCompactAt is the entry count after which the journal is
+	// rewritten down to a single base entry.
+	journalCompactAt = 500
+)
+
+// journalEntry is one line of the write-ahead journal. Mutations record the
+// subtree of the folder they happened in, addressed by its index path from
+// the root, so replaying them in order rebuilds the tree. A checkpoint marks
+// that the snapshot on disk contains every entry up to Seq.
+type journalEntry struct {
+	Seq           int64           `json:"seq"`
+	Time          time.Time       `json:"time"`
+	Op            string          `json:"op"`
+	Path          []int           `json:"path,omitempty"`
+	SchemaVersion int             `json:"schema_version,omitempty"`
+	Folder        json.RawMessage `json:"folder,omitempty"`
+}
+
+func newJournalEntry(seq int64, op string, path []int, folder *TaskFolder) (journalEntry, error) {
+	e := journalEntry{Seq: seq, Time: time.Now(), Op: op, Path: path}
+	if folder != nil {
+		data, err := json.Marshal(toFolderDoc(folder))
+		if err != nil {
+			return e, fmt.Errorf("error encoding journal entry: %w", err)
+		}
+		e.SchemaVersion, e.Folder = currentSchemaVersion, data
+	}
+	return e, nil
+}
+
+func (e journalEntry) folder() (*TaskFolder, error) {
+	if len(e.Folder) == 0 {
+		return nil, fmt.Errorf("journal entry %d has no folder", e.Seq)
+	}
+	f, err := decodeFolder(e.Folder, e.SchemaVersion)
+	if err != nil {
+		return nil, fmt.Errorf("journal entry %d: %w", e.Seq, err)
+	}
+	return f, nil
+}
+
+type journal struct {
+	path    string
+	seq     int64
+	count   int
+	hasBase bool
+}
+
+func openJournal(path string) (*journal, error) {
+	j := &journal{path: path}
+	entries, err := j.entries()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		j.seq = e.Seq
+		if e.Op == journalBase {
+			j.hasBase = true
+		}
+	}
+	j.count = len(entries)
+	return j, nil
+}
+
+// entries reads the whole journal. A torn last line (crash mid-append) is
+// dropped, anything else that doesn't parse is an error.
+func (j *journal) entries() ([]journalEntry, error) {
+	data, err := os.ReadFile(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading journal: %w", err)
+	}
+	var entries []journalEntry
+	r := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var e journalEntry
+			plain, jerr := activeVault.open(bytes.TrimSpace(line))
+			if jerr == nil {
+				jerr = json.Unmarshal(plain, &e)
+			}
+			if errors.Is(jerr, errLocked) || errors.Is(jerr, errWrongPassphrase) {
+				return nil, jerr
+			}
+			if jerr != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, fmt.Errorf("corrupt journal entry on line %d: %w", len(entries)+1, jerr)
+			}
+			entries = append(entries, e)
+		}
+		if err != nil {
+			break
+		}
+	}
+	return entries, nil
+}
+
+func (j *journal) append(op string, path []int, folder *TaskFolder) (int64, error) {
+	e, err := newJournalEntry(j.seq+1, op, path, folder)
+	if err != nil {
+		return 0, err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding journal entry: %w", err)
+	}
+	if data, err = activeVault.seal(data); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, activeVault.filePerm())
+	if err != nil {
+		return 0, fmt.Errorf("error opening journal: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return 0, fmt.Errorf("error writing journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return 0, fmt.Errorf("error syncing journal: %w", err)
+	}
+	j.seq = e.Seq
+	j.count++
+	if op == journalBase {
+		j.hasBase = true
+	}
+	return e.Seq, nil
+}
+
+// compact replaces the journal with a base entry for root followed by a
+// checkpoint, since the snapshot already holds everything before it.
+func (j *journal) compact(root *TaskFolder) error {
+	base, err := newJournalEntry(j.seq+1, journalBase, nil, root)
+	if err != nil {
+		return err
+	}
+	checkpoint := journalEntry{Seq: base.Seq, Time: base.Time, Op: journalCheckpoint}
+	var buf bytes.Buffer
+	for _, e := range []journalEntry{base, checkpoint} {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("error encoding journal entry: %w", err)
+		}
+		if data, err = activeVault.seal(data); err != nil {
+			return err
+		}
+		buf.Write(append(data, '\n'))
+	}
+	if err := writeFileAtomic(j.path, buf.Bytes(), activeVault.filePerm()); err != nil {
+		return err
+	}
+	j.seq, j.count, j.hasBase = base.Seq, 2, true
+	return nil
+}
+
+// pending returns the mutations written after the last checkpoint, i.e. the
+// ones the snapshot on disk may be missing.
+func (j *journal) pending() ([]journalEntry, error) {
+	entries, err := j.entries()
+	if err != nil {
+		return nil, err
+	}
+	var out []journalEntry
+	for _, e := range entries {
+		if e.Op == journalCheckpoint {
+			out = nil
+			continue
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// rebuild reconstructs the tree from the journal alone, starting at its
+// last base entry.
+func (j *journal) rebuild() (*TaskFolder, error) {
+	entries, err := j.entries()
+	if err != nil {
+		return nil, err
+	}
+	var root *TaskFolder
+	for _, e := range entries {
+		if e.Op == journalBase {
+			if root, err = e.folder(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if root == nil || e.Op == journalCheckpoint {
+			continue
+		}
+		if root, err = applyJournalEntry(root, e); err != nil {
+			return nil, err
+		}
+	}
+	if root == nil {
+		return nil, errors.New("journal has no base entry to recover from")
+	}
+	return root, nil
+}
+
+func applyJournalEntry(root *TaskFolder, e journalEntry) (*TaskFolder, error) {
+	replacement, err := e.folder()
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Path) == 0 {
+		return replacement, nil
+	}
+	folder := root
+	for _, i := range e.Path[:len(e.Path)-1] {
+		if i < 0 || i >= len(folder.ChildrenTaskFolders) {
+			return nil, fmt.Errorf("journal entry %d points outside the tree", e.Seq)
+		}
+		folder = folder.ChildrenTaskFolders[i]
+	}
+	last := e.Path[len(e.Path)-1]
+	if last < 0 || last >= len(folder.ChildrenTaskFolders) {
+		return nil, fmt.Errorf("journal entry %d points outside the tree", e.Seq)
+	}
+	folder.ChildrenTaskFolders[last] = replacement
+	return root, nil
+}
+
+// folderPath returns the index path of f from the root of its tree.
+func folderPath(f *TaskFolder) ([]int, error) {
+	var path []int
+	for f.Parent != nil {
+		i := -1
+		for idx, child := range f.Parent.ChildrenTaskFolders {
+			if child == f {
+				i = idx
+				break
+			}
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("folder %q is not attached to the tree", f.Name)
+		}
+		path = append([]int{i}, path...)
+		f = f.Parent
+	}
+	return path, nil
+}
+
+func commonAncestor(a, b *TaskFolder) *TaskFolder {
+	seen := map[*TaskFolder]bool{}
+	for f := a; f != nil; f = f.Parent {
+		seen[f] = true
+	}
+	for f := b; f != nil; f = f.Parent {
+		if seen[f] {
+			return f
+		}
+	}
+	return a
+}
+
+// writeFileAtomic writes data next to path, fsyncs it and renames it over
+// path, so readers only ever see the old or the new content.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error syncing temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing temp file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("error setting permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error replacing %s: %w", path, err)
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
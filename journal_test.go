@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// journalLine encodes an entry as it is appended to the journal.
+func journalLine(t *testing.T, seq int64, op string, path []int, folder *TaskFolder) string {
+	t.Helper()
+	e := journalEntry{Seq: seq, Op: op}
+	if folder != nil {
+		var err error
+		if e, err = newJournalEntry(seq, op, path, folder); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data) + "\n"
+}
+
+func TestJournalReplay(t *testing.T) {
+	root := &TaskFolder{Name: "Root"}
+	work := &TaskFolder{Name: "Work", Parent: root}
+	root.ChildrenTaskFolders = []*TaskFolder{work}
+	base := journalLine(t, 1, journalBase, nil, root)
+	checkpoint := journalLine(t, 1, journalCheckpoint, nil, nil)
+	renamed := &TaskFolder{Name: "Office"}
+	rename := journalLine(t, 2, "edit", []int{0}, renamed)
+	outside := journalLine(t, 2, "edit", []int{3}, renamed)
+
+	tests := []struct {
+		name    string
+		lines   string
+		want    string
+		pending int
+		wantErr string
+	}{
+		{name: "base only", lines: base, want: "Work", pending: 1},
+		{name: "base and edit", lines: base + rename, want: "Office", pending: 2},
+		{name: "after checkpoint", lines: base + checkpoint + rename, want: "Office", pending: 1},
+		{name: "torn last line", lines: base + rename + rename[:len(rename)/2], want: "Office", pending: 2},
+		{name: "torn line without newline", lines: base + `{"seq":2,"op":"ed`, want: "Work", pending: 1},
+		{name: "corrupt middle line", lines: base + "not json\n" + rename, wantErr: "corrupt journal entry on line 2"},
+		{name: "outside the tree", lines: base + outside, wantErr: "points outside the tree"},
+		{name: "no base", lines: rename, wantErr: "no base entry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tasks.json.journal")
+			if err := os.WriteFile(path, []byte(tt.lines), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			j := &journal{path: path}
+			got, err := j.rebuild()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("rebuild() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rebuild() error = %v", err)
+			}
+			if len(got.ChildrenTaskFolders) != 1 || got.ChildrenTaskFolders[0].Name != tt.want {
+				t.Fatalf("rebuild() children = %v, want one named %q", got.ChildrenTaskFolders, tt.want)
+			}
+			pending, err := j.pending()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pending) != tt.pending {
+				t.Errorf("pending() = %d entries, want %d", len(pending), tt.pending)
+			}
+		})
+	}
+}
@@ -1,12 +1,12 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
-	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
@@ -15,7 +15,6 @@ import (
 	"io"
 	"os"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -34,6 +33,9 @@ const (
 var config_path = "config.json"
 var last_pos int
 
+// priorityNames are what the priority field takes and shows, by priority.
+var priorityNames = []string{"", "LOW", "MED", "HIGH"}
+
 type itemDelegate struct{}
 
 func (d itemDelegate) Height() int { return 6 }
@@ -46,13 +48,11 @@ func (d itemDelegate) Render(w io.Writer, m list.Model, index int, listItem list
 	switch item := listItem.(type) {
 	case *TaskFolder:
 		s := item
-
-		var p float64
-		if s.Status.Total > 0 {
-			p = float64(s.Status.Completed) / float64(s.Status.Total)
+		title := s.Title()
+		if len(s.Tags) > 0 {
+			title += " " + tagChips(s.Tags)
 		}
-
-		str := fmt.Sprintf("%s \n %s \n %s", s.Title(), s.Status.print(), s.Progress.ViewAs(p))
+		str := fmt.Sprintf("%s \n %s \n %s", title, s.Status.print(), s.Progress.ViewAs(s.Status.percent()))
 		fn := lipgloss.NewStyle().PaddingLeft(4).Render
 		if index == m.Index() {
 			fn = func(s ...string) string {
@@ -76,6 +76,12 @@ func (d itemDelegate) Render(w io.Writer, m list.Model, index int, listItem list
 		case 3:
 			priorityStr = fmt.Sprintf("Priority: %s", lipgloss.NewStyle().Foreground(lipgloss.Color("124")).Render("HIGH"))
 		}
+		if len(s.BlockedBy) > 0 && !s.Completed {
+			priorityStr = renderWarning(fmt.Sprintf("⛔ Blocked by %s ", strings.Join(s.BlockedBy, ", "))) + priorityStr
+		}
+		if len(s.Tags) > 0 {
+			priorityStr += " " + tagChips(s.Tags)
+		}
 		str := fmt.Sprintf("%s%s", s.returnStatusString(), priorityStr)
 		fn := lipgloss.NewStyle().PaddingLeft(4).Render
 		if index == m.Index() {
@@ -87,6 +93,18 @@ func (d itemDelegate) Render(w io.Writer, m list.Model, index int, listItem list
 			}
 		}
 
+		fmt.Fprint(w, fn(str))
+	case list.DefaultItem:
+		str := fmt.Sprintf("%s \n %s", item.Title(), item.Description())
+		fn := lipgloss.NewStyle().PaddingLeft(4).Render
+		if index == m.Index() {
+			fn = func(s ...string) string {
+				return lipgloss.NewStyle().Padding(0, padding).
+					Foreground(lipgloss.Color("201")).
+					Background(lipgloss.Color("235")).
+					Render("> " + strings.Join(s, " "))
+			}
+		}
 		fmt.Fprint(w, fn(str))
 	}
 }
@@ -99,7 +117,24 @@ type CreateNewUI struct {
 	shouldCreateTaskFolder bool
 	creatingTask           bool
 	taskPriorityInput      textinput.Model
-	edit                   bool
+	taskRecurrenceInput    textinput.Model
+	taskTagsInput          textinput.Model
+	taskStartInput         textinput.Model
+	taskScheduledInput     textinput.Model
+	taskDeferInput         textinput.Model
+	taskEstimateInput      textinput.Model
+	taskRemindInput        textinput.Model
+	// knownTags are the tags in use when the form opened, tagMatches those
+	// completing what is being typed.
+	knownTags  []string
+	tagMatches []string
+	// completions is how often the task being edited was completed, for the
+	// repeat preview.
+	completions int
+	edit        bool
+	// editID is the item being edited, the list can be rebuilt under the
+	// form.
+	editID string
 }
 type model struct {
 	list          list.Model
@@ -111,60 +146,196 @@ type model struct {
 	itemsToDelete []list.Item
 	deletionMode  bool
 	sortMode      bool
+	trashMode     bool
+	backupMode    bool
+	workspaceMode bool
+	historyMode   bool
+	eventMode     bool
+	unblockedMode bool
+	checklistMode bool
+	tagMode       bool
+	stateMode     bool
+	timeMode      bool
+	reportMode    bool
+	changePrompt  bool
 	help          help.Model
 	showHelp      bool
+	store         Store
+	history       *history
+	cutItem       list.Item
+	// dependent is the task waiting for D to be pressed on what it depends on.
+	dependent *Task
+	// openTag is the tag whose items the tag browser lists, empty while it
+	// lists the tags themselves.
+	openTag string
+	// stateTask is the task the state picker moves.
+	stateTask string
+	// checklistID is the task whose checklist is open, checkInput takes the
+	// name of a step, a new one when checkEditID is empty.
+	checklistID      string
+	checkInput       textinput.Model
+	checkInputActive bool
+	checkEditID      string
+	// timeTaskID is the task whose time entries are open, timeInput takes an
+	// entry, a new one when timeEditID is empty. timerTicking is set while a
+	// tick of the running clock is pending.
+	timeTaskID      string
+	timeInput       textinput.Model
+	timeInputActive bool
+	timeEditID      string
+	timerTicking    bool
+	// snoozable are the reminders that went off last, Z snoozes them.
+	snoozable []reminderRef
+	// report is on the reports screen, grouped by reportGroupings at
+	// reportGrouping over the week, or month, starting at reportFrom.
+	report         report
+	reportGrouping int
+	reportFrom     time.Time
+	reportMonth    bool
+	settings       Settings
+	watcher        *fileWatcher
+	backups        *backups
+	// synced is the tree as last loaded from or saved to the store, the
+	// common ancestor when another session's saves have to be merged.
+	synced *folderDoc
+	// merge holds a merge waiting on conflicts to be resolved.
+	merge      *treeMerge
+	conflictAt int
+	// workspace is the name of the open workspace, empty for a plain -c
+	// file. vaults keeps the unlocked encryption per task file.
+	workspace string
+	state     workspaceState
+	vaults    map[string]*vault
+	// unlock asks for the passphrase of the workspace being switched to.
+	unlock    *passphraseModel
+	unlocking Workspace
+	// git commits every save when git mode is on. historyItem is the item
+	// whose history is on screen, historyMark the version marked to diff.
+	git         *gitRepo
+	historyItem list.Item
+	historyMark *itemRevision
+	// dueSoonAlerted holds the tasks already announced as due soon.
+	dueSoonAlerted map[string]bool
+	// lastDueCheck is when the due dates were last checked, to announce the
+	// start, scheduled and defer dates passed since.
+	lastDueCheck time.Time
+	// showDeferred lists deferred tasks in their folders too.
+	showDeferred bool
 }
 
 func (m *model) Init() tea.Cmd {
-	return m.alert.Init()
+	// the first due date check runs right away, it schedules the next
+	check := func() tea.Msg { return dueCheckMsg(time.Now()) }
+	if m.watcher != nil {
+		return tea.Batch(m.alert.Init(), m.watcher.wait(), check, m.scheduleTimerTick())
+	}
+	return tea.Batch(m.alert.Init(), check, m.scheduleTimerTick())
+}
+
+// save hands a mutation to the store, turning a failure into an alert.
+func (m *model) save(change Change) tea.Cmd {
+	now := time.Now()
+	rollupStatus(m.rootFolder, m.settings)
+	logEvents(m.synced, change, m.settings, now)
+	touch(change, now)
+	err := m.store.SaveChange(m.rootFolder, change)
+	var stale *StaleError
+	if errors.As(err, &stale) {
+		return m.sync()
+	}
+	if err != nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, "Save failed: "+err.Error())
+	}
+	// an undone stop, or a redone start, has a timer running again
+	return tea.Batch(m.saved(describeChange(change)), m.scheduleTimerTick())
+}
+
+// saved follows every successful save: the saved tree is what later merges
+// start from, it is backed up and, in git mode, committed with message in the
+// background.
+func (m *model) saved(message string) tea.Cmd {
+	m.synced = toFolderDoc(m.rootFolder)
+	if err := m.backups.snapshot(m.rootFolder, time.Now()); err != nil {
+		return m.alert.NewAlertCmd(bubbleup.WarnKey, err.Error())
+	}
+	if m.git != nil {
+		return m.git.commitCmd(message)
+	}
+	return nil
 }
 
 func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var alertCmd tea.Cmd
 	switch msg := msg.(type) {
+	case fileChangedMsg:
+		if msg.watcher != m.watcher {
+			return m, nil
+		}
+		return m, m.externalChange()
+	case gitCommitMsg:
+		return m, m.alert.NewAlertCmd(bubbleup.WarnKey, msg.err.Error())
+	case dueCheckMsg:
+		return m, tea.Batch(m.checkDueDates(time.Time(msg)), m.scheduleDueCheck())
+	case timerTickMsg:
+		m.timerTicking = false
+		return m, m.scheduleTimerTick()
 	case tea.KeyMsg:
+		if m.unlock != nil {
+			switch msg.String() {
+			case "enter":
+				return m, m.unlockWorkspace()
+			case "esc":
+				m.unlock = nil
+				return m, nil
+			case "ctrl+c":
+				return m, tea.Quit
+			}
+			var cmd tea.Cmd
+			m.unlock.input, cmd = m.unlock.input.Update(msg)
+			return m, cmd
+		}
+		if m.merge != nil {
+			switch msg.String() {
+			case "m":
+				return m, m.resolveConflict(true)
+			case "t":
+				return m, m.resolveConflict(false)
+			case "ctrl+c":
+				return m, tea.Quit
+			}
+			return m, nil
+		}
+		if m.changePrompt {
+			switch msg.String() {
+			case "r":
+				return m, m.reload()
+			case "k":
+				m.changePrompt = false
+				m.statusString = "Kept your tasks, the changes on disk were overwritten"
+				return m, m.overwrite()
+			case "esc":
+				m.changePrompt = false
+				m.statusString = "Press r to reload the changes from disk"
+				return m, nil
+			}
+		}
 		if m.deletionMode {
 			switch msg.String() {
 			case "c":
-				var newTasks []*Task
-				for _, task := range m.currentFolder.ChildrenTasks {
-					isDeleting := false
-					for _, toDelete := range m.itemsToDelete {
-						if t, ok := toDelete.(*Task); ok && t == task {
-							isDeleting = true
-							break
-						}
-					}
-					if !isDeleting {
-						newTasks = append(newTasks, task)
-					}
-				}
-				m.currentFolder.ChildrenTasks = newTasks
-
-				var newFolders []*TaskFolder
-				for _, folder := range m.currentFolder.ChildrenTaskFolders {
-					isDeleting := false
-					for _, toDelete := range m.itemsToDelete {
-						if f, ok := toDelete.(*TaskFolder); ok && f == folder {
-							isDeleting = true
-							break
-						}
-					}
-					if !isDeleting {
-						newFolders = append(newFolders, folder)
+				for _, item := range m.itemsToDelete {
+					switch v := item.(type) {
+					case *Task:
+						v.Name = strings.TrimSuffix(v.Name, " (queued for deletion)")
+					case *TaskFolder:
+						v.Name = strings.TrimSuffix(v.Name, " (queued for deletion)")
 					}
 				}
-				m.currentFolder.ChildrenTaskFolders = newFolders
-
+				cmd := m.execute(newDeleteCommand(m.currentFolder, m.itemsToDelete))
 				m.deletionMode = false
 				m.itemsToDelete = nil
-				m.statusString = "Deleted items."
+				m.statusString = "Moved items to the trash, press t to open it."
 				m.recreateList(m.currentFolder, 0)
-				if err := m.rootFolder.DeepCopy(); err != nil {
-					MarshalToFile("config_path", err)
-				}
-
-				return m, nil
+				return m, cmd
 			case "esc":
 				for _, item := range m.itemsToDelete {
 					switch v := item.(type) {
@@ -185,55 +356,90 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			switch msg.String() {
 			case "enter":
 				if m.createNewUI.edit {
-					switch selectedItem := m.list.SelectedItem().(type) {
-					case *TaskFolder:
-						selectedItem.Name, selectedItem.Desc = m.createNewUI.taskNameInput.Value(), m.createNewUI.taskDescInput.Value()
-					case *Task:
-						selectedItem.Name, selectedItem.Desc = m.createNewUI.taskNameInput.Value(), m.createNewUI.taskDescInput.Value()
+					var selectedItem list.Item
+					if t := findTask(m.rootFolder, m.createNewUI.editID); t != nil {
+						selectedItem = t
+					} else if f := findFolder(m.rootFolder, m.createNewUI.editID); f != nil {
+						selectedItem = f
+					} else {
+						return m, m.alert.NewAlertCmd(bubbleup.ErrorKey, "The item being edited no longer exists")
+					}
+					edit := &editCommand{ID: itemID(selectedItem), Before: fieldsOf(selectedItem)}
+					edit.After = edit.Before
+					edit.After.Name, edit.After.Desc = m.createNewUI.taskNameInput.Value(), m.createNewUI.taskDescInput.Value()
+					edit.After.Tags = parseTags(m.createNewUI.taskTagsInput.Value())
+					if _, ok := selectedItem.(*Task); ok {
 						if m.createNewUI.taskDueDateInput.Value() != "" {
 							dueDate, err := time.Parse("02/01/06 15:04", m.createNewUI.taskDueDateInput.Value())
 							if err != nil {
 								alertCmd = m.alert.NewAlertCmd(bubbleup.ErrorKey, "Invalid date format!")
 								return m, alertCmd
 							}
-							selectedItem.DueDate = dueDate
-							selectedItem.setTimeStatus()
+							edit.After.DueDate = dueDate
 						}
 						if m.createNewUI.taskPriorityInput.Value() != "" {
 							prio := m.createNewUI.taskPriorityInput.Value()
 							if prio == "LOW" {
-								selectedItem.Priority = 1
+								edit.After.Priority = 1
 							} else if prio == "MED" {
-								selectedItem.Priority = 2
+								edit.After.Priority = 2
 							} else {
-								selectedItem.Priority = 3
+								edit.After.Priority = 3
+							}
+						}
+						start, scheduled, deferUntil, err := m.createNewUI.planDates()
+						if err != nil {
+							return m, m.alert.NewAlertCmd(bubbleup.ErrorKey, err.Error())
+						}
+						edit.After.StartDate, edit.After.Scheduled, edit.After.DeferUntil = start, scheduled, deferUntil
+						if edit.After.Estimate, err = m.createNewUI.estimate(); err != nil {
+							return m, m.alert.NewAlertCmd(bubbleup.ErrorKey, err.Error())
+						}
+						reminders, err := parseReminders(m.createNewUI.taskRemindInput.Value(), edit.After.DueDate, fromReminderDocs(edit.Before.Reminders))
+						if err != nil {
+							return m, m.alert.NewAlertCmd(bubbleup.ErrorKey, err.Error())
+						}
+						edit.After.Reminders = toReminderDocs(reminders)
+						edit.After.Recurrence = strings.TrimSpace(m.createNewUI.taskRecurrenceInput.Value())
+						if edit.After.Recurrence != "" {
+							if _, err := parseRecurrence(edit.After.Recurrence); err != nil {
+								alertCmd = m.alert.NewAlertCmd(bubbleup.ErrorKey, "Invalid repeat rule: "+err.Error())
+								return m, alertCmd
 							}
 						}
 					}
 
+					alertCmd = m.execute(edit)
 					m.recreateList(m.currentFolder, m.list.GlobalIndex())
 					m.createNewUI.creatingTask = false
 					m.createNewUI.edit = false
 					m.createNewUI.taskNameInput.Reset()
 					m.createNewUI.taskDescInput.Reset()
 					m.createNewUI.taskPriorityInput.Reset()
-					if err := m.rootFolder.DeepCopy(); err != nil {
-						MarshalToFile(config_path, err)
-					}
+					m.createNewUI.taskRecurrenceInput.Reset()
+					m.createNewUI.taskTagsInput.Reset()
+					m.createNewUI.taskStartInput.Reset()
+					m.createNewUI.taskScheduledInput.Reset()
+					m.createNewUI.taskDeferInput.Reset()
+					m.createNewUI.taskRemindInput.Reset()
+					m.createNewUI.taskEstimateInput.Reset()
 					break
 				}
+				var created list.Item
 				if m.createNewUI.shouldCreateTaskFolder {
-					m.currentFolder.ChildrenTaskFolders = append(m.currentFolder.ChildrenTaskFolders, &TaskFolder{
-						Name:     m.createNewUI.taskNameInput.Value(),
-						Parent:   m.currentFolder,
-						Desc:     m.createNewUI.taskDescInput.Value(),
-						Progress: progress.New(),
-					})
+					created = &TaskFolder{
+						ID:   newID(),
+						Name: m.createNewUI.taskNameInput.Value(),
+						Desc: m.createNewUI.taskDescInput.Value(),
+						Tags: parseTags(m.createNewUI.taskTagsInput.Value()),
+					}
 				} else {
 					task := &Task{
+						ID:           newID(),
 						Name:         m.createNewUI.taskNameInput.Value(),
 						ParentFolder: m.currentFolder,
 						Desc:         m.createNewUI.taskDescInput.Value(),
+						Tags:         parseTags(m.createNewUI.taskTagsInput.Value()),
 					}
 					if m.createNewUI.taskDueDateInput.Value() != "" {
 						dueDate, err := time.Parse("02/01/06 15:04", m.createNewUI.taskDueDateInput.Value())
@@ -259,19 +465,41 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 							}
 						}
 					}
+					start, scheduled, deferUntil, err := m.createNewUI.planDates()
+					if err != nil {
+						return m, m.alert.NewAlertCmd(bubbleup.ErrorKey, err.Error())
+					}
+					task.StartDate, task.ScheduledDate, task.DeferUntil = start, scheduled, deferUntil
+					if task.Estimate, err = m.createNewUI.estimate(); err != nil {
+						return m, m.alert.NewAlertCmd(bubbleup.ErrorKey, err.Error())
+					}
+					if task.Reminders, err = parseReminders(m.createNewUI.taskRemindInput.Value(), task.DueDate, nil); err != nil {
+						return m, m.alert.NewAlertCmd(bubbleup.ErrorKey, err.Error())
+					}
+					if rule := strings.TrimSpace(m.createNewUI.taskRecurrenceInput.Value()); rule != "" {
+						if _, err := parseRecurrence(rule); err != nil {
+							alertCmd = m.alert.NewAlertCmd(bubbleup.ErrorKey, "Invalid repeat rule: "+err.Error())
+							return m, alertCmd
+						}
+						task.Recurrence = rule
+					}
 
-					m.currentFolder.ChildrenTasks = append(m.currentFolder.ChildrenTasks, task)
-					m.currentFolder.Status.Total++
+					created = task
 				}
+				alertCmd = m.execute(newCreateCommand(m.currentFolder, created))
 				m.recreateList(m.currentFolder, 0)
-				if err := m.rootFolder.DeepCopy(); err != nil {
-					MarshalToFile(config_path, err)
-				}
 				m.createNewUI.creatingTask = false
 				m.createNewUI.taskNameInput.Reset()
 				m.createNewUI.taskDescInput.Reset()
 				m.createNewUI.taskDueDateInput.Reset()
 				m.createNewUI.taskPriorityInput.Reset()
+				m.createNewUI.taskRecurrenceInput.Reset()
+				m.createNewUI.taskTagsInput.Reset()
+				m.createNewUI.taskStartInput.Reset()
+				m.createNewUI.taskScheduledInput.Reset()
+				m.createNewUI.taskDeferInput.Reset()
+				m.createNewUI.taskRemindInput.Reset()
+				m.createNewUI.taskEstimateInput.Reset()
 			case "esc":
 				m.createNewUI.creatingTask = false
 				m.createNewUI.status = ""
@@ -281,6 +509,13 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.createNewUI.taskDescInput.Reset()
 				m.createNewUI.taskDueDateInput.Reset()
 				m.createNewUI.taskPriorityInput.Reset()
+				m.createNewUI.taskRecurrenceInput.Reset()
+				m.createNewUI.taskTagsInput.Reset()
+				m.createNewUI.taskStartInput.Reset()
+				m.createNewUI.taskScheduledInput.Reset()
+				m.createNewUI.taskDeferInput.Reset()
+				m.createNewUI.taskRemindInput.Reset()
+				m.createNewUI.taskEstimateInput.Reset()
 
 			case "down":
 				if m.createNewUI.taskNameInput.Focused() {
@@ -291,32 +526,74 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					if !m.createNewUI.shouldCreateTaskFolder {
 						m.createNewUI.taskDueDateInput.Focus()
 					} else {
-						m.createNewUI.taskNameInput.Focus()
+						m.createNewUI.taskTagsInput.Focus()
 					}
 				} else if m.createNewUI.taskDueDateInput.Focused() {
 					m.createNewUI.taskDueDateInput.Blur()
+					m.createNewUI.taskStartInput.Focus()
+				} else if m.createNewUI.taskStartInput.Focused() {
+					m.createNewUI.taskStartInput.Blur()
+					m.createNewUI.taskScheduledInput.Focus()
+				} else if m.createNewUI.taskScheduledInput.Focused() {
+					m.createNewUI.taskScheduledInput.Blur()
+					m.createNewUI.taskDeferInput.Focus()
+				} else if m.createNewUI.taskDeferInput.Focused() {
+					m.createNewUI.taskDeferInput.Blur()
+					m.createNewUI.taskRemindInput.Focus()
+				} else if m.createNewUI.taskRemindInput.Focused() {
+					m.createNewUI.taskRemindInput.Blur()
 					m.createNewUI.taskPriorityInput.Focus()
 				} else if m.createNewUI.taskPriorityInput.Focused() {
 					m.createNewUI.taskPriorityInput.Blur()
+					m.createNewUI.taskEstimateInput.Focus()
+				} else if m.createNewUI.taskEstimateInput.Focused() {
+					m.createNewUI.taskEstimateInput.Blur()
+					m.createNewUI.taskRecurrenceInput.Focus()
+				} else if m.createNewUI.taskRecurrenceInput.Focused() {
+					m.createNewUI.taskRecurrenceInput.Blur()
+					m.createNewUI.taskTagsInput.Focus()
+				} else if m.createNewUI.taskTagsInput.Focused() {
+					m.createNewUI.taskTagsInput.Blur()
 					m.createNewUI.taskNameInput.Focus()
 				}
 			case "up":
 				if m.createNewUI.taskNameInput.Focused() {
 					m.createNewUI.taskNameInput.Blur()
-					if m.createNewUI.shouldCreateTaskFolder {
-						m.createNewUI.taskDescInput.Focus()
-					} else {
-						m.createNewUI.taskPriorityInput.Focus()
-					}
+					m.createNewUI.taskTagsInput.Focus()
 				} else if m.createNewUI.taskDescInput.Focused() {
 					m.createNewUI.taskDescInput.Blur()
 					m.createNewUI.taskNameInput.Focus()
 				} else if m.createNewUI.taskDueDateInput.Focused() {
 					m.createNewUI.taskDueDateInput.Blur()
 					m.createNewUI.taskDescInput.Focus()
+				} else if m.createNewUI.taskStartInput.Focused() {
+					m.createNewUI.taskStartInput.Blur()
+					m.createNewUI.taskDueDateInput.Focus()
+				} else if m.createNewUI.taskScheduledInput.Focused() {
+					m.createNewUI.taskScheduledInput.Blur()
+					m.createNewUI.taskStartInput.Focus()
+				} else if m.createNewUI.taskDeferInput.Focused() {
+					m.createNewUI.taskDeferInput.Blur()
+					m.createNewUI.taskScheduledInput.Focus()
+				} else if m.createNewUI.taskRemindInput.Focused() {
+					m.createNewUI.taskRemindInput.Blur()
+					m.createNewUI.taskDeferInput.Focus()
 				} else if m.createNewUI.taskPriorityInput.Focused() {
 					m.createNewUI.taskPriorityInput.Blur()
-					m.createNewUI.taskDueDateInput.Focus()
+					m.createNewUI.taskRemindInput.Focus()
+				} else if m.createNewUI.taskEstimateInput.Focused() {
+					m.createNewUI.taskEstimateInput.Blur()
+					m.createNewUI.taskPriorityInput.Focus()
+				} else if m.createNewUI.taskRecurrenceInput.Focused() {
+					m.createNewUI.taskRecurrenceInput.Blur()
+					m.createNewUI.taskEstimateInput.Focus()
+				} else if m.createNewUI.taskTagsInput.Focused() {
+					m.createNewUI.taskTagsInput.Blur()
+					if m.createNewUI.shouldCreateTaskFolder {
+						m.createNewUI.taskDescInput.Focus()
+					} else {
+						m.createNewUI.taskRecurrenceInput.Focus()
+					}
 				}
 			case "alt+t":
 				if m.createNewUI.edit {
@@ -327,6 +604,13 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.createNewUI.taskDescInput.Blur()
 				m.createNewUI.taskDueDateInput.Blur()
 				m.createNewUI.taskPriorityInput.Blur()
+				m.createNewUI.taskRecurrenceInput.Blur()
+				m.createNewUI.taskTagsInput.Blur()
+				m.createNewUI.taskStartInput.Blur()
+				m.createNewUI.taskScheduledInput.Blur()
+				m.createNewUI.taskDeferInput.Blur()
+				m.createNewUI.taskEstimateInput.Blur()
+				m.createNewUI.taskRemindInput.Blur()
 				if m.createNewUI.shouldCreateTaskFolder {
 					m.createNewUI.status = "New Folder: " + TASK_MESSAGE
 					alertCmd := m.alert.NewAlertCmd(bubbleup.InfoKey, "Creating TaskFolder")
@@ -350,9 +634,31 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.createNewUI.taskDueDateInput, cmd = m.createNewUI.taskDueDateInput.Update(msg)
 			cmds = append(cmds, cmd)
 
+			m.createNewUI.taskStartInput, cmd = m.createNewUI.taskStartInput.Update(msg)
+			cmds = append(cmds, cmd)
+
+			m.createNewUI.taskScheduledInput, cmd = m.createNewUI.taskScheduledInput.Update(msg)
+			cmds = append(cmds, cmd)
+
+			m.createNewUI.taskDeferInput, cmd = m.createNewUI.taskDeferInput.Update(msg)
+			cmds = append(cmds, cmd)
+
+			m.createNewUI.taskRemindInput, cmd = m.createNewUI.taskRemindInput.Update(msg)
+			cmds = append(cmds, cmd)
+
 			m.createNewUI.taskPriorityInput, cmd = m.createNewUI.taskPriorityInput.Update(msg)
 			cmds = append(cmds, cmd)
 
+			m.createNewUI.taskEstimateInput, cmd = m.createNewUI.taskEstimateInput.Update(msg)
+			cmds = append(cmds, cmd)
+
+			m.createNewUI.taskRecurrenceInput, cmd = m.createNewUI.taskRecurrenceInput.Update(msg)
+			cmds = append(cmds, cmd)
+
+			m.createNewUI.taskTagsInput, cmd = m.createNewUI.taskTagsInput.Update(msg)
+			m.createNewUI.suggestTags()
+			cmds = append(cmds, cmd, alertCmd)
+
 			return m, tea.Batch(cmds...)
 		}
 
@@ -364,30 +670,33 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				sort.Slice(vm, func(i, j int) bool {
 					return vm[i].Priority > vm[j].Priority
 				})
-				m.currentFolder.ChildrenTasks = vm
+				cmd := m.execute(newSortCommand(m.currentFolder, "priority", vm))
 				m.recreateList(m.currentFolder, 0)
 				m.sortMode = false
 				m.statusString = "Sorted by priority"
+				return m, cmd
 			case "2":
 				vm := make([]*Task, len(m.currentFolder.ChildrenTasks))
 				copy(vm, m.currentFolder.ChildrenTasks)
 				sort.Slice(vm, func(i, j int) bool {
 					return vm[i].Name > vm[j].Name
 				})
-				m.currentFolder.ChildrenTasks = vm
+				cmd := m.execute(newSortCommand(m.currentFolder, "name", vm))
 				m.recreateList(m.currentFolder, 0)
 				m.sortMode = false
 				m.statusString = "Sorted by name"
+				return m, cmd
 			case "3":
 				vm := make([]*Task, len(m.currentFolder.ChildrenTasks))
 				copy(vm, m.currentFolder.ChildrenTasks)
 				sort.SliceStable(vm, func(i, j int) bool {
 					return vm[i].Completed != vm[j].Completed
 				})
-				m.currentFolder.ChildrenTasks = vm
+				cmd := m.execute(newSortCommand(m.currentFolder, "completion", vm))
 				m.recreateList(m.currentFolder, 0)
 				m.sortMode = false
 				m.statusString = "Sorted by completion status "
+				return m, cmd
 			case "esc":
 				m.sortMode = false
 				m.statusString = "Cancelled sort mode"
@@ -398,11 +707,178 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.list.FilterState() == list.Filtering {
 			break
 		}
+		if m.trashMode {
+			switch msg.String() {
+			case "enter":
+				trashed, ok := m.list.SelectedItem().(*TrashedItem)
+				if !ok {
+					return m, nil
+				}
+				cmd := m.execute(newRestoreCommand(trashed))
+				m.statusString = fmt.Sprintf("Restored %s to %s", itemName(trashed.item()), trashed.ParentPath)
+				if findFolder(m.rootFolder, trashed.ParentID) == nil {
+					m.statusString = fmt.Sprintf("%s no longer exists, restored %s to Root", trashed.ParentPath, itemName(trashed.item()))
+				}
+				m.recreateTrashList(m.list.Index())
+				return m, cmd
+			case "d":
+				trashed, ok := m.list.SelectedItem().(*TrashedItem)
+				if !ok {
+					return m, nil
+				}
+				cmd := m.save(purgeTrash(m.rootFolder, []*TrashedItem{trashed}))
+				m.statusString = "Purged " + itemName(trashed.item())
+				m.recreateTrashList(m.list.Index())
+				return m, cmd
+			case "u", "ctrl+r":
+				var cmd tea.Cmd
+				if msg.String() == "u" {
+					cmd = m.undo()
+				} else {
+					cmd = m.redo()
+				}
+				m.recreateTrashList(0)
+				return m, cmd
+			case "esc", "t", "b":
+				m.trashMode = false
+				m.statusString = "Left the trash"
+				m.recreateList(m.currentFolder, 0)
+				return m, nil
+			case "ctrl+c", "q":
+				return m, tea.Quit
+			}
+			break
+		}
+		if m.workspaceMode {
+			switch msg.String() {
+			case "enter":
+				ws, ok := m.list.SelectedItem().(*workspaceItem)
+				if !ok {
+					return m, nil
+				}
+				return m, m.openWorkspace(ws.Workspace)
+			case "esc", "w":
+				if m.rootFolder == nil {
+					// picked nothing at startup
+					return m, tea.Quit
+				}
+				m.workspaceMode = false
+				m.statusString = "Left the workspaces"
+				m.recreateList(m.currentFolder, 0)
+				return m, nil
+			case "ctrl+c", "q":
+				return m, tea.Quit
+			}
+			break
+		}
+		if m.historyMode {
+			switch msg.String() {
+			case " ":
+				m.historyMark, _ = m.list.SelectedItem().(*itemRevision)
+				if m.historyMark != nil {
+					m.statusString = fmt.Sprintf("Marked %.7s, select another version and press d", m.historyMark.Hash)
+				}
+				return m, nil
+			case "d":
+				m.diffSelected()
+				return m, nil
+			case "enter":
+				return m, m.restoreRevision()
+			case "esc", "L":
+				m.historyMode = false
+				m.statusString = "Left the history"
+				m.recreateList(m.currentFolder, 0)
+				return m, nil
+			case "ctrl+c", "q":
+				return m, tea.Quit
+			}
+			break
+		}
+		if m.eventMode {
+			switch msg.String() {
+			case "esc", "i":
+				m.eventMode = false
+				m.statusString = "Left the change log"
+				m.recreateList(m.currentFolder, 0)
+				return m, nil
+			case "ctrl+c", "q":
+				return m, tea.Quit
+			}
+			break
+		}
+		if m.checklistMode {
+			if cmd, ok := m.updateChecklist(msg); ok {
+				return m, cmd
+			}
+			break
+		}
+		if m.stateMode {
+			if cmd, ok := m.updateStates(msg); ok {
+				return m, cmd
+			}
+			break
+		}
+		if m.reportMode {
+			return m, m.updateReports(msg)
+		}
+		if m.timeMode {
+			if cmd, ok := m.updateTimeEntries(msg); ok {
+				return m, cmd
+			}
+			break
+		}
+		if m.tagMode {
+			if cmd, ok := m.updateTags(msg); ok {
+				return m, cmd
+			}
+			break
+		}
+		if m.unblockedMode {
+			switch msg.String() {
+			case "enter":
+				t, ok := m.list.SelectedItem().(*Task)
+				if !ok {
+					return m, nil
+				}
+				m.unblockedMode = false
+				m.recreateListAt(t.ParentFolder, t.ID)
+				m.statusString = "Opened " + t.ParentFolder.returnPath()
+				return m, nil
+			case "esc", "U":
+				m.unblockedMode = false
+				m.statusString = "Left unblocked tasks"
+				m.recreateList(m.currentFolder, 0)
+				return m, nil
+			case "ctrl+c", "q":
+				return m, tea.Quit
+			}
+			break
+		}
+		if m.backupMode {
+			switch msg.String() {
+			case "enter":
+				b, ok := m.list.SelectedItem().(*backup)
+				if !ok {
+					return m, nil
+				}
+				return m, m.restoreBackup(b)
+			case "esc", "B":
+				m.backupMode = false
+				m.statusString = "Left the backups"
+				m.recreateList(m.currentFolder, 0)
+				return m, nil
+			case "ctrl+c", "q":
+				return m, tea.Quit
+			}
+			break
+		}
 		switch msg.String() {
 		case "ctrl+c", "q":
 			return m, tea.Quit
 		case "r":
-			main()
+			cmd := m.reload()
+			m.statusString = "Reloaded tasks"
+			return m, cmd
 		case "f":
 			m.statusString = "In sort mode, sort by (1) Priority / (2) Name / (3) Completion Status"
 			m.sortMode = true
@@ -413,19 +889,97 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case *TaskFolder:
 				m.recreateList(selectedItem, 0)
 			case *Task:
-				selectedItem.setCompletionStatus(!selectedItem.Completed)
-				m.recreateList(selectedItem.ParentFolder, m.list.GlobalIndex())
-				if err := m.rootFolder.DeepCopy(); err != nil {
-					MarshalToFile(config_path, err)
+				// a task with steps opens like a folder, c in it completes it
+				if len(selectedItem.Checklist) > 0 {
+					return m, m.showChecklist(selectedItem)
 				}
+				alertCmd = m.completeTask(selectedItem, false)
+			}
+		case "F":
+			if t, ok := m.list.SelectedItem().(*Task); ok {
+				alertCmd = m.completeTask(t, true)
 			}
+		case "D":
+			t, ok := m.list.SelectedItem().(*Task)
+			if !ok {
+				return m, m.alert.NewAlertCmd(bubbleup.InfoKey, "Only tasks can have dependencies")
+			}
+			if m.dependent != nil {
+				return m, m.linkDependency(t)
+			}
+			m.dependent = t
+			m.statusString = fmt.Sprintf("Linking %s, press D on the task it depends on (again to unlink), or on itself to cancel", t.Name)
+			return m, nil
+		case "U":
+			return m, m.showUnblocked()
+		case "#":
+			return m, m.showTags()
+		case "z":
+			m.showDeferred = !m.showDeferred
+			m.statusString = "Hiding deferred tasks"
+			if m.showDeferred {
+				m.statusString = "Showing deferred tasks"
+			}
+			m.recreateList(m.currentFolder, 0)
+			return m, nil
+		case "s":
+			t, ok := m.list.SelectedItem().(*Task)
+			if !ok {
+				return m, m.alert.NewAlertCmd(bubbleup.InfoKey, "Only tasks have a state")
+			}
+			next, ok := t.cycledState()
+			if !ok {
+				return m, m.alert.NewAlertCmd(bubbleup.InfoKey, t.Name+" can't leave "+t.state().Name)
+			}
+			return m, m.moveToState(t, next, false)
+		case "S":
+			t, ok := m.list.SelectedItem().(*Task)
+			if !ok {
+				return m, m.alert.NewAlertCmd(bubbleup.InfoKey, "Only tasks have a state")
+			}
+			return m, m.showStates(t)
+		case "o":
+			t, ok := m.list.SelectedItem().(*Task)
+			if !ok {
+				return m, m.alert.NewAlertCmd(bubbleup.InfoKey, "Only tasks have checklists, enter opens a folder")
+			}
+			return m, m.showChecklist(t)
+		case "T":
+			t, ok := m.list.SelectedItem().(*Task)
+			if !ok {
+				return m, m.alert.NewAlertCmd(bubbleup.InfoKey, "Only tasks can be timed")
+			}
+			cmd := m.toggleTimer(t)
+			m.recreateListAt(m.currentFolder, t.ID)
+			return m, cmd
+		case "E":
+			t, ok := m.list.SelectedItem().(*Task)
+			if !ok {
+				return m, m.alert.NewAlertCmd(bubbleup.InfoKey, "Only tasks have time entries")
+			}
+			return m, m.showTimeEntries(t)
+		case "R":
+			return m, m.showReports()
+		case "Z":
+			return m, m.snoozeReminders()
 		case "e":
 			m.createNewUI.creatingTask = true
 			m.createNewUI.edit = true
+			m.createNewUI.editID = itemID(m.list.SelectedItem())
 			m.createNewUI.taskNameInput.Focus()
 			m.createNewUI.taskDescInput.Blur()
 			m.createNewUI.taskDueDateInput.Blur()
 			m.createNewUI.taskPriorityInput.Blur()
+			m.createNewUI.taskRecurrenceInput.Blur()
+			m.createNewUI.taskTagsInput.Blur()
+			m.createNewUI.taskStartInput.Blur()
+			m.createNewUI.taskScheduledInput.Blur()
+			m.createNewUI.taskDeferInput.Blur()
+			m.createNewUI.taskEstimateInput.Blur()
+			m.createNewUI.taskRemindInput.Blur()
+			m.createNewUI.knownTags = knownTags(m.rootFolder)
+			m.createNewUI.completions = 0
+			m.createNewUI.taskTagsInput.SetValue(strings.Join(itemTags(m.list.SelectedItem()), " "))
 			switch selectedItem := m.list.SelectedItem().(type) {
 			case *TaskFolder:
 				m.createNewUI.shouldCreateTaskFolder = true
@@ -440,11 +994,18 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if !selectedItem.DueDate.IsZero() {
 					m.createNewUI.taskDueDateInput.SetValue(selectedItem.DueDate.Format("02/01/06 15:04"))
 				}
-				if selectedItem.Priority != 0 {
-					m.createNewUI.taskPriorityInput.SetValue(strconv.Itoa(selectedItem.Priority))
+				if selectedItem.Priority > 0 && selectedItem.Priority < len(priorityNames) {
+					m.createNewUI.taskPriorityInput.SetValue(priorityNames[selectedItem.Priority])
 				} else {
 					m.createNewUI.taskPriorityInput.SetValue("")
 				}
+				m.createNewUI.taskStartInput.SetValue(formDate(selectedItem.StartDate))
+				m.createNewUI.taskScheduledInput.SetValue(formDate(selectedItem.ScheduledDate))
+				m.createNewUI.taskDeferInput.SetValue(formDate(selectedItem.DeferUntil))
+				m.createNewUI.taskRemindInput.SetValue(formReminders(selectedItem.Reminders))
+				m.createNewUI.taskRecurrenceInput.SetValue(selectedItem.Recurrence)
+				m.createNewUI.taskEstimateInput.SetValue(formEstimate(selectedItem.Estimate))
+				m.createNewUI.completions = len(selectedItem.Completions)
 			}
 		case "b":
 			if m.currentFolder != nil {
@@ -454,8 +1015,7 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "p":
 			switch v := m.list.SelectedItem().(type) {
 			case *Task:
-				alertCmd = m.alert.NewAlertCmd(bubbleup.ErrorKey, "Cannot preview a Task")
-				return m, alertCmd
+				m.statusString = dependencyChain(m.rootFolder, v)
 			case *TaskFolder:
 				m.statusString = v.returnTree()
 
@@ -465,7 +1025,7 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			selectedItem := m.list.SelectedItem()
 			var exists bool
 			for _, item := range m.itemsToDelete {
-				if item == selectedItem {
+				if itemID(item) == itemID(selectedItem) {
 					exists = true
 					break
 				}
@@ -499,6 +1059,7 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		case "n":
 			m.createNewUI.creatingTask = true
+			m.createNewUI.knownTags = knownTags(m.rootFolder)
 			m.createNewUI.taskNameInput.Focus()
 			m.createNewUI.taskDescInput.Blur()
 			if m.createNewUI.shouldCreateTaskFolder {
@@ -513,6 +1074,49 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "h":
 			m.showHelp = !m.showHelp
 			return m, nil
+		case "t":
+			m.trashMode = true
+			m.statusString = "Trash: enter restores, d purges for good, esc leaves"
+			m.recreateTrashList(0)
+			return m, nil
+		case "B":
+			return m, m.showBackups()
+		case "w":
+			return m, m.showWorkspaces()
+		case "L":
+			return m, m.showItemHistory()
+		case "i":
+			return m, m.showEvents()
+		case "u":
+			return m, m.undo()
+		case "ctrl+r":
+			return m, m.redo()
+		case "x":
+			if m.list.SelectedItem() == nil {
+				return m, nil
+			}
+			m.cutItem = m.list.SelectedItem()
+			m.statusString = fmt.Sprintf("Cut %s, open a folder and press v to move it there", itemName(m.cutItem))
+			return m, nil
+		case "v":
+			if m.cutItem == nil {
+				return m, m.alert.NewAlertCmd(bubbleup.InfoKey, "Nothing to move, cut an item with x first")
+			}
+			move := &moveCommand{ID: itemID(m.cutItem), Name: itemName(m.cutItem), ToID: m.currentFolder.ID}
+			switch v := m.cutItem.(type) {
+			case *Task:
+				move.FromID = v.ParentFolder.ID
+			case *TaskFolder:
+				move.FromID = v.Parent.ID
+			}
+			if move.FromID == move.ToID {
+				return m, m.alert.NewAlertCmd(bubbleup.InfoKey, "Item is already in this folder")
+			}
+			m.cutItem = nil
+			cmd := m.execute(move)
+			m.statusString = "Moved " + move.Name
+			m.recreateList(m.currentFolder, 0)
+			return m, cmd
 
 		}
 
@@ -538,6 +1142,9 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m *model) View() string {
+	if m.unlock != nil {
+		return m.alert.Render(m.unlock.View())
+	}
 	if m.createNewUI.creatingTask {
 		var s string
 		if m.showHelp {
@@ -546,7 +1153,16 @@ func (m *model) View() string {
 				m.createNewUI.taskNameInput.View(),
 				m.createNewUI.taskDescInput.View(),
 				m.createNewUI.taskDueDateInput.View(),
+				m.createNewUI.taskStartInput.View(),
+				m.createNewUI.taskScheduledInput.View(),
+				m.createNewUI.taskDeferInput.View(),
+				m.createNewUI.taskRemindInput.View(),
 				m.createNewUI.taskPriorityInput.View(),
+				m.createNewUI.taskEstimateInput.View(),
+				m.createNewUI.taskRecurrenceInput.View(),
+				m.createNewUI.recurrencePreview(),
+				m.createNewUI.taskTagsInput.View(),
+				m.createNewUI.tagHint(),
 				"\n"+m.help.View(createKeys),
 			)
 		} else {
@@ -558,32 +1174,93 @@ func (m *model) View() string {
 				"\n",
 				m.createNewUI.taskDueDateInput.View(),
 				"\n",
+				m.createNewUI.taskStartInput.View(),
+				"\n",
+				m.createNewUI.taskScheduledInput.View(),
+				"\n",
+				m.createNewUI.taskDeferInput.View(),
+				"\n",
+				m.createNewUI.taskRemindInput.View(),
+				"\n",
 				m.createNewUI.taskPriorityInput.View(),
+				"\n",
+				m.createNewUI.taskEstimateInput.View(),
+				"\n",
+				m.createNewUI.taskRecurrenceInput.View(),
+				m.createNewUI.recurrencePreview(),
+				"\n",
+				m.createNewUI.taskTagsInput.View(),
+				m.createNewUI.tagHint(),
 			)
 		}
 		return docStyle.Render(m.alert.Render(s))
 	}
 
 	var s string
-	statusView := docStyle.Render(m.statusString)
+	mainView := m.list.View()
+	if m.reportMode {
+		mainView = docStyle.Render(m.report.table())
+	}
+	statusView := docStyle.Render(m.timerLine() + m.statusString)
+	if m.checkInputActive {
+		statusView = docStyle.Render("Step name (enter saves, esc cancels)\n" + m.checkInput.View())
+	}
+	if m.timeInputActive {
+		statusView = docStyle.Render("Start and duration, no duration for a running entry (enter saves, esc cancels)\n" + m.timeInput.View())
+	}
 
 	if m.showHelp {
 		var helpView string
 		if m.deletionMode {
 			helpView = m.help.View(deleteKeys)
+		} else if m.trashMode {
+			helpView = m.help.View(trashKeys)
+		} else if m.backupMode {
+			helpView = m.help.View(backupKeys)
+		} else if m.workspaceMode {
+			helpView = m.help.View(workspaceKeys)
+		} else if m.historyMode {
+			helpView = m.help.View(historyKeys)
+		} else if m.eventMode {
+			helpView = m.help.View(eventKeys)
+		} else if m.unblockedMode {
+			helpView = m.help.View(unblockedKeys)
+		} else if m.checklistMode {
+			helpView = m.help.View(checklistKeys)
+		} else if m.tagMode {
+			helpView = m.help.View(tagKeys)
+		} else if m.stateMode {
+			helpView = m.help.View(stateKeys)
+		} else if m.timeMode {
+			helpView = m.help.View(timeKeys)
+		} else if m.reportMode {
+			helpView = m.help.View(reportKeys)
 		} else {
 			helpView = m.help.View(*keys)
 		}
 		s += lipgloss.JoinVertical(lipgloss.Left,
-			lipgloss.JoinHorizontal(lipgloss.Left, statusView, m.list.View()),
+			lipgloss.JoinHorizontal(lipgloss.Left, statusView, mainView),
 			"\n"+helpView,
 		)
 	} else {
-		s += lipgloss.JoinHorizontal(lipgloss.Left, statusView, m.list.View())
+		s += lipgloss.JoinHorizontal(lipgloss.Left, statusView, mainView)
 	}
 
 	return m.alert.Render(s)
 }
+
+// recreateListAt lists folder with the item with the given ID selected, or
+// the first one when it isn't listed, e.g. because it is deferred.
+func (m *model) recreateListAt(folder *TaskFolder, id string) {
+	m.recreateList(folder, 0)
+	for i, item := range m.list.Items() {
+		if itemID(item) == id {
+			m.list.Select(i)
+			return
+		}
+	}
+}
+
 func (m *model) recreateList(folder *TaskFolder, selectedItem int) {
 	if folder == nil {
 		return
@@ -597,11 +1274,19 @@ func (m *model) recreateList(folder *TaskFolder, selectedItem int) {
 		}
 		items = append(items, child)
 	}
+	now, deferred := time.Now(), 0
 	for _, child := range folder.ChildrenTasks {
+		if child.deferred(now) && !m.showDeferred {
+			deferred++
+			continue
+		}
 		items = append(items, child)
 	}
 	m.list.SetItems(items)
 	m.list.Title = fmt.Sprintf("%s \n %s", m.currentFolder.returnPath(), m.currentFolder.Status.print())
+	if deferred > 0 {
+		m.list.Title += fmt.Sprintf(" 💤 %d deferred, z shows them", deferred)
+	}
 	m.list.Select(selectedItem)
 	m.list.AdditionalShortHelpKeys = func() []key.Binding {
 		return []key.Binding{
@@ -615,23 +1300,58 @@ func (m *model) recreateList(folder *TaskFolder, selectedItem int) {
 			key.NewBinding(key.WithKeys("enter"), key.WithHelp("d", "enter deletion mode")),
 			key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "create new item")),
 			key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "edit item")),
-			key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "enter folder/toggle item")),
+			key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "enter folder or checklist/toggle item")),
+			key.NewBinding(key.WithKeys("u"), key.WithHelp("u", "undo")),
+			key.NewBinding(key.WithKeys("ctrl+r"), key.WithHelp("ctrl+r", "redo")),
+			key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "cut item to move")),
+			key.NewBinding(key.WithKeys("v"), key.WithHelp("v", "move cut item here")),
+			key.NewBinding(key.WithKeys("t"), key.WithHelp("t", "open trash")),
+			key.NewBinding(key.WithKeys("B"), key.WithHelp("B", "restore from backup")),
+			key.NewBinding(key.WithKeys("w"), key.WithHelp("w", "switch workspace")),
+			key.NewBinding(key.WithKeys("L"), key.WithHelp("L", "item history (git mode)")),
+			key.NewBinding(key.WithKeys("i"), key.WithHelp("i", "item change log")),
+			key.NewBinding(key.WithKeys("D"), key.WithHelp("D", "add/remove dependency")),
+			key.NewBinding(key.WithKeys("F"), key.WithHelp("F", "complete even if blocked")),
+			key.NewBinding(key.WithKeys("U"), key.WithHelp("U", "unblocked tasks")),
+			key.NewBinding(key.WithKeys("p"), key.WithHelp("p", "dependency chain/folder structure")),
+			key.NewBinding(key.WithKeys("o"), key.WithHelp("o", "open task checklist")),
+			key.NewBinding(key.WithKeys("#"), key.WithHelp("#", "browse tags")),
+			key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "next task state")),
+			key.NewBinding(key.WithKeys("S"), key.WithHelp("S", "pick task state")),
+			key.NewBinding(key.WithKeys("z"), key.WithHelp("z", "show/hide deferred tasks")),
+			key.NewBinding(key.WithKeys("T"), key.WithHelp("T", "start/stop timer")),
+			key.NewBinding(key.WithKeys("E"), key.WithHelp("E", "time entries")),
+			key.NewBinding(key.WithKeys("R"), key.WithHelp("R", "time reports")),
+			key.NewBinding(key.WithKeys("Z"), key.WithHelp("Z", "snooze reminders")),
 		}
 	}
 }
 
 func main() {
 
+	var storeKind, workspace string
 	flag.StringVar(&config_path, "c", config_path, "config file path")
+	flag.StringVar(&storeKind, "store", "", "storage backend (json, sqlite), picked from the -c extension by default")
+	flag.StringVar(&settings_path, "s", settings_path, "settings file path")
+	flag.StringVar(&workspace, "w", "", "workspace from the settings to open")
 	flag.Parse()
-	delegate := itemDelegate{}
-	err, ferr := loadIntoTaskFolder(config_path)
-	if ferr != nil {
-		panic(ferr)
+	settings, err := loadSettings(settings_path)
+	if err != nil {
+		fmt.Println("Error loading settings:", err)
+		os.Exit(1)
+	}
+	taskStates = settings.States
+	explicitPath := false
+	flag.Visit(func(f *flag.Flag) { explicitPath = explicitPath || f.Name == "c" || f.Name == "store" })
+	if workspace != "" {
+		ws, ok := settings.workspace(workspace)
+		if !ok {
+			fmt.Printf("Error: no workspace %q in %s\n", workspace, settings_path)
+			os.Exit(1)
+		}
+		config_path, storeKind = ws.Path, ws.Store
 	}
-	root := err
-	root.Parent = nil
-	reconstructFolderFromJSON(root)
+	delegate := itemDelegate{}
 	ti := textinput.New()
 	t2 := textarea.New()
 	ti.Placeholder = "New Task Name (Mandatory)"
@@ -645,17 +1365,100 @@ func main() {
 	t4 := textinput.New()
 	t4.Placeholder = "Priority (LOW/MED/HIGH) (Optional)"
 	t4.Width = 100
+	t5 := textinput.New()
+	t5.Placeholder = "Repeat: daily, weekly on mon,thu, monthly on 1, every 3 days after completion, RRULE:... (Optional)"
+	t5.Width = 100
+	t7 := textinput.New()
+	t7.Placeholder = "Tags, e.g. @home #backend +release-3 (Optional)"
+	t7.Width = 100
+	t7.ShowSuggestions = true
+	t8 := textinput.New()
+	t8.Placeholder = "Start: DD/MM/YY HH:MM, not before then (Optional)"
+	t8.Width = 100
+	t9 := textinput.New()
+	t9.Placeholder = "Scheduled: DD/MM/YY HH:MM, when you plan to do it (Optional)"
+	t9.Width = 100
+	t10 := textinput.New()
+	t10.Placeholder = "Defer until: DD/MM/YY HH:MM, hidden from the folder till then (Optional)"
+	t10.Width = 100
+	t11 := textinput.New()
+	t11.Placeholder = "Estimate, e.g. 45m or 2h30m (Optional)"
+	t11.Width = 100
+	t13 := textinput.New()
+	t13.Placeholder = "Remind: 30m before, 1d before or DD/MM/YY HH:MM, comma separated (Optional)"
+	t13.Width = 100
+	t6 := textinput.New()
+	t6.Placeholder = "Step"
+	t6.Width = 60
+	t12 := textinput.New()
+	t12.Placeholder = "18/10/26 09:00 1h30m"
+	t12.Width = 60
 	m := model{
 		list:        list.New(nil, delegate, 80, 24),
-		createNewUI: &CreateNewUI{taskDescInput: t2, taskNameInput: ti, taskDueDateInput: t3, taskPriorityInput: t4},
+		checkInput:  t6,
+		timeInput:   t12,
+		createNewUI: &CreateNewUI{taskDescInput: t2, taskNameInput: ti, taskDueDateInput: t3, taskPriorityInput: t4, taskRecurrenceInput: t5, taskTagsInput: t7, taskStartInput: t8, taskScheduledInput: t9, taskDeferInput: t10, taskEstimateInput: t11, taskRemindInput: t13},
 		help:        help.New(),
 		alert:       *bubbleup.NewAlertModel(20, true),
+		settings:    settings,
+		state:       loadWorkspaceState(),
+		vaults:      map[string]*vault{},
 	}
-	m.recreateList(root, m.list.GlobalIndex())
-	m.statusString = "Press P to preview an Item!"
-	m.list.Title = "Task View "
 	m.createNewUI.status = TASK_MESSAGE
-	m.rootFolder = root
+
+	if workspace == "" && !explicitPath && flag.NArg() == 0 && len(settings.Workspaces) > 0 {
+		m.showWorkspaces()
+	} else {
+		store, err := openStore(config_path, storeKind)
+		if err != nil {
+			fmt.Println("Error opening store:", err)
+			os.Exit(1)
+		}
+		if err := unlockTaskFile(config_path); err != nil {
+			fmt.Println("Error unlocking tasks:", err)
+			os.Exit(1)
+		}
+		backups := newBackups(config_path, settings)
+		switch flag.Arg(0) {
+		case "backup":
+			err = runBackupCommand(flag.Args()[1:], store, backups)
+		case "encrypt", "passphrase", "decrypt":
+			err = runCryptCommand(flag.Arg(0), store)
+		case "sync":
+			err = runSync(store, settings)
+		case "log":
+			err = runLogCommand(flag.Args()[1:], store)
+		case "report":
+			err = runReportCommand(flag.Args()[1:], store)
+		case "daemon":
+			err = runDaemonCommand(flag.Args()[1:], store, settings)
+		case "":
+		default:
+			err = fmt.Errorf("unknown command %q (backup, encrypt, passphrase, decrypt, sync, log, report, daemon)", flag.Arg(0))
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if flag.NArg() > 0 {
+			return
+		}
+		root, err := store.Load()
+		var corrupt *CorruptError
+		if js, ok := store.(*JSONStore); ok && errors.As(err, &corrupt) {
+			root, err = offerRecovery(js, backups, corrupt)
+		}
+		if err != nil {
+			fmt.Println("Error loading tasks:", err)
+			os.Exit(1)
+		}
+		if err := purgeExpired(store, root, settings); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		m.attach(workspace, store, root)
+		m.list.Title = "Task View "
+	}
 
 	p := tea.NewProgram(&m)
 
@@ -663,7 +1466,34 @@ func main() {
 		fmt.Println("Error running program:", err)
 		os.Exit(1)
 	}
+	if err := m.detach(); err != nil {
+		fmt.Println("Error saving workspace state:", err)
+	}
+}
 
+// offerRecovery asks on the terminal how to recover a corrupt task file. The
+// file is left untouched unless a recovery succeeds.
+func offerRecovery(store *JSONStore, b *backups, corrupt *CorruptError) (*TaskFolder, error) {
+	fmt.Println(renderWarning(corrupt.Error()))
+	fmt.Println("(j) recover from the journal / (s) recover from the last good snapshot / (b) restore the latest backup / (q) quit without touching it")
+	var choice string
+	fmt.Scanln(&choice)
+	switch strings.ToLower(choice) {
+	case "j":
+		return store.RecoverFromJournal()
+	case "s":
+		return store.RecoverFromSnapshot()
+	case "b":
+		all, err := b.list()
+		if err != nil {
+			return nil, err
+		}
+		if len(all) == 0 {
+			return nil, fmt.Errorf("no backups in %s", b.Dir)
+		}
+		return restoreBackup(store, b, all[0].Path)
+	}
+	return nil, corrupt
 }
 
 func SlicePop[T any](s []T, i int) ([]T, T) {
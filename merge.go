@@ -0,0 +1,389 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	tea "github.com/charmbracelet/bubbletea"
+	"go.dalton.dog/bubbleup"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// trashParent stands in for the parent of trashed items while merging, it
+// can't clash with a UUID.
+const trashParent = "trash"
+
+// mergeNode is one task or folder with its place in the tree, flattened so
+// the three sides of a merge can be compared by ID.
+type mergeNode struct {
+	ID     string
+	Folder bool
+	Parent string
+	Index  int
+	// Fields are the item's own fields as written to the file.
+	Fields map[string]any
+	// Trash is the trash entry's metadata when Parent is trashParent.
+	Trash map[string]any
+}
+
+// mergeConflict is an item both sides changed in different ways. Fields
+// lists what they disagree on, "location" when they moved it apart.
+type mergeConflict struct {
+	ID     string
+	Name   string
+	Fields []string
+	Ours   *mergeNode
+	Theirs *mergeNode
+}
+
+// treeMerge is a three-way merge of two sessions' trees against the tree
+// they both started from. Conflicting items take their side until keepMine
+// says otherwise.
+type treeMerge struct {
+	rootID    string
+	nodes     map[string]*mergeNode
+	conflicts []*mergeConflict
+}
+
+// fieldsMergedQuietly never conflict: status is recomputed and for the
+// timestamps the later one wins.
+var fieldsMergedQuietly = map[string]bool{"status": true, "updated_at": true, "completed_at": true}
+
+func toFields(v any) map[string]any {
+	data, _ := json.Marshal(v)
+	var out map[string]any
+	json.Unmarshal(data, &out)
+	return out
+}
+
+func flattenDoc(root *folderDoc) map[string]*mergeNode {
+	nodes := map[string]*mergeNode{}
+	var walk func(f *folderDoc, parent string, index int, trash map[string]any)
+	walk = func(f *folderDoc, parent string, index int, trash map[string]any) {
+		own := *f
+		own.Folders, own.Tasks, own.Trash = nil, nil, nil
+		nodes[f.ID] = &mergeNode{ID: f.ID, Folder: true, Parent: parent, Index: index, Fields: toFields(own), Trash: trash}
+		for i, child := range f.Folders {
+			walk(child, f.ID, i, nil)
+		}
+		for i, t := range f.Tasks {
+			nodes[t.ID] = &mergeNode{ID: t.ID, Parent: f.ID, Index: i, Fields: toFields(t)}
+		}
+	}
+	walk(root, "", 0, nil)
+	for i, entry := range root.Trash {
+		meta := *entry
+		meta.Task, meta.Folder = nil, nil
+		if entry.Task != nil {
+			nodes[entry.Task.ID] = &mergeNode{ID: entry.Task.ID, Parent: trashParent, Index: i, Fields: toFields(entry.Task), Trash: toFields(meta)}
+		} else if entry.Folder != nil {
+			walk(entry.Folder, trashParent, i, toFields(meta))
+		}
+	}
+	return nodes
+}
+
+// mergeTrees merges ours and theirs, both descended from base. An item
+// removed on one side stays removed unless the other side changed it.
+func mergeTrees(base, ours, theirs *folderDoc) *treeMerge {
+	b, o, t := flattenDoc(base), flattenDoc(ours), flattenDoc(theirs)
+	tm := &treeMerge{rootID: theirs.ID, nodes: map[string]*mergeNode{}}
+	var ids []string
+	seen := map[string]bool{}
+	for _, side := range []map[string]*mergeNode{t, o, b} {
+		for id := range side {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		bn, on, tn := b[id], o[id], t[id]
+		switch {
+		case on == nil && tn == nil:
+		case bn == nil && on != nil:
+			tm.nodes[id] = on
+		case bn == nil:
+			tm.nodes[id] = tn
+		case on == nil:
+			if changed(bn, tn) {
+				tm.nodes[id] = tn
+			}
+		case tn == nil:
+			if changed(bn, on) {
+				tm.nodes[id] = on
+			}
+		default:
+			merged, conflict := mergeNodes(bn, on, tn)
+			tm.nodes[id] = merged
+			if conflict != nil {
+				tm.conflicts = append(tm.conflicts, conflict)
+			}
+		}
+	}
+	return tm
+}
+
+func changed(a, b *mergeNode) bool {
+	return a.Parent != b.Parent || a.Index != b.Index || !reflect.DeepEqual(a.Fields, b.Fields) || !reflect.DeepEqual(a.Trash, b.Trash)
+}
+
+func mergeNodes(b, o, t *mergeNode) (*mergeNode, *mergeConflict) {
+	out := &mergeNode{ID: t.ID, Folder: t.Folder, Fields: map[string]any{}}
+	var conflicting []string
+	keys := map[string]bool{}
+	for _, side := range []*mergeNode{b, o, t} {
+		for k := range side.Fields {
+			keys[k] = true
+		}
+	}
+	for k := range keys {
+		bv, ov, tv := b.Fields[k], o.Fields[k], t.Fields[k]
+		v := tv
+		switch {
+		case k == "events":
+			v = mergeEvents(ov, tv)
+		case reflect.DeepEqual(ov, bv):
+		case reflect.DeepEqual(tv, bv), reflect.DeepEqual(ov, tv):
+			v = ov
+		case fieldsMergedQuietly[k]:
+			v = laterTime(ov, tv)
+		default:
+			conflicting = append(conflicting, k)
+		}
+		if v != nil {
+			out.Fields[k] = v
+		}
+	}
+	// where the item lives is merged as a whole
+	from := t
+	switch {
+	case o.Parent == b.Parent && reflect.DeepEqual(o.Trash, b.Trash):
+		if t.Parent == b.Parent && o.Index != b.Index && t.Index == b.Index {
+			from = o
+		}
+	case t.Parent == b.Parent && reflect.DeepEqual(t.Trash, b.Trash), o.Parent == t.Parent:
+		from = o
+	default:
+		conflicting = append(conflicting, "location")
+	}
+	out.Parent, out.Index, out.Trash = from.Parent, from.Index, from.Trash
+	if len(conflicting) == 0 {
+		return out, nil
+	}
+	sort.Strings(conflicting)
+	name, _ := t.Fields["name"].(string)
+	return out, &mergeConflict{ID: t.ID, Name: name, Fields: conflicting, Ours: o, Theirs: t}
+}
+
+// mergeEvents keeps what either side logged, the logs only ever grow apart
+// from retention trimming their oldest entries.
+func mergeEvents(a, b any) any {
+	var out []any
+	seen := map[string]bool{}
+	for _, side := range []any{a, b} {
+		events, _ := side.([]any)
+		for _, e := range events {
+			data, _ := json.Marshal(e)
+			if !seen[string(data)] {
+				seen[string(data)] = true
+				out = append(out, e)
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	at := func(e any) time.Time {
+		s, _ := e.(map[string]any)["at"].(string)
+		t, _ := time.Parse(time.RFC3339Nano, s)
+		return t
+	}
+	sort.SliceStable(out, func(i, j int) bool { return at(out[i]).Before(at(out[j])) })
+	return out
+}
+
+func laterTime(a, b any) any {
+	as, _ := a.(string)
+	bs, _ := b.(string)
+	at, aerr := time.Parse(time.RFC3339Nano, as)
+	bt, berr := time.Parse(time.RFC3339Nano, bs)
+	if aerr == nil && (berr != nil || at.After(bt)) {
+		return a
+	}
+	return b
+}
+
+// keepMine resolves c in favour of this session.
+func (tm *treeMerge) keepMine(c *mergeConflict) {
+	n := tm.nodes[c.ID]
+	for _, k := range c.Fields {
+		if k == "location" {
+			n.Parent, n.Index, n.Trash = c.Ours.Parent, c.Ours.Index, c.Ours.Trash
+			continue
+		}
+		if v, ok := c.Ours.Fields[k]; ok {
+			n.Fields[k] = v
+		} else {
+			delete(n.Fields, k)
+		}
+	}
+}
+
+// describe shows both sides of each conflicting field of c.
+func (tm *treeMerge) describe(c *mergeConflict) string {
+	var lines []string
+	for _, k := range c.Fields {
+		if k == "location" {
+			lines = append(lines, fmt.Sprintf("moved: mine to %s / theirs to %s", tm.folderName(c.Ours.Parent), tm.folderName(c.Theirs.Parent)))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: mine %v / theirs %v", k, c.Ours.Fields[k], c.Theirs.Fields[k]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (tm *treeMerge) folderName(id string) string {
+	switch id {
+	case trashParent:
+		return "Trash"
+	case tm.rootID:
+		return "Root"
+	}
+	if n := tm.nodes[id]; n != nil {
+		if name, ok := n.Fields["name"].(string); ok {
+			return name
+		}
+	}
+	return "a deleted folder"
+}
+
+// result builds the merged tree, its status is left to rollupStatus. Items whose folder is gone, or that the two
+// sides moved into each other, end up in the root.
+func (tm *treeMerge) result() *folderDoc {
+	for _, n := range tm.nodes {
+		if n.ID == tm.rootID {
+			n.Parent = ""
+			continue
+		}
+		seen := map[string]bool{n.ID: true}
+		for p := n.Parent; p != trashParent; {
+			parent := tm.nodes[p]
+			if parent == nil || !parent.Folder || seen[p] {
+				n.Parent, n.Index, n.Trash = tm.rootID, len(tm.nodes), nil
+				break
+			}
+			if p == tm.rootID {
+				break
+			}
+			seen[p] = true
+			p = parent.Parent
+		}
+	}
+	children := map[string][]*mergeNode{}
+	for _, n := range tm.nodes {
+		if n.ID != tm.rootID {
+			children[n.Parent] = append(children[n.Parent], n)
+		}
+	}
+	for _, list := range children {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Index != list[j].Index {
+				return list[i].Index < list[j].Index
+			}
+			return list[i].ID < list[j].ID
+		})
+	}
+	var build func(n *mergeNode) *folderDoc
+	build = func(n *mergeNode) *folderDoc {
+		var f folderDoc
+		fromFields(n.Fields, &f)
+		for _, child := range children[n.ID] {
+			if child.Folder {
+				f.Folders = append(f.Folders, build(child))
+				continue
+			}
+			var t taskDoc
+			fromFields(child.Fields, &t)
+			f.Tasks = append(f.Tasks, &t)
+		}
+		return &f
+	}
+	root := build(tm.nodes[tm.rootID])
+	for _, n := range children[trashParent] {
+		var entry trashDoc
+		fromFields(n.Trash, &entry)
+		if n.Folder {
+			entry.Folder = build(n)
+		} else {
+			entry.Task = &taskDoc{}
+			fromFields(n.Fields, entry.Task)
+		}
+		root.Trash = append(root.Trash, &entry)
+	}
+	return root
+}
+
+func fromFields(fields map[string]any, v any) {
+	data, _ := json.Marshal(fields)
+	json.Unmarshal(data, v)
+}
+
+// sync merges this session's tree with the one another session saved in the
+// meantime, asking about items both changed.
+func (m *model) sync() tea.Cmd {
+	theirs, err := m.store.Load()
+	if err != nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, "Merge failed: "+err.Error())
+	}
+	merge := mergeTrees(m.synced, toFolderDoc(m.rootFolder), toFolderDoc(theirs))
+	if len(merge.conflicts) == 0 {
+		return tea.Batch(m.finishMerge(merge), m.alert.NewAlertCmd(bubbleup.InfoKey, "Merged changes from another session"))
+	}
+	m.merge, m.conflictAt = merge, 0
+	m.showConflict()
+	return m.alert.NewAlertCmd(bubbleup.WarnKey, fmt.Sprintf("%d items were changed in both sessions", len(merge.conflicts)))
+}
+
+func (m *model) showConflict() {
+	c := m.merge.conflicts[m.conflictAt]
+	m.statusString = fmt.Sprintf("Conflict %d/%d: %q was changed in both sessions\n%s\n(m) keep mine / (t) take theirs",
+		m.conflictAt+1, len(m.merge.conflicts), c.Name, m.merge.describe(c))
+}
+
+// resolveConflict settles the conflict on screen and moves on to the next,
+// saving the merge after the last one.
+func (m *model) resolveConflict(mine bool) tea.Cmd {
+	if mine {
+		m.merge.keepMine(m.merge.conflicts[m.conflictAt])
+	}
+	m.conflictAt++
+	if m.conflictAt < len(m.merge.conflicts) {
+		m.showConflict()
+		return nil
+	}
+	m.statusString = "Merged changes from another session"
+	return m.finishMerge(m.merge)
+}
+
+func (m *model) finishMerge(merge *treeMerge) tea.Cmd {
+	m.merge = nil
+	root := fromFolderDoc(merge.result())
+	reconstructFolderFromJSON(root)
+	m.adopt(root)
+	err := m.store.Save(root)
+	var stale *StaleError
+	if errors.As(err, &stale) {
+		// yet another save landed while merging
+		return m.sync()
+	}
+	if err != nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, "Save failed: "+err.Error())
+	}
+	return m.saved("merge changes from another session")
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// moveTask moves the task with the given ID into the folder with the other.
+func moveTask(root *TaskFolder, id, folderID string) {
+	t, to := findTask(root, id), findFolder(root, folderID)
+	from := t.ParentFolder
+	from.ChildrenTasks = slices.DeleteFunc(from.ChildrenTasks, func(c *Task) bool { return c == t })
+	t.ParentFolder = to
+	to.ChildrenTasks = append(to.ChildrenTasks, t)
+}
+
+func TestMergeTrees(t *testing.T) {
+	unchanged := func(root *TaskFolder) {}
+	tests := []struct {
+		name      string
+		ours      func(root *TaskFolder)
+		theirs    func(root *TaskFolder)
+		conflicts []string
+		keepMine  bool
+		check     func(t *testing.T, root *TaskFolder)
+	}{
+		{
+			name:   "different fields",
+			ours:   func(root *TaskFolder) { findTask(root, "report").Name = "Summary" },
+			theirs: func(root *TaskFolder) { findTask(root, "report").Priority = 1 },
+			check: func(t *testing.T, root *TaskFolder) {
+				if r := findTask(root, "report"); r.Name != "Summary" || r.Priority != 1 {
+					t.Errorf("report = %q priority %d, want Summary priority 1", r.Name, r.Priority)
+				}
+			},
+		},
+		{
+			name:   "same change on both sides",
+			ours:   func(root *TaskFolder) { findTask(root, "report").Name = "Summary" },
+			theirs: func(root *TaskFolder) { findTask(root, "report").Name = "Summary" },
+			check: func(t *testing.T, root *TaskFolder) {
+				if r := findTask(root, "report"); r.Name != "Summary" {
+					t.Errorf("report = %q, want Summary", r.Name)
+				}
+			},
+		},
+		{
+			name:      "same field, theirs kept",
+			ours:      func(root *TaskFolder) { findTask(root, "report").Name = "Mine" },
+			theirs:    func(root *TaskFolder) { findTask(root, "report").Name = "Theirs" },
+			conflicts: []string{"name"},
+			check: func(t *testing.T, root *TaskFolder) {
+				if r := findTask(root, "report"); r.Name != "Theirs" {
+					t.Errorf("report = %q, want Theirs", r.Name)
+				}
+			},
+		},
+		{
+			name:      "same field, mine kept",
+			ours:      func(root *TaskFolder) { findTask(root, "report").Name = "Mine" },
+			theirs:    func(root *TaskFolder) { findTask(root, "report").Name = "Theirs" },
+			conflicts: []string{"name"},
+			keepMine:  true,
+			check: func(t *testing.T, root *TaskFolder) {
+				if r := findTask(root, "report"); r.Name != "Mine" {
+					t.Errorf("report = %q, want Mine", r.Name)
+				}
+			},
+		},
+		{
+			name:   "deleted on one side",
+			ours:   func(root *TaskFolder) { root.ChildrenTasks = nil },
+			theirs: unchanged,
+			check: func(t *testing.T, root *TaskFolder) {
+				if findTask(root, "milk") != nil {
+					t.Error("milk is back")
+				}
+			},
+		},
+		{
+			name:   "deleted on one side, edited on the other",
+			ours:   func(root *TaskFolder) { root.ChildrenTasks = nil },
+			theirs: func(root *TaskFolder) { findTask(root, "milk").Desc = "oat" },
+			check: func(t *testing.T, root *TaskFolder) {
+				if m := findTask(root, "milk"); m == nil || m.Desc != "oat" {
+					t.Errorf("milk = %+v, want it kept with their edit", m)
+				}
+			},
+		},
+		{
+			name: "added on both sides",
+			ours: func(root *TaskFolder) {
+				root.ChildrenTasks = append(root.ChildrenTasks, &Task{ID: "a-mine", Name: "Mine", ParentFolder: root})
+			},
+			theirs: func(root *TaskFolder) {
+				root.ChildrenTasks = append(root.ChildrenTasks, &Task{ID: "b-theirs", Name: "Theirs", ParentFolder: root})
+			},
+			check: func(t *testing.T, root *TaskFolder) {
+				if findTask(root, "a-mine") == nil || findTask(root, "b-theirs") == nil {
+					t.Error("an added task is missing")
+				}
+			},
+		},
+		{
+			name:   "moved on one side, edited on the other",
+			ours:   func(root *TaskFolder) { moveTask(root, "milk", "work") },
+			theirs: func(root *TaskFolder) { findTask(root, "milk").Desc = "oat" },
+			check: func(t *testing.T, root *TaskFolder) {
+				if m := findTask(root, "milk"); m.ParentFolder.ID != "work" || m.Desc != "oat" {
+					t.Errorf("milk in %s with %q, want in work with oat", m.ParentFolder.ID, m.Desc)
+				}
+			},
+		},
+		{
+			name: "moved apart",
+			ours: func(root *TaskFolder) { moveTask(root, "report", "root") },
+			theirs: func(root *TaskFolder) {
+				home := &TaskFolder{ID: "home", Name: "Home", Parent: root}
+				root.ChildrenTaskFolders = append(root.ChildrenTaskFolders, home)
+				moveTask(root, "report", "home")
+			},
+			conflicts: []string{"location"},
+			keepMine:  true,
+			check: func(t *testing.T, root *TaskFolder) {
+				if r := findTask(root, "report"); r.ParentFolder.ID != "root" {
+					t.Errorf("report in %s, want root", r.ParentFolder.ID)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			side := func(edit func(root *TaskFolder)) *folderDoc {
+				root := sampleTree()
+				edit(root)
+				return toFolderDoc(root)
+			}
+			tm := mergeTrees(side(unchanged), side(tt.ours), side(tt.theirs))
+			var got []string
+			for _, c := range tm.conflicts {
+				got = append(got, c.Fields...)
+				if tt.keepMine {
+					tm.keepMine(c)
+				}
+			}
+			if !slices.Equal(got, tt.conflicts) {
+				t.Fatalf("conflicts = %v, want %v", got, tt.conflicts)
+			}
+			root := fromFolderDoc(tm.result())
+			reconstructFolderFromJSON(root)
+			tt.check(t, root)
+		})
+	}
+}
@@ -3,9 +3,11 @@ package main
 import (
 	"fmt"
 	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/progress"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/google/uuid"
 	"slices"
 	"strings"
 	"time"
@@ -21,6 +23,27 @@ type listKeyMap struct {
 	showHelp    key.Binding
 	quit        key.Binding
 	enterFolder key.Binding
+	undo        key.Binding
+	redo        key.Binding
+	cutItem     key.Binding
+	pasteItem   key.Binding
+	showTrash   key.Binding
+	showBackups key.Binding
+	workspaces  key.Binding
+	itemHistory key.Binding
+	itemEvents  key.Binding
+	linkTask    key.Binding
+	forceDone   key.Binding
+	unblocked   key.Binding
+	checklist   key.Binding
+	tags        key.Binding
+	deferred    key.Binding
+	timer       key.Binding
+	timeEntries key.Binding
+	reports     key.Binding
+	snooze      key.Binding
+	cycleState  key.Binding
+	pickState   key.Binding
 }
 type itemKeyMap struct {
 	goUp   key.Binding
@@ -39,24 +62,53 @@ func newListKeyMap() *listKeyMap {
 		deleteItem:  key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "delete item")),
 		showHelp:    key.NewBinding(key.WithKeys("?"), key.WithHelp("?", "toggle help")),
 		quit:        key.NewBinding(key.WithKeys("q", "ctrl+c"), key.WithHelp("q", "quit")),
-		enterFolder: key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "enter folder/toggle task")),
+		enterFolder: key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "enter folder or checklist/toggle task")),
+		undo:        key.NewBinding(key.WithKeys("u"), key.WithHelp("u", "undo")),
+		redo:        key.NewBinding(key.WithKeys("ctrl+r"), key.WithHelp("ctrl+r", "redo")),
+		cutItem:     key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "cut item to move")),
+		pasteItem:   key.NewBinding(key.WithKeys("v"), key.WithHelp("v", "move cut item here")),
+		showTrash:   key.NewBinding(key.WithKeys("t"), key.WithHelp("t", "open trash")),
+		showBackups: key.NewBinding(key.WithKeys("B"), key.WithHelp("B", "restore from backup")),
+		workspaces:  key.NewBinding(key.WithKeys("w"), key.WithHelp("w", "switch workspace")),
+		itemHistory: key.NewBinding(key.WithKeys("L"), key.WithHelp("L", "item history (git mode)")),
+		itemEvents:  key.NewBinding(key.WithKeys("i"), key.WithHelp("i", "item change log")),
+		linkTask:    key.NewBinding(key.WithKeys("D"), key.WithHelp("D", "add/remove dependency")),
+		forceDone:   key.NewBinding(key.WithKeys("F"), key.WithHelp("F", "complete even if blocked")),
+		unblocked:   key.NewBinding(key.WithKeys("U"), key.WithHelp("U", "unblocked tasks")),
+		checklist:   key.NewBinding(key.WithKeys("o"), key.WithHelp("o", "open task checklist")),
+		tags:        key.NewBinding(key.WithKeys("#"), key.WithHelp("#", "browse tags")),
+		deferred:    key.NewBinding(key.WithKeys("z"), key.WithHelp("z", "show/hide deferred tasks")),
+		timer:       key.NewBinding(key.WithKeys("T"), key.WithHelp("T", "start/stop timer")),
+		timeEntries: key.NewBinding(key.WithKeys("E"), key.WithHelp("E", "time entries")),
+		reports:     key.NewBinding(key.WithKeys("R"), key.WithHelp("R", "time reports")),
+		snooze:      key.NewBinding(key.WithKeys("Z"), key.WithHelp("Z", "snooze reminders")),
+		cycleState:  key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "next task state")),
+		pickState:   key.NewBinding(key.WithKeys("S"), key.WithHelp("S", "pick task state")),
 	}
 }
 
 type TaskFolder struct {
-	Name                string `json:"Name,omitempty"`
-	Desc                string `json:"Desc,omitempty"`
+	ID                  string
+	Name                string
+	Desc                string
 	Progress            progress.Model
-	Parent              *TaskFolder   `json:"Parent,omitempty"`
-	ChildrenTasks       []*Task       `json:"children_tasks,omitempty"`
-	ChildrenTaskFolders []*TaskFolder `json:"children_task_folders,omitempty"`
-	Status              Status        `json:"Status"`
+	Parent              *TaskFolder
+	ChildrenTasks       []*Task
+	ChildrenTaskFolders []*TaskFolder
+	Status              Status
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	CompletedAt         time.Time
+	Tags                []string
+	Events              []Event
+	// Trash is only used on the root folder.
+	Trash []*TrashedItem
 }
 
 func (i *TaskFolder) Title() string       { return "📁" + i.Name }
 func (i *TaskFolder) Description() string { return i.Desc }
 func (i *TaskFolder) FilterValue() string {
-	return i.Name
+	return strings.Join(append([]string{i.Name}, i.Tags...), " ")
 }
 func (i *TaskFolder) returnTree() string {
 	s := "Task View \n"
@@ -90,19 +142,49 @@ func (i *TaskFolder) returnPath() string {
 func (t *Task) returnStatusString() string {
 	var s string
 	render_warning := lipgloss.NewStyle().Foreground(lipgloss.Color("#FF593B")).Render
+	state := t.state()
 	if t.Completed {
-		s += "📝 (✓Completed!) " + t.Title() + "\n"
+		title := t.Title()
+		if state.Cancelled {
+			title = lipgloss.NewStyle().Strikethrough(true).Faint(true).Render(title)
+		}
+		s += "📝 (" + state.badge() + ") " + title + "\n"
 		s += ""
 		s += "\t" + t.Description() + "\n"
 	} else {
-		s += "📝 " + t.Title() + "\n"
+		s += "📝 " + t.Title()
+		if state.Name != taskStates[0].Name {
+			s += " " + state.badge()
+		}
+		s += "\n"
 		if !t.DueDate.IsZero() {
 			if t.Overdue {
 				s += render_warning("📅 Overdue! %s\n", t.DueDate.Format("02/01/06 15:04"))
+			} else if t.DueSoon {
+				s += renderNotice("⏰ Due soon! " + t.DueDate.Format("02/01/06 15:04") + "\n")
 			} else {
 				s += "📅" + t.DueDate.Format("02/01/06 15:04") + "\n"
 			}
 		}
+		if plan := t.planLine(time.Now()); plan != "" {
+			s += plan + "\n"
+		}
+		if reminder := t.reminderLine(); reminder != "" {
+			s += reminder + "\n"
+		}
+		if effort := t.effortLine(time.Now()); effort != "" {
+			s += effort + "\n"
+		}
+		if bar := t.checklistBar(); bar != "" {
+			s += bar + "\n"
+		}
+		if t.Recurrence != "" {
+			s += "🔁 " + t.Recurrence
+			if n := len(t.Completions); n > 0 {
+				s += fmt.Sprintf(", done %d×, last %s", n, t.Completions[n-1].Local().Format("02/01/06 15:04"))
+			}
+			s += "\n"
+		}
 		if t.Description() != "" {
 			s += "\t" + t.Description() + "\n"
 		}
@@ -127,17 +209,47 @@ func (i *TaskFolder) update(msg tea.Msg) tea.Cmd {
 func (i *TaskFolder) View() string {
 
 	pad := strings.Repeat(" ", padding)
-	return "" + pad + i.Name + "" + pad + i.Progress.ViewAs(0.12) + "\n"
+	return "" + pad + i.Name + "" + pad + i.Progress.ViewAs(i.Status.percent()) + "\n"
 }
 
 type Task struct {
+	ID           string
 	ParentFolder *TaskFolder
 	Name         string
 	Desc         string
 	Completed    bool
-	DueDate      time.Time
-	Priority     int
-	Overdue      bool
+	// State is the name of the lifecycle state, see Task.state.
+	State   string
+	DueDate time.Time
+	// StartDate is when work can start, ScheduledDate when it is planned
+	// for and DeferUntil when the task shows up in its folder again.
+	StartDate     time.Time
+	ScheduledDate time.Time
+	DeferUntil    time.Time
+	Priority      int
+	Overdue       bool
+	// DueSoon is kept up to date by the due date checks, it isn't saved.
+	DueSoon     bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	CompletedAt time.Time
+	// Recurrence is the repeat rule as entered, see parseRecurrence, and
+	// Completions when each of its instances was completed.
+	Recurrence  string
+	Completions []time.Time
+	// DependsOn are the IDs of the tasks this one waits for, BlockedBy the
+	// names of those still open. BlockedBy is derived, it isn't saved.
+	DependsOn []string
+	BlockedBy []string
+	// Checklist are the task's steps, in order.
+	Checklist []CheckItem
+	Tags      []string
+	// TimeEntries is the time tracked on the task, Estimate how long it was
+	// expected to take.
+	TimeEntries []TimeEntry
+	Estimate    time.Duration
+	Reminders   []Reminder
+	Events      []Event
 }
 
 func (k listKeyMap) ShortHelp() []key.Binding {
@@ -145,8 +257,8 @@ func (k listKeyMap) ShortHelp() []key.Binding {
 }
 func (k listKeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{k.enterFolder, k.goBack, k.newTask, k.editItem},                // first column
-		{k.deleteItem, k.previewItem, k.reloadData, k.showHelp, k.quit}, // second column
+		{k.enterFolder, k.goBack, k.newTask, k.editItem, k.undo, k.redo, k.cycleState, k.pickState, k.timer, k.timeEntries, k.reports, k.checklist, k.linkTask, k.forceDone, k.unblocked, k.tags, k.deferred, k.snooze}, // first column
+		{k.deleteItem, k.showTrash, k.showBackups, k.workspaces, k.itemHistory, k.itemEvents, k.previewItem, k.reloadData, k.cutItem, k.pasteItem, k.showHelp, k.quit},                                                  // second column
 	}
 }
 
@@ -201,35 +313,466 @@ func (k deletionKeyMap) FullHelp() [][]key.Binding {
 	}
 }
 
+type trashKeyMap struct {
+	restore key.Binding
+	purge   key.Binding
+	back    key.Binding
+}
+
+func newTrashKeyMap() trashKeyMap {
+	return trashKeyMap{
+		restore: key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "restore to original folder")),
+		purge:   key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "purge permanently")),
+		back:    key.NewBinding(key.WithKeys("esc", "t"), key.WithHelp("esc/t", "leave trash")),
+	}
+}
+
+func (k trashKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.restore, k.purge, k.back}
+}
+
+func (k trashKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.restore, k.purge, k.back},
+	}
+}
+
+type backupKeyMap struct {
+	restore key.Binding
+	back    key.Binding
+}
+
+func newBackupKeyMap() backupKeyMap {
+	return backupKeyMap{
+		restore: key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "restore this backup")),
+		back:    key.NewBinding(key.WithKeys("esc", "B"), key.WithHelp("esc/B", "leave backups")),
+	}
+}
+
+func (k backupKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.restore, k.back}
+}
+
+func (k backupKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.restore, k.back},
+	}
+}
+
+type workspaceKeyMap struct {
+	open key.Binding
+	back key.Binding
+}
+
+func newWorkspaceKeyMap() workspaceKeyMap {
+	return workspaceKeyMap{
+		open: key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "open workspace")),
+		back: key.NewBinding(key.WithKeys("esc", "w"), key.WithHelp("esc/w", "leave workspaces")),
+	}
+}
+
+func (k workspaceKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.open, k.back}
+}
+
+func (k workspaceKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.open, k.back},
+	}
+}
+
+type historyKeyMap struct {
+	mark    key.Binding
+	diff    key.Binding
+	restore key.Binding
+	back    key.Binding
+}
+
+func newHistoryKeyMap() historyKeyMap {
+	return historyKeyMap{
+		mark:    key.NewBinding(key.WithKeys(" "), key.WithHelp("space", "mark version to diff")),
+		diff:    key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "diff with mark/previous")),
+		restore: key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "restore this version")),
+		back:    key.NewBinding(key.WithKeys("esc", "L"), key.WithHelp("esc/L", "leave history")),
+	}
+}
+
+func (k historyKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.mark, k.diff, k.restore, k.back}
+}
+
+func (k historyKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.mark, k.diff, k.restore, k.back},
+	}
+}
+
+type eventKeyMap struct {
+	back key.Binding
+}
+
+func newEventKeyMap() eventKeyMap {
+	return eventKeyMap{
+		back: key.NewBinding(key.WithKeys("esc", "i"), key.WithHelp("esc/i", "leave change log")),
+	}
+}
+
+func (k eventKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.back}
+}
+
+func (k eventKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.back},
+	}
+}
+
+type unblockedKeyMap struct {
+	open key.Binding
+	back key.Binding
+}
+
+func newUnblockedKeyMap() unblockedKeyMap {
+	return unblockedKeyMap{
+		open: key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "open the task's folder")),
+		back: key.NewBinding(key.WithKeys("esc", "U"), key.WithHelp("esc/U", "leave unblocked tasks")),
+	}
+}
+
+func (k unblockedKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.open, k.back}
+}
+
+func (k unblockedKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.open, k.back},
+	}
+}
+
+type checklistKeyMap struct {
+	check  key.Binding
+	add    key.Binding
+	rename key.Binding
+	remove key.Binding
+	move   key.Binding
+	back   key.Binding
+}
+
+func newChecklistKeyMap() checklistKeyMap {
+	return checklistKeyMap{
+		check:  key.NewBinding(key.WithKeys("enter", " "), key.WithHelp("enter/space", "check/uncheck step")),
+		add:    key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "new step")),
+		rename: key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "rename step")),
+		remove: key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "remove step")),
+		move:   key.NewBinding(key.WithKeys("K", "J"), key.WithHelp("K/J", "move step up/down")),
+		back:   key.NewBinding(key.WithKeys("esc", "o", "b"), key.WithHelp("esc/o/b", "back to the folder")),
+	}
+}
+
+func (k checklistKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.check, k.add, k.back}
+}
+
+func (k checklistKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.check, k.add, k.rename},
+		{k.remove, k.move, k.back},
+	}
+}
+
+type tagKeyMap struct {
+	open key.Binding
+	up   key.Binding
+	back key.Binding
+}
+
+func newTagKeyMap() tagKeyMap {
+	return tagKeyMap{
+		open: key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "list tagged items/open folder")),
+		up:   key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "back to the tags")),
+		back: key.NewBinding(key.WithKeys("#"), key.WithHelp("#", "leave the tags")),
+	}
+}
+
+func (k tagKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.open, k.up, k.back}
+}
+
+func (k tagKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.open, k.up, k.back},
+	}
+}
+
+type timeKeyMap struct {
+	add    key.Binding
+	edit   key.Binding
+	remove key.Binding
+	timer  key.Binding
+	back   key.Binding
+}
+
+func newTimeKeyMap() timeKeyMap {
+	return timeKeyMap{
+		add:    key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "new entry")),
+		edit:   key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "edit entry")),
+		remove: key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "remove entry")),
+		timer:  key.NewBinding(key.WithKeys("T"), key.WithHelp("T", "start/stop timer")),
+		back:   key.NewBinding(key.WithKeys("esc", "E", "b"), key.WithHelp("esc/E/b", "back to the folder")),
+	}
+}
+
+func (k timeKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.add, k.timer, k.back}
+}
+
+func (k timeKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.add, k.edit, k.remove},
+		{k.timer, k.back},
+	}
+}
+
+type reportKeyMap struct {
+	group  key.Binding
+	period key.Binding
+	month  key.Binding
+	export key.Binding
+	back   key.Binding
+}
+
+func newReportKeyMap() reportKeyMap {
+	return reportKeyMap{
+		group:  key.NewBinding(key.WithKeys("g"), key.WithHelp("g", "group differently")),
+		period: key.NewBinding(key.WithKeys("left", "right"), key.WithHelp("←/→", "previous/next period")),
+		month:  key.NewBinding(key.WithKeys("m"), key.WithHelp("m", "week/month")),
+		export: key.NewBinding(key.WithKeys("c", "J"), key.WithHelp("c/J", "export CSV/JSON")),
+		back:   key.NewBinding(key.WithKeys("esc", "R"), key.WithHelp("esc/R", "leave the reports")),
+	}
+}
+
+func (k reportKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.group, k.period, k.export, k.back}
+}
+
+func (k reportKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.group, k.period, k.month},
+		{k.export, k.back},
+	}
+}
+
+type stateKeyMap struct {
+	pick key.Binding
+	back key.Binding
+}
+
+func newStateKeyMap() stateKeyMap {
+	return stateKeyMap{
+		pick: key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "move the task to this state")),
+		back: key.NewBinding(key.WithKeys("esc", "S"), key.WithHelp("esc/S", "leave the state as it is")),
+	}
+}
+
+func (k stateKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.pick, k.back}
+}
+
+func (k stateKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.pick, k.back},
+	}
+}
+
 var keys = newListKeyMap()
 var createKeys = newCreateNewKeyMap()
 var deleteKeys = newDeletionKeyMap()
+var trashKeys = newTrashKeyMap()
+var backupKeys = newBackupKeyMap()
+var workspaceKeys = newWorkspaceKeyMap()
+var historyKeys = newHistoryKeyMap()
+var eventKeys = newEventKeyMap()
+var unblockedKeys = newUnblockedKeyMap()
+var checklistKeys = newChecklistKeyMap()
+var tagKeys = newTagKeyMap()
+var stateKeys = newStateKeyMap()
+var timeKeys = newTimeKeyMap()
+var reportKeys = newReportKeyMap()
 
-func (t *Task) FilterValue() string { return t.Name }
+func (t *Task) FilterValue() string { return strings.Join(append([]string{t.Name}, t.Tags...), " ") }
 func (t *Task) Title() string       { return t.Name }
 func (t *Task) Description() string { return t.Desc }
 func (t *Task) setTimeStatus() {
-	if time.Now().After(t.DueDate) {
-		t.Overdue = true
-		t.ParentFolder.Status.Overdue += 1
-	} else {
-		t.Overdue = false
-	}
+	t.Overdue = !t.DueDate.IsZero() && time.Now().After(t.DueDate)
 }
 func (t *Task) setCompletionStatus(status bool) {
 	if status {
 		t.Completed = true
-		t.ParentFolder.Status.Completed += 1
+		t.CompletedAt = time.Now()
 	} else {
 		t.Completed = false
-		t.ParentFolder.Status.Completed -= 1
+		t.CompletedAt = time.Time{}
+	}
+}
+
+// updateStatus recomputes the counters of f and every folder below it from
+// their tasks, including the tasks of subfolders when subtree is set. It
+// returns the counts over f's whole subtree.
+func updateStatus(f *TaskFolder, subtree bool) Status {
+	var own Status
+	for _, t := range f.ChildrenTasks {
+		state := t.state()
+		if own.States == nil {
+			own.States = map[string]int{}
+		}
+		own.States[state.Name]++
+		own.Spent += t.trackedDone()
+		own.Estimate += t.Estimate
+		if state.Cancelled {
+			continue
+		}
+		own.Total++
+		own.Progress += t.progress()
+		if t.Completed {
+			own.Completed++
+		} else if t.Overdue {
+			own.Overdue++
+		}
+	}
+	all := own
+	for _, child := range f.ChildrenTaskFolders {
+		all.add(updateStatus(child, subtree))
+	}
+	f.Status = own
+	if subtree {
+		f.Status = all
+	}
+	f.setCompletedAt()
+	return all
+}
+
+// rollupStatus recomputes the status of every folder, those in the trash
+// included, counting the way the settings say, and which tasks are blocked.
+func rollupStatus(root *TaskFolder, settings Settings) {
+	subtree := settings.StatusScope != "tasks"
+	updateStatus(root, subtree)
+	for _, t := range root.Trash {
+		if t.Folder != nil {
+			updateStatus(t.Folder, subtree)
+		}
+	}
+	markBlocked(root)
+}
+
+func (i *TaskFolder) setCompletedAt() {
+	if i.Status.Total > 0 && i.Status.Completed >= i.Status.Total {
+		if i.CompletedAt.IsZero() {
+			i.CompletedAt = time.Now()
+		}
+	} else {
+		i.CompletedAt = time.Time{}
+	}
+}
+
+func itemID(item list.Item) string {
+	switch v := item.(type) {
+	case *Task:
+		return v.ID
+	case *TaskFolder:
+		return v.ID
+	case *TrashedItem:
+		return itemID(v.item())
+	}
+	return ""
+}
+
+// newID returns a time ordered UUID (v7) for a new task or folder.
+func newID() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// touch keeps IDs and timestamps up to date for everything a change affected.
+// It runs for every mutation before it is persisted.
+func touch(change Change, now time.Time) {
+	stamp := func(id *string, created, updated *time.Time) {
+		if *id == "" {
+			*id = newID()
+		}
+		if created.IsZero() {
+			*created = now
+		}
+		*updated = now
+	}
+	for _, item := range change.Items {
+		switch v := item.(type) {
+		case *Task:
+			stamp(&v.ID, &v.CreatedAt, &v.UpdatedAt)
+		case *TaskFolder:
+			stamp(&v.ID, &v.CreatedAt, &v.UpdatedAt)
+		}
+	}
+	if change.Kind != ChangeEdit && change.Kind != ChangeToggle && change.Kind != ChangeRecur {
+		// the folder's own contents changed
+		stamp(&change.Folder.ID, &change.Folder.CreatedAt, &change.Folder.UpdatedAt)
+	}
+}
+
+// assignMissingIDs gives every item without an ID one, returning whether
+// anything changed.
+func assignMissingIDs(f *TaskFolder, now time.Time) bool {
+	changed := false
+	if f.ID == "" {
+		f.ID, f.CreatedAt, f.UpdatedAt, changed = newID(), now, now, true
+	}
+	for _, t := range f.ChildrenTasks {
+		if t.ID == "" {
+			t.ID, t.CreatedAt, t.UpdatedAt, changed = newID(), now, now, true
+		}
 	}
+	for _, child := range f.ChildrenTaskFolders {
+		if assignMissingIDs(child, now) {
+			changed = true
+		}
+	}
+	return changed
 }
 
 type Status struct {
-	Completed int `json:"Completed,omitempty"`
-	Total     int `json:"Total,omitempty"`
-	Overdue   int `json:"Overdue,omitempty"`
+	Completed int
+	Total     int
+	Overdue   int
+	// Progress sums how far along each task is, checklists counting partly,
+	// and States counts the tasks in each state. Both are derived and aren't
+	// saved.
+	Progress float64
+	States   map[string]int
+	// Spent is the time tracked on the tasks, Estimate what they were
+	// expected to take. Both are derived and aren't saved.
+	Spent    time.Duration
+	Estimate time.Duration
+}
+
+func (s *Status) add(o Status) {
+	s.Completed += o.Completed
+	s.Total += o.Total
+	s.Overdue += o.Overdue
+	s.Progress += o.Progress
+	s.Spent += o.Spent
+	s.Estimate += o.Estimate
+	for name, n := range o.States {
+		if s.States == nil {
+			s.States = map[string]int{}
+		}
+		s.States[name] += n
+	}
+}
+
+// percent is the completed share of the tasks, 0 for a folder without any.
+func (s Status) percent() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return s.Progress / float64(s.Total)
 }
 
 func (s *Status) print() string {
@@ -241,6 +784,13 @@ func (s *Status) print() string {
 	} else {
 		pp_string += fmt.Sprintf("%d overdue, ", s.Overdue)
 	}
-	pp_string += fmt.Sprintf("%d/%d completed \n", s.Completed, s.Total)
+	pp_string += fmt.Sprintf("%d/%d completed", s.Completed, s.Total)
+	if states := s.printStates(); states != "" {
+		pp_string += " · " + states
+	}
+	if effort := s.printEffort(); effort != "" {
+		pp_string += " · " + effort
+	}
+	pp_string += " \n"
 	return pp_string
 }
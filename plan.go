@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// parseFormDate reads a date field of the form, the zero time when it is
+// empty.
+func parseFormDate(field, value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	d, err := time.Parse("02/01/06 15:04", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s, use DD/MM/YY HH:MM", field)
+	}
+	return d, nil
+}
+
+// planDates reads the start, scheduled and defer until fields of the form.
+func (ui *CreateNewUI) planDates() (start, scheduled, deferUntil time.Time, err error) {
+	if start, err = parseFormDate("start date", ui.taskStartInput.Value()); err != nil {
+		return
+	}
+	if scheduled, err = parseFormDate("scheduled date", ui.taskScheduledInput.Value()); err != nil {
+		return
+	}
+	deferUntil, err = parseFormDate("defer date", ui.taskDeferInput.Value())
+	return
+}
+
+func formDate(d time.Time) string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.Format("02/01/06 15:04")
+}
+
+// deferred is whether t is put off until later, which hides it from its
+// folder.
+func (t *Task) deferred(now time.Time) bool {
+	return !t.Completed && now.Before(t.DeferUntil)
+}
+
+// planLine sums up when an open task starts, is scheduled and is deferred
+// until, empty when none of it is ahead.
+func (t *Task) planLine(now time.Time) string {
+	var parts []string
+	if now.Before(t.StartDate) {
+		parts = append(parts, "🛫 starts "+t.StartDate.Format("02/01/06 15:04"))
+	}
+	if !t.ScheduledDate.IsZero() {
+		parts = append(parts, "🗓 scheduled "+t.ScheduledDate.Format("02/01/06 15:04"))
+	}
+	if t.deferred(now) {
+		parts = append(parts, "💤 deferred until "+t.DeferUntil.Format("02/01/06 15:04"))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// shiftPlan moves the start, scheduled and defer dates of a repeating task
+// along with its due date.
+func (t *Task) shiftPlan(by time.Duration) {
+	for _, d := range []*time.Time{&t.StartDate, &t.ScheduledDate, &t.DeferUntil} {
+		if !d.IsZero() {
+			*d = d.Add(by)
+		}
+	}
+}
+
+// planAlerts names the open tasks whose start, scheduled or defer date
+// passed between last and now.
+func planAlerts(f *TaskFolder, last, now time.Time) []string {
+	passed := func(d time.Time) bool { return d.After(last) && !d.After(now) }
+	var out []string
+	for _, t := range f.ChildrenTasks {
+		switch {
+		case t.Completed:
+		case passed(t.DeferUntil):
+			out = append(out, t.Name+" is back from deferral")
+		case passed(t.ScheduledDate):
+			out = append(out, t.Name+" is scheduled now")
+		case passed(t.StartDate):
+			out = append(out, t.Name+" can be started")
+		}
+	}
+	for _, child := range f.ChildrenTaskFolders {
+		out = append(out, planAlerts(child, last, now)...)
+	}
+	return out
+}
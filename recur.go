@@ -0,0 +1,407 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recurrence is a parsed repeat rule, see parseRecurrence.
+type recurrence struct {
+	// freq is "daily", "weekly", "monthly" or "yearly".
+	freq     string
+	interval int
+	weekdays []time.Weekday
+	// monthDays are days of the month, negative ones count from its end.
+	monthDays []int
+	// afterCompletion counts the interval from when the task was completed
+	// instead of following a fixed schedule.
+	afterCompletion bool
+	// count is the number of occurrences in the series, 0 for no limit.
+	count int
+	until time.Time
+}
+
+var recurrenceUnits = map[string]string{"day": "daily", "week": "weekly", "month": "monthly", "year": "yearly"}
+
+var rruleFreqs = map[string]string{"DAILY": "daily", "WEEKLY": "weekly", "MONTHLY": "monthly", "YEARLY": "yearly"}
+
+var rruleDays = map[string]time.Weekday{"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday}
+
+// parseRecurrence reads either the short form, e.g. "daily", "weekly on
+// mon,thu", "monthly on 1,-1", "every 2 weeks", "every 3 days after
+// completion", or an RFC 5545 RRULE such as "RRULE:FREQ=WEEKLY;BYDAY=MO".
+func parseRecurrence(s string) (*recurrence, error) {
+	s = strings.TrimSpace(s)
+	upper := strings.ToUpper(s)
+	if strings.HasPrefix(upper, "RRULE:") || strings.HasPrefix(upper, "FREQ=") {
+		return parseRRule(strings.TrimPrefix(upper, "RRULE:"))
+	}
+	r := &recurrence{interval: 1}
+	words := strings.Fields(strings.ToLower(s))
+	if n := len(words); n >= 2 && words[n-2] == "after" && words[n-1] == "completion" {
+		r.afterCompletion = true
+		words = words[:n-2]
+	}
+	if len(words) == 0 {
+		return nil, errors.New("empty repeat rule")
+	}
+	switch words[0] {
+	case "daily", "weekly", "monthly", "yearly":
+		r.freq, words = words[0], words[1:]
+	case "weekdays":
+		r.freq, r.weekdays, words = "weekly", []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, words[1:]
+	case "every":
+		words = words[1:]
+		if len(words) > 0 {
+			if n, err := strconv.Atoi(words[0]); err == nil {
+				if n <= 0 {
+					return nil, fmt.Errorf("interval must be positive, got %d", n)
+				}
+				r.interval, words = n, words[1:]
+			}
+		}
+		if len(words) == 0 {
+			return nil, errors.New("expected day(s), week(s), month(s) or year(s) after every")
+		}
+		freq, ok := recurrenceUnits[strings.TrimSuffix(words[0], "s")]
+		if !ok {
+			return nil, fmt.Errorf("unknown unit %q, expected days, weeks, months or years", words[0])
+		}
+		r.freq, words = freq, words[1:]
+	default:
+		return nil, fmt.Errorf("unknown repeat rule %q", s)
+	}
+	if len(words) > 0 {
+		if words[0] != "on" || len(words) == 1 {
+			return nil, fmt.Errorf("unexpected %q, expected on followed by days", strings.Join(words, " "))
+		}
+		if r.afterCompletion {
+			return nil, errors.New("a rule repeating after completion can't be on given days")
+		}
+		if err := r.parseDays(strings.Join(words[1:], ",")); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// parseDays reads the comma or space separated list after "on": weekday
+// names, or days of the month for monthly rules.
+func (r *recurrence) parseDays(list string) error {
+	for _, day := range strings.FieldsFunc(list, func(c rune) bool { return c == ',' || c == ' ' }) {
+		if r.freq == "monthly" {
+			if day == "last" {
+				r.monthDays = append(r.monthDays, -1)
+				continue
+			}
+			n, err := strconv.Atoi(day)
+			if err != nil || n == 0 || n < -31 || n > 31 {
+				return fmt.Errorf("bad day of the month %q, expected 1 to 31, -1 to -31 or last", day)
+			}
+			r.monthDays = append(r.monthDays, n)
+			continue
+		}
+		wd, ok := rruleDays[strings.ToUpper(day[:min(2, len(day))])]
+		if !ok || len(day) < 2 {
+			return fmt.Errorf("bad weekday %q", day)
+		}
+		r.weekdays = append(r.weekdays, wd)
+	}
+	return nil
+}
+
+func parseRRule(rule string) (*recurrence, error) {
+	r := &recurrence{interval: 1}
+	for _, part := range strings.Split(rule, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad RRULE part %q", part)
+		}
+		switch key {
+		case "FREQ":
+			if r.freq, ok = rruleFreqs[value]; !ok {
+				return nil, fmt.Errorf("unsupported FREQ %q, expected DAILY, WEEKLY, MONTHLY or YEARLY", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("bad INTERVAL %q", value)
+			}
+			r.interval = n
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				wd, ok := rruleDays[day]
+				if !ok {
+					return nil, fmt.Errorf("unsupported BYDAY %q, expected MO to SU without a position", day)
+				}
+				r.weekdays = append(r.weekdays, wd)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("bad BYMONTHDAY %q", day)
+				}
+				r.monthDays = append(r.monthDays, n)
+			}
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("bad COUNT %q", value)
+			}
+			r.count = n
+		case "UNTIL":
+			t, err := parseRRuleTime(value)
+			if err != nil {
+				return nil, err
+			}
+			r.until = t
+		case "WKST":
+			if value != "MO" {
+				return nil, errors.New("only WKST=MO is supported")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported RRULE part %s", key)
+		}
+	}
+	if r.freq == "" {
+		return nil, errors.New("RRULE needs a FREQ")
+	}
+	if r.count > 0 && !r.until.IsZero() {
+		return nil, errors.New("RRULE can't have both COUNT and UNTIL")
+	}
+	return r, nil
+}
+
+func parseRRuleTime(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		loc := time.Local
+		if strings.HasSuffix(layout, "Z") {
+			loc = time.UTC
+		}
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			if layout == "20060102" {
+				// the whole day is included
+				t = t.AddDate(0, 0, 1).Add(-time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad UNTIL %q, expected YYYYMMDD or YYYYMMDDThhmmssZ", value)
+}
+
+// dayNumber counts days since the epoch, ignoring the time of day.
+func dayNumber(t time.Time) int {
+	return int(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+// periods is the number of whole days, weeks (starting on Monday), months
+// or years between the periods a and b fall in.
+func (r *recurrence) periods(a, b time.Time) int {
+	switch r.freq {
+	case "weekly":
+		monday := func(t time.Time) int { return dayNumber(t) - (int(t.Weekday())+6)%7 }
+		return (monday(b) - monday(a)) / 7
+	case "monthly":
+		return (b.Year()*12 + int(b.Month())) - (a.Year()*12 + int(a.Month()))
+	case "yearly":
+		return b.Year() - a.Year()
+	}
+	return dayNumber(b) - dayNumber(a)
+}
+
+// matches is whether day belongs to the series that anchor is part of.
+func (r *recurrence) matches(anchor, day time.Time) bool {
+	if r.periods(anchor, day)%r.interval != 0 {
+		return false
+	}
+	if len(r.weekdays) > 0 && !slices.Contains(r.weekdays, day.Weekday()) {
+		return false
+	}
+	if len(r.monthDays) > 0 {
+		last := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+		return slices.ContainsFunc(r.monthDays, func(d int) bool { return d == day.Day() || d < 0 && last+d+1 == day.Day() })
+	}
+	if len(r.weekdays) > 0 {
+		return true
+	}
+	switch r.freq {
+	case "weekly":
+		return day.Weekday() == anchor.Weekday()
+	case "monthly":
+		return day.Day() == anchor.Day()
+	case "yearly":
+		return day.Month() == anchor.Month() && day.Day() == anchor.Day()
+	}
+	return true
+}
+
+// after is the first occurrence following from, keeping the time of day of
+// anchor. It is zero when there is none within the scanned range.
+func (r *recurrence) after(anchor, from time.Time) time.Time {
+	// long enough for a yearly rule on the 29th of February
+	limit := 366 * 8 * r.interval
+	for i := 1; i <= limit; i++ {
+		day := time.Date(from.Year(), from.Month(), from.Day()+i, anchor.Hour(), anchor.Minute(), 0, 0, anchor.Location())
+		if r.matches(anchor, day) {
+			return day
+		}
+	}
+	return time.Time{}
+}
+
+// next is the due date following due for an instance completed at done,
+// which is also the anchor when there is no due date. done is how many
+// instances were completed so far, this one included. It is zero once the
+// series is over.
+func (r *recurrence) next(due, completed time.Time, done int) time.Time {
+	if r.count > 0 && done >= r.count {
+		return time.Time{}
+	}
+	var next time.Time
+	if r.afterCompletion {
+		base := completed
+		if !due.IsZero() {
+			base = time.Date(base.Year(), base.Month(), base.Day(), due.Hour(), due.Minute(), 0, 0, due.Location())
+		}
+		switch r.freq {
+		case "weekly":
+			next = base.AddDate(0, 0, 7*r.interval)
+		case "monthly":
+			next = base.AddDate(0, r.interval, 0)
+		case "yearly":
+			next = base.AddDate(r.interval, 0, 0)
+		default:
+			next = base.AddDate(0, 0, r.interval)
+		}
+	} else {
+		anchor := due
+		if anchor.IsZero() {
+			anchor = completed
+		}
+		next = r.after(anchor, anchor)
+		// instances missed while the task was overdue are skipped rather than
+		// coming due all at once
+		for !next.IsZero() && !next.After(completed) {
+			next = r.after(anchor, next)
+		}
+	}
+	if !r.until.IsZero() && next.After(r.until) {
+		return time.Time{}
+	}
+	return next
+}
+
+// upcoming previews the next n due dates of a task due at due that had done
+// instances completed, as if each were completed on time.
+func (r *recurrence) upcoming(due time.Time, done, n int) []time.Time {
+	if due.IsZero() {
+		due = time.Now()
+	}
+	var out []time.Time
+	for len(out) < n {
+		next := r.next(due, due, done+1)
+		if next.IsZero() {
+			break
+		}
+		out = append(out, next)
+		due, done = next, done+1
+	}
+	return out
+}
+
+// recurrencePreview describes the dates rule would produce for the create
+// and edit form, or what is wrong with it.
+func recurrencePreview(rule string, due time.Time, done int) string {
+	r, err := parseRecurrence(rule)
+	if err != nil {
+		return renderWarning("🔁 " + err.Error())
+	}
+	var dates []string
+	for _, t := range r.upcoming(due, done, 3) {
+		dates = append(dates, t.Format("Mon 02/01/06 15:04"))
+	}
+	if len(dates) == 0 {
+		return "🔁 The series ends with this occurrence"
+	}
+	if r.afterCompletion {
+		return "🔁 If completed on time, next due " + strings.Join(dates, ", ")
+	}
+	return "🔁 Next due " + strings.Join(dates, ", ")
+}
+
+// recurCommand marks one instance of a repeating task done: the completion
+// is kept in its history and the due date moves on to the next occurrence,
+// or the task is completed for good once the series is over.
+type recurCommand struct {
+	ID   string    `json:"id"`
+	Name string    `json:"name"`
+	At   time.Time `json:"at"`
+	Due  time.Time `json:"due"`
+	Next time.Time `json:"next"`
+}
+
+// newRecurCommand completes t at now, nil when t doesn't repeat.
+func newRecurCommand(t *Task, now time.Time) (*recurCommand, error) {
+	if t.Recurrence == "" || t.Completed {
+		return nil, nil
+	}
+	r, err := parseRecurrence(t.Recurrence)
+	if err != nil {
+		return nil, fmt.Errorf("bad repeat rule of %s: %w", t.Name, err)
+	}
+	return &recurCommand{ID: t.ID, Name: t.Name, At: now, Due: t.DueDate, Next: r.next(t.DueDate, now, len(t.Completions)+1)}, nil
+}
+
+func (c *recurCommand) apply(root *TaskFolder) (Change, error) {
+	t := findTask(root, c.ID)
+	if t == nil {
+		return Change{}, fmt.Errorf("task %s no longer exists", c.ID)
+	}
+	t.Completions = append(t.Completions, c.At)
+	if c.Next.IsZero() {
+		t.setCompletionStatus(true)
+	} else {
+		if !c.Due.IsZero() {
+			t.shiftPlan(c.Next.Sub(c.Due))
+		}
+		t.DueDate = c.Next
+		t.setTimeStatus()
+	}
+	return Change{Kind: ChangeRecur, Folder: t.ParentFolder, Items: []list.Item{t}}, nil
+}
+
+func (c *recurCommand) revert(root *TaskFolder) (Change, error) {
+	t := findTask(root, c.ID)
+	if t == nil {
+		return Change{}, fmt.Errorf("task %s no longer exists", c.ID)
+	}
+	if n := len(t.Completions); n > 0 {
+		t.Completions = t.Completions[:n-1]
+	}
+	t.setCompletionStatus(false)
+	if !c.Next.IsZero() && !c.Due.IsZero() {
+		t.shiftPlan(c.Due.Sub(c.Next))
+	}
+	t.DueDate = c.Due
+	t.setTimeStatus()
+	return Change{Kind: ChangeToggle, Folder: t.ParentFolder, Items: []list.Item{t}}, nil
+}
+
+func (c *recurCommand) String() string { return fmt.Sprintf("complete %q", c.Name) }
+
+// recurrencePreview previews the repeat rule being entered in the form,
+// empty when there is none.
+func (ui *CreateNewUI) recurrencePreview() string {
+	rule := strings.TrimSpace(ui.taskRecurrenceInput.Value())
+	if rule == "" || ui.shouldCreateTaskFolder {
+		return ""
+	}
+	due, _ := time.Parse("02/01/06 15:04", ui.taskDueDateInput.Value())
+	return recurrencePreview(rule, due, ui.completions)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	tests := []struct {
+		rule    string
+		want    *recurrence
+		wantErr bool
+	}{
+		{rule: "daily", want: &recurrence{freq: "daily", interval: 1}},
+		{rule: "weekly on mon,thu", want: &recurrence{freq: "weekly", interval: 1, weekdays: []time.Weekday{time.Monday, time.Thursday}}},
+		{rule: "weekdays", want: &recurrence{freq: "weekly", interval: 1, weekdays: weekdays}},
+		{rule: "monthly on 1,last", want: &recurrence{freq: "monthly", interval: 1, monthDays: []int{1, -1}}},
+		{rule: "every 2 weeks", want: &recurrence{freq: "weekly", interval: 2}},
+		{rule: "Every 3 days after completion", want: &recurrence{freq: "daily", interval: 3, afterCompletion: true}},
+		{rule: "RRULE:FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=15,-1;COUNT=4", want: &recurrence{freq: "monthly", interval: 2, monthDays: []int{15, -1}, count: 4}},
+		{rule: "freq=weekly;byday=mo,we;wkst=mo", want: &recurrence{freq: "weekly", interval: 1, weekdays: []time.Weekday{time.Monday, time.Wednesday}}},
+		{rule: "RRULE:FREQ=DAILY;UNTIL=20261031", want: &recurrence{freq: "daily", interval: 1, until: time.Date(2026, 10, 31, 23, 59, 59, 0, time.Local)}},
+		{rule: "", wantErr: true},
+		{rule: "fortnightly", wantErr: true},
+		{rule: "every 0 days", wantErr: true},
+		{rule: "every 2", wantErr: true},
+		{rule: "weekly on", wantErr: true},
+		{rule: "weekly on xx", wantErr: true},
+		{rule: "monthly on 32", wantErr: true},
+		{rule: "every 3 days on mon after completion", wantErr: true},
+		{rule: "RRULE:FREQ=HOURLY", wantErr: true},
+		{rule: "RRULE:INTERVAL=2", wantErr: true},
+		{rule: "RRULE:FREQ=WEEKLY;BYDAY=1MO", wantErr: true},
+		{rule: "RRULE:FREQ=DAILY;COUNT=2;UNTIL=20261031", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			got, err := parseRecurrence(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRecurrence(%q) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRecurrence(%q) = %+v, want %+v", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	at := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.Local)
+	}
+	tests := []struct {
+		name           string
+		rule           string
+		due, completed time.Time
+		done           int
+		want           time.Time
+	}{
+		{name: "daily on time", rule: "daily", due: at(2026, 10, 20, 9), completed: at(2026, 10, 20, 10), done: 1, want: at(2026, 10, 21, 9)},
+		{name: "daily overdue skips missed days", rule: "daily", due: at(2026, 10, 20, 9), completed: at(2026, 10, 23, 8), done: 1, want: at(2026, 10, 23, 9)},
+		{name: "no due date", rule: "daily", completed: at(2026, 10, 20, 10), done: 1, want: at(2026, 10, 21, 10)},
+		{name: "weekdays", rule: "weekly on mon,thu", due: at(2026, 10, 19, 9), completed: at(2026, 10, 19, 9), done: 1, want: at(2026, 10, 22, 9)},
+		{name: "every other week", rule: "every 2 weeks", due: at(2026, 10, 19, 9), completed: at(2026, 10, 19, 9), done: 1, want: at(2026, 11, 2, 9)},
+		{name: "last day of the month", rule: "monthly on -1", due: at(2026, 10, 31, 9), completed: at(2026, 10, 31, 9), done: 1, want: at(2026, 11, 30, 9)},
+		{name: "monthly skips short months", rule: "monthly", due: at(2027, 1, 31, 9), completed: at(2027, 1, 31, 9), done: 1, want: at(2027, 3, 31, 9)},
+		{name: "leap day", rule: "yearly", due: at(2028, 2, 29, 9), completed: at(2028, 2, 29, 9), done: 1, want: at(2032, 2, 29, 9)},
+		{name: "after completion", rule: "every 3 days after completion", due: at(2026, 10, 20, 9), completed: at(2026, 10, 25, 17), done: 1, want: at(2026, 10, 28, 9)},
+		{name: "count reached", rule: "RRULE:FREQ=DAILY;COUNT=2", due: at(2026, 10, 20, 9), completed: at(2026, 10, 20, 9), done: 2},
+		{name: "count not reached", rule: "RRULE:FREQ=DAILY;COUNT=2", due: at(2026, 10, 20, 9), completed: at(2026, 10, 20, 9), done: 1, want: at(2026, 10, 21, 9)},
+		{name: "past until", rule: "RRULE:FREQ=WEEKLY;BYDAY=MO,FR;UNTIL=20261025", due: at(2026, 10, 23, 9), completed: at(2026, 10, 23, 9), done: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parseRecurrence(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.next(tt.due, tt.completed, tt.done); !got.Equal(tt.want) {
+				t.Errorf("next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"go.dalton.dog/bubbleup"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reminder goes off at a time of its own, At, or Before the task is due.
+type Reminder struct {
+	ID     string
+	At     time.Time
+	Before time.Duration
+	// Snoozed puts the reminder off until then, Fired is when it last went
+	// off.
+	Snoozed time.Time
+	Fired   time.Time
+}
+
+// when is when r goes off for t, zero for an offset on a task without a due
+// date. A snooze only counts while it is later than the reminder itself, so
+// moving the due date on brings the reminder back.
+func (r *Reminder) when(t *Task) time.Time {
+	base := r.At
+	if base.IsZero() {
+		if t.DueDate.IsZero() {
+			return time.Time{}
+		}
+		base = t.DueDate.Add(-r.Before)
+	}
+	if r.Snoozed.After(base) {
+		return r.Snoozed
+	}
+	return base
+}
+
+// pending is whether r has yet to go off for t.
+func (r *Reminder) pending(t *Task) bool {
+	w := r.when(t)
+	return !w.IsZero() && r.Fired.Before(w)
+}
+
+// spec is the reminder as typed in the form, e.g. "30m before" or
+// "18/10/26 09:00".
+func (r *Reminder) spec() string {
+	if !r.At.IsZero() {
+		return r.At.Format("02/01/06 15:04")
+	}
+	if r.Before%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd before", r.Before/(24*time.Hour))
+	}
+	return formEstimate(r.Before) + " before"
+}
+
+// parseOffset reads how long before the due date, a Go duration such as
+// 1h30m or a number of days such as 2d.
+func parseOffset(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid offset %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid offset %q", s)
+	}
+	return d, nil
+}
+
+// parseReminders reads the reminders field of the form, comma separated.
+// Reminders that were already there keep when they went off and their
+// snooze.
+func parseReminders(s string, due time.Time, old []Reminder) ([]Reminder, error) {
+	var out []Reminder
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var r Reminder
+		if offset, ok := strings.CutSuffix(part, " before"); ok {
+			d, err := parseOffset(strings.TrimSpace(offset))
+			if err != nil {
+				return nil, err
+			}
+			if due.IsZero() {
+				return nil, fmt.Errorf("%q needs a due date", part)
+			}
+			r.Before = d
+		} else {
+			at, err := time.Parse("02/01/06 15:04", part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid reminder %q, use 30m before, 1d before or DD/MM/YY HH:MM", part)
+			}
+			r.At = at
+		}
+		if i := slices.IndexFunc(old, func(o Reminder) bool { return o.At.Equal(r.At) && o.Before == r.Before }); i >= 0 {
+			r = old[i]
+		} else {
+			r.ID = newID()
+		}
+		if !slices.ContainsFunc(out, func(o Reminder) bool { return o.ID == r.ID }) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func formReminders(rs []Reminder) string {
+	var parts []string
+	for i := range rs {
+		parts = append(parts, rs[i].spec())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// reminderLine is when the next reminder of t goes off, empty when none
+// will.
+func (t *Task) reminderLine() string {
+	var next time.Time
+	for i := range t.Reminders {
+		r := &t.Reminders[i]
+		if w := r.when(t); r.pending(t) && (next.IsZero() || w.Before(next)) {
+			next = w
+		}
+	}
+	if next.IsZero() {
+		return ""
+	}
+	return "🔔 " + next.Format("02/01/06 15:04")
+}
+
+// dueReminder is a reminder that went off for its task.
+type dueReminder struct {
+	Task     *Task
+	Reminder *Reminder
+	At       time.Time
+}
+
+// dueReminders are the reminders of open tasks that are due by now and
+// haven't gone off, oldest first.
+func dueReminders(root *TaskFolder, now time.Time) []dueReminder {
+	var out []dueReminder
+	for _, t := range indexTasks(root) {
+		if t.Completed {
+			continue
+		}
+		for i := range t.Reminders {
+			r := &t.Reminders[i]
+			if w := r.when(t); r.pending(t) && !w.After(now) {
+				out = append(out, dueReminder{Task: t, Reminder: r, At: w})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].At.Before(out[j].At) })
+	return out
+}
+
+// summary says what a reminder is about, e.g. "due 18/10/26 15:00 in
+// Root > Work".
+func (d dueReminder) summary() string {
+	s := "in " + namePath(d.Task.ParentFolder)
+	if !d.Task.DueDate.IsZero() {
+		s = "due " + d.Task.DueDate.Format("02/01/06 15:04") + " " + s
+	}
+	return s
+}
+
+// reminderRef points at a reminder that went off, for snoozing it.
+type reminderRef struct {
+	TaskID     string
+	ReminderID string
+}
+
+// keepReminderState gives the reminders in next that are also in current
+// when those went off and their snooze. Going off and snoozing aren't edits,
+// so undoing or redoing an edit mustn't bring a reminder back.
+func keepReminderState(current, next []Reminder) []Reminder {
+	for i := range next {
+		if j := slices.IndexFunc(current, func(r Reminder) bool { return r.ID == next[i].ID }); j >= 0 {
+			next[i].Snoozed, next[i].Fired = current[j].Snoozed, current[j].Fired
+		}
+	}
+	return next
+}
+
+// reminderChange saves tasks whose reminders went off or were snoozed in one
+// go, under the folder holding all of them.
+func reminderChange(tasks []*Task) Change {
+	change := Change{Kind: ChangeEdit, Folder: tasks[0].ParentFolder}
+	for _, t := range tasks {
+		if !slices.Contains(change.Items, list.Item(t)) {
+			change.Items = append(change.Items, t)
+			change.Folder = commonAncestor(change.Folder, t.ParentFolder)
+		}
+	}
+	return change
+}
+
+// fireReminders alerts about the reminders due by now and marks them as gone
+// off. Going off isn't an edit of the task, so it can't be undone.
+func (m *model) fireReminders(now time.Time) tea.Cmd {
+	if m.rootFolder == nil {
+		return nil
+	}
+	due := dueReminders(m.rootFolder, now)
+	if len(due) == 0 {
+		return nil
+	}
+	m.snoozable = nil
+	var tasks []*Task
+	var names []string
+	for _, d := range due {
+		d.Reminder.Fired = now
+		m.snoozable = append(m.snoozable, reminderRef{TaskID: d.Task.ID, ReminderID: d.Reminder.ID})
+		tasks = append(tasks, d.Task)
+		if !slices.Contains(names, d.Task.Name) {
+			names = append(names, d.Task.Name)
+		}
+	}
+	message := fmt.Sprintf("🔔 %s (%s)", due[0].Task.Name, due[0].summary())
+	if len(names) > 1 {
+		message = fmt.Sprintf("🔔 %d reminders: %s", len(due), strings.Join(names, ", "))
+	}
+	m.statusString = fmt.Sprintf("%s\nZ snoozes for %d minutes", message, m.settings.SnoozeMinutes)
+	return tea.Batch(m.save(reminderChange(tasks)), m.alert.NewAlertCmd(bubbleup.WarnKey, message+", Z snoozes"))
+}
+
+// snoozeReminders puts off the reminders that went off last for the
+// snooze_minutes setting.
+func (m *model) snoozeReminders() tea.Cmd {
+	if len(m.snoozable) == 0 {
+		return m.alert.NewAlertCmd(bubbleup.InfoKey, "No reminder to snooze")
+	}
+	until := time.Now().Add(time.Duration(m.settings.SnoozeMinutes) * time.Minute)
+	var tasks []*Task
+	for _, ref := range m.snoozable {
+		t := findTask(m.rootFolder, ref.TaskID)
+		if t == nil {
+			continue
+		}
+		for i := range t.Reminders {
+			if t.Reminders[i].ID == ref.ReminderID {
+				t.Reminders[i].Snoozed = until
+				tasks = append(tasks, t)
+			}
+		}
+	}
+	m.snoozable = nil
+	if len(tasks) == 0 {
+		return m.alert.NewAlertCmd(bubbleup.InfoKey, "No reminder to snooze")
+	}
+	m.statusString = "Snoozed until " + until.Format("15:04")
+	if m.listShowsFolder() {
+		m.recreateList(m.currentFolder, m.list.Index())
+	}
+	return m.save(reminderChange(tasks))
+}
+
+// reminderNote is what the notifier command reads on its standard input.
+type reminderNote struct {
+	ID       string     `json:"id"`
+	Name     string     `json:"name"`
+	Desc     string     `json:"desc,omitempty"`
+	Path     string     `json:"path"`
+	DueDate  *time.Time `json:"due_date,omitempty"`
+	RemindAt time.Time  `json:"remind_at"`
+	Priority int        `json:"priority,omitempty"`
+	Tags     []string   `json:"tags,omitempty"`
+}
+
+// notify runs the notifier command with the task's name and summary as its
+// last two arguments and the details as JSON on its standard input. Without
+// a notifier the reminder is printed.
+func notify(command []string, d dueReminder) error {
+	title := "ToDoIt: " + d.Task.Name
+	if len(command) == 0 {
+		fmt.Printf("%s  %s, %s\n", d.At.Local().Format("2006-01-02 15:04"), title, d.summary())
+		return nil
+	}
+	note := reminderNote{
+		ID:       d.Task.ID,
+		Name:     d.Task.Name,
+		Desc:     d.Task.Desc,
+		Path:     namePath(d.Task.ParentFolder),
+		DueDate:  docTime(d.Task.DueDate),
+		RemindAt: d.At,
+		Priority: d.Task.Priority,
+		Tags:     d.Task.Tags,
+	}
+	data, err := json.Marshal(note)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(command[0], append(slices.Clone(command[1:]), title, d.summary())...)
+	cmd.Stdin = bytes.NewReader(data)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", command[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// loadChanged is root again unless something else wrote to the store since
+// it was loaded or saved, or there is no root yet.
+func loadChanged(store Store, root *TaskFolder) (*TaskFolder, error) {
+	if root != nil {
+		if changed, err := store.Changed(); err != nil || !changed {
+			return root, err
+		}
+	}
+	return store.Load()
+}
+
+// notifyDue saves the reminders due by now as gone off, all in one change,
+// and only then hands them to the notifier, so a failed save doesn't notify
+// twice and a failing notifier doesn't repeat. root is the tree the last
+// check returned, loaded again when the store changed since. A save that
+// lost to another session's is tried once more on the reloaded tree.
+func notifyDue(store Store, settings Settings, root *TaskFolder, now time.Time) (*TaskFolder, error) {
+	var due []dueReminder
+	for retried := false; ; retried = true {
+		var err error
+		if root, err = loadChanged(store, root); err != nil {
+			return nil, err
+		}
+		due = dueReminders(root, now)
+		if len(due) == 0 {
+			return root, nil
+		}
+		var tasks []*Task
+		for _, d := range due {
+			d.Reminder.Fired = now
+			tasks = append(tasks, d.Task)
+		}
+		err = store.SaveChange(root, reminderChange(tasks))
+		var stale *StaleError
+		if errors.As(err, &stale) && !retried {
+			root = nil
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	var errs []error
+	for _, d := range due {
+		if err := notify(settings.Notifier, d); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return root, errors.Join(errs...)
+}
+
+func runDaemonCommand(args []string, store Store, settings Settings) error {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	every := fs.Duration("every", 30*time.Second, "how often to check the reminders")
+	once := fs.Bool("once", false, "check once and exit, e.g. from cron")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 || *every <= 0 {
+		return errors.New("usage: todoit daemon [-every 30s] [-once]")
+	}
+	var root *TaskFolder
+	for {
+		var err error
+		if root, err = notifyDue(store, settings, root, time.Now()); err != nil {
+			if *once {
+				return err
+			}
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		if *once {
+			return nil
+		}
+		time.Sleep(*every)
+	}
+}
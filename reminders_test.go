@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseReminders(t *testing.T) {
+	due := time.Date(2026, 10, 20, 15, 0, 0, 0, time.UTC)
+	fired := time.Date(2026, 10, 20, 14, 30, 0, 0, time.UTC)
+	old := []Reminder{{ID: "r1", Before: 30 * time.Minute, Fired: fired}}
+	tests := []struct {
+		name    string
+		input   string
+		due     time.Time
+		old     []Reminder
+		want    string
+		wantErr bool
+	}{
+		{name: "empty", input: " ", due: due, want: ""},
+		{name: "offset", input: "30m before", due: due, want: "30m before"},
+		{name: "days and a time", input: "1d before, 18/10/26 09:00", due: due, want: "1d before, 18/10/26 09:00"},
+		{name: "hours and minutes", input: "1h30m before", due: due, want: "1h30m before"},
+		{name: "kept and duplicated", input: "30m before, 30m before", due: due, old: old, want: "30m before"},
+		{name: "offset without a due date", input: "30m before", wantErr: true},
+		{name: "time without a due date", input: "18/10/26 09:00", want: "18/10/26 09:00"},
+		{name: "negative offset", input: "-5m before", due: due, wantErr: true},
+		{name: "bad offset", input: "2x before", due: due, wantErr: true},
+		{name: "bad time", input: "tomorrow", due: due, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseReminders(tt.input, tt.due, tt.old)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseReminders(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if spec := formReminders(got); spec != tt.want {
+				t.Errorf("parseReminders(%q) = %q, want %q", tt.input, spec, tt.want)
+			}
+			for _, r := range got {
+				switch {
+				case r.ID == "":
+					t.Errorf("reminder %q has no ID", r.spec())
+				case len(tt.old) > 0 && r.Before == tt.old[0].Before && r != tt.old[0]:
+					t.Errorf("reminder %q = %+v, want the old one kept, %+v", r.spec(), r, tt.old[0])
+				}
+			}
+		})
+	}
+}
+
+func TestReminderWhen(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2026, 10, 20, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		name     string
+		due      time.Time
+		reminder Reminder
+		want     time.Time
+		pending  bool
+	}{
+		{name: "before the due date", due: at(15, 0), reminder: Reminder{Before: 30 * time.Minute}, want: at(14, 30), pending: true},
+		{name: "offset without a due date", reminder: Reminder{Before: 30 * time.Minute}},
+		{name: "at a time", reminder: Reminder{At: at(9, 0)}, want: at(9, 0), pending: true},
+		{name: "gone off", due: at(15, 0), reminder: Reminder{Before: 30 * time.Minute, Fired: at(14, 30)}, want: at(14, 30)},
+		{name: "due date moved on", due: at(16, 0), reminder: Reminder{Before: 30 * time.Minute, Fired: at(14, 30)}, want: at(15, 30), pending: true},
+		{name: "snoozed", due: at(15, 0), reminder: Reminder{Before: 30 * time.Minute, Fired: at(14, 30), Snoozed: at(14, 40)}, want: at(14, 40), pending: true},
+		{name: "snooze over", due: at(15, 0), reminder: Reminder{Before: 30 * time.Minute, Fired: at(14, 40), Snoozed: at(14, 40)}, want: at(14, 40)},
+		{name: "snooze before a later due date", due: at(17, 0), reminder: Reminder{Before: 30 * time.Minute, Fired: at(14, 40), Snoozed: at(14, 40)}, want: at(16, 30), pending: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := &Task{Name: "task", DueDate: tt.due}
+			if got := tt.reminder.when(task); !got.Equal(tt.want) {
+				t.Errorf("when() = %v, want %v", got, tt.want)
+			}
+			if got := tt.reminder.pending(task); got != tt.pending {
+				t.Errorf("pending() = %v, want %v", got, tt.pending)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"go.dalton.dog/bubbleup"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportDimensions are what tracked time can be grouped by.
+var reportDimensions = []string{"folder", "tag", "day", "week"}
+
+// reportGroupings are the groupings g cycles through on the reports screen.
+var reportGroupings = [][]string{{"folder"}, {"tag"}, {"day"}, {"week"}, {"folder", "day"}, {"tag", "week"}}
+
+// untagged is the tag time on tasks without tags is reported under.
+const untagged = "(untagged)"
+
+// reportRow is the time tracked for one combination of the grouping's keys.
+type reportRow struct {
+	Keys    []string
+	Spent   time.Duration
+	Entries int
+}
+
+// report is the time tracked between From and To, To excluded, grouped By
+// the dimensions in order.
+type report struct {
+	By       []string
+	From, To time.Time
+	Rows     []reportRow
+	// Total counts every entry once, even when a task's tags put its time in
+	// several rows.
+	Total   time.Duration
+	Entries int
+}
+
+// parseReportBy reads a comma separated list of dimensions.
+func parseReportBy(s string) ([]string, error) {
+	var by []string
+	for _, d := range strings.Split(s, ",") {
+		d = strings.TrimSpace(d)
+		if !slices.Contains(reportDimensions, d) {
+			return nil, fmt.Errorf("can't group by %q, use %s", d, strings.Join(reportDimensions, ", "))
+		}
+		if !slices.Contains(by, d) {
+			by = append(by, d)
+		}
+	}
+	return by, nil
+}
+
+// entryKeys are the values of dimension d for an entry of t starting at start.
+func entryKeys(d string, t *Task, start time.Time) []string {
+	switch d {
+	case "folder":
+		return []string{namePath(t.ParentFolder)}
+	case "tag":
+		if len(t.Tags) == 0 {
+			return []string{untagged}
+		}
+		return t.Tags
+	case "day":
+		return []string{start.Local().Format("2006-01-02")}
+	}
+	year, week := start.Local().ISOWeek()
+	return []string{fmt.Sprintf("%d-W%02d", year, week)}
+}
+
+// buildReport adds up the time entries starting between from and to, a
+// running one counting up to now. Rows are sorted by their keys.
+func buildReport(root *TaskFolder, by []string, from, to, now time.Time) report {
+	r := report{By: by, From: from, To: to}
+	rows := map[string]*reportRow{}
+	for _, t := range indexTasks(root) {
+		for i := range t.TimeEntries {
+			e := &t.TimeEntries[i]
+			if e.Start.Before(from) || !e.Start.Before(to) {
+				continue
+			}
+			spent := e.duration(now)
+			r.Total += spent
+			r.Entries++
+			combos := [][]string{nil}
+			for _, d := range by {
+				var next [][]string
+				for _, combo := range combos {
+					for _, k := range entryKeys(d, t, e.Start) {
+						next = append(next, append(slices.Clone(combo), k))
+					}
+				}
+				combos = next
+			}
+			for _, keys := range combos {
+				id := strings.Join(keys, "\x00")
+				row, ok := rows[id]
+				if !ok {
+					row = &reportRow{Keys: keys}
+					rows[id] = row
+				}
+				row.Spent += spent
+				row.Entries++
+			}
+		}
+	}
+	for _, row := range rows {
+		r.Rows = append(r.Rows, *row)
+	}
+	sort.Slice(r.Rows, func(i, j int) bool { return slices.Compare(r.Rows[i].Keys, r.Rows[j].Keys) < 0 })
+	return r
+}
+
+// weekStart is midnight on the Monday of the week of t.
+func weekStart(t time.Time) time.Time {
+	t = t.Local()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// lastDay is the last day the report covers, To being the midnight after it.
+func (r report) lastDay() time.Time { return r.To.AddDate(0, 0, -1) }
+
+func (r report) headers() []string {
+	var out []string
+	for _, d := range r.By {
+		out = append(out, strings.ToUpper(d[:1])+d[1:])
+	}
+	return append(out, "Time", "Entries")
+}
+
+// table renders the report for the terminal, with a total row.
+func (r report) table() string {
+	t := table.New().
+		Border(lipgloss.NormalBorder()).
+		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("240"))).
+		Headers(r.headers()...).
+		StyleFunc(func(row, col int) lipgloss.Style {
+			style := lipgloss.NewStyle().Padding(0, 1)
+			if row == table.HeaderRow || row == len(r.Rows) {
+				style = style.Bold(true)
+			}
+			if col >= len(r.By) {
+				style = style.Align(lipgloss.Right)
+			}
+			return style
+		})
+	for _, row := range r.Rows {
+		t.Row(append(slices.Clone(row.Keys), formatDuration(row.Spent), strconv.Itoa(row.Entries))...)
+	}
+	total := make([]string, len(r.By))
+	total[0] = "Total"
+	t.Row(append(total, formatDuration(r.Total), strconv.Itoa(r.Entries))...)
+	return t.String()
+}
+
+func (r report) title() string {
+	return fmt.Sprintf("Tracked time by %s, %s to %s", strings.Join(r.By, " and "), r.From.Format("02/01/06"), r.lastDay().Format("02/01/06"))
+}
+
+// writeCSV writes a row per group, its time in minutes and in hours for
+// billing, and no total.
+func (r report) writeCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write(append(slices.Clone(r.By), "minutes", "hours", "entries"))
+	for _, row := range r.Rows {
+		minutes := int(row.Spent.Round(time.Minute) / time.Minute)
+		out.Write(append(slices.Clone(row.Keys), strconv.Itoa(minutes), strconv.FormatFloat(float64(minutes)/60, 'f', 2, 64), strconv.Itoa(row.Entries)))
+	}
+	out.Flush()
+	return out.Error()
+}
+
+type reportDoc struct {
+	From         string           `json:"from"`
+	To           string           `json:"to"`
+	By           []string         `json:"by"`
+	Rows         []map[string]any `json:"rows"`
+	TotalMinutes int              `json:"total_minutes"`
+	Entries      int              `json:"entries"`
+}
+
+// writeJSON writes the report as one document, each row keyed by the
+// dimensions it is grouped by.
+func (r report) writeJSON(w io.Writer) error {
+	doc := reportDoc{
+		From:         r.From.Format("2006-01-02"),
+		To:           r.lastDay().Format("2006-01-02"),
+		By:           r.By,
+		Rows:         []map[string]any{},
+		TotalMinutes: int(r.Total.Round(time.Minute) / time.Minute),
+		Entries:      r.Entries,
+	}
+	for _, row := range r.Rows {
+		fields := map[string]any{"minutes": int(row.Spent.Round(time.Minute) / time.Minute), "entries": row.Entries}
+		for i, d := range r.By {
+			fields[d] = row.Keys[i]
+		}
+		doc.Rows = append(doc.Rows, fields)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// write writes the report in format, table, csv or json.
+func (r report) write(w io.Writer, format string) error {
+	switch format {
+	case "table":
+		_, err := fmt.Fprintln(w, r.title()+"\n"+r.table())
+		return err
+	case "csv":
+		return r.writeCSV(w)
+	case "json":
+		return r.writeJSON(w)
+	}
+	return fmt.Errorf("unknown format %q, use table, csv or json", format)
+}
+
+func runReportCommand(args []string, store Store) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	by := fs.String("by", "folder", "what to group by, comma separated: "+strings.Join(reportDimensions, ", "))
+	from := fs.String("from", "", "first day, YYYY-MM-DD, the Monday of this week by default")
+	to := fs.String("to", "", "last day, YYYY-MM-DD, six days after -from by default")
+	format := fs.String("format", "table", "table, csv or json")
+	out := fs.String("o", "", "file to write to instead of the standard output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("usage: todoit report [-by folder,day] [-from YYYY-MM-DD] [-to YYYY-MM-DD] [-format table|csv|json] [-o file]")
+	}
+	dims, err := parseReportBy(*by)
+	if err != nil {
+		return err
+	}
+	start := weekStart(time.Now())
+	if *from != "" {
+		if start, err = time.ParseInLocation("2006-01-02", *from, time.Local); err != nil {
+			return fmt.Errorf("bad -from %q, expected YYYY-MM-DD", *from)
+		}
+	}
+	end := start.AddDate(0, 0, 7)
+	if *to != "" {
+		last, err := time.ParseInLocation("2006-01-02", *to, time.Local)
+		if err != nil {
+			return fmt.Errorf("bad -to %q, expected YYYY-MM-DD", *to)
+		}
+		end = last.AddDate(0, 0, 1)
+	}
+	if !end.After(start) {
+		return errors.New("-to is before -from")
+	}
+	root, err := store.Load()
+	if err != nil {
+		return err
+	}
+	r := buildReport(root, dims, start, end, time.Now())
+	if *out == "" {
+		return r.write(os.Stdout, *format)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := r.write(f, *format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// showReports opens the reports screen on this week's time by folder.
+func (m *model) showReports() tea.Cmd {
+	m.reportMode, m.reportGrouping, m.reportMonth = true, 0, false
+	m.reportFrom = weekStart(time.Now())
+	m.refreshReport()
+	return nil
+}
+
+// refreshReport builds the report of the screen again, after its settings
+// or the tasks changed.
+func (m *model) refreshReport() {
+	to := m.reportFrom.AddDate(0, 0, 7)
+	if m.reportMonth {
+		to = m.reportFrom.AddDate(0, 1, 0)
+	}
+	m.report = buildReport(m.rootFolder, reportGroupings[m.reportGrouping], m.reportFrom, to, time.Now())
+	m.statusString = m.report.title() + "\n\ng regroups, ←/→ moves a period,\nm switches week/month, c/J export\nCSV/JSON, esc leaves"
+}
+
+// exportReport writes the report on screen next to the task file.
+func (m *model) exportReport(format string) tea.Cmd {
+	path := fmt.Sprintf("%s.report-%s.%s", config_path, m.report.From.Format("2006-01-02"), format)
+	f, err := os.Create(path)
+	if err == nil {
+		err = m.report.write(f, format)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, "Export failed: "+err.Error())
+	}
+	return m.alert.NewAlertCmd(bubbleup.InfoKey, "Exported to "+path)
+}
+
+// updateReports handles a key on the reports screen. Every key is taken, the
+// list isn't on screen to get the others.
+func (m *model) updateReports(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "g":
+		m.reportGrouping = (m.reportGrouping + 1) % len(reportGroupings)
+	case "left":
+		if m.reportMonth {
+			m.reportFrom = m.reportFrom.AddDate(0, -1, 0)
+		} else {
+			m.reportFrom = m.reportFrom.AddDate(0, 0, -7)
+		}
+	case "right":
+		if m.reportMonth {
+			m.reportFrom = m.reportFrom.AddDate(0, 1, 0)
+		} else {
+			m.reportFrom = m.reportFrom.AddDate(0, 0, 7)
+		}
+	case "m":
+		m.reportMonth = !m.reportMonth
+		if m.reportMonth {
+			m.reportFrom = time.Date(m.reportFrom.Year(), m.reportFrom.Month(), 1, 0, 0, 0, 0, time.Local)
+		} else {
+			m.reportFrom = weekStart(m.reportFrom)
+		}
+	case "c":
+		return m.exportReport("csv")
+	case "J":
+		return m.exportReport("json")
+	case "esc", "R":
+		m.reportMode = false
+		m.statusString = "Left the reports"
+		m.recreateList(m.currentFolder, 0)
+		return nil
+	case "ctrl+c", "q":
+		return tea.Quit
+	default:
+		return nil
+	}
+	m.refreshReport()
+	return nil
+}
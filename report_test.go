@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildReport(t *testing.T) {
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 10, day, hour, minute, 0, 0, time.Local) }
+	root := &TaskFolder{ID: "root", Name: "Root"}
+	work := &TaskFolder{ID: "work", Name: "Work", Parent: root}
+	root.ChildrenTaskFolders = []*TaskFolder{work}
+	work.ChildrenTasks = []*Task{{ID: "a", Name: "A", ParentFolder: work, Tags: []string{"billing", "dev"}, TimeEntries: []TimeEntry{
+		{ID: "e1", Start: at(19, 10, 0), End: at(19, 11, 0)},
+		{ID: "e2", Start: at(20, 9, 0), End: at(20, 9, 30)},
+		{ID: "e3", Start: at(26, 9, 0), End: at(26, 10, 0)},
+	}}}
+	root.ChildrenTasks = []*Task{{ID: "b", Name: "B", ParentFolder: root, TimeEntries: []TimeEntry{
+		{ID: "e4", Start: at(19, 14, 0), End: at(19, 14, 15)},
+		{ID: "e5", Start: at(21, 10, 0)},
+	}}}
+	row := func(spent time.Duration, entries int, keys ...string) reportRow {
+		return reportRow{Keys: keys, Spent: spent, Entries: entries}
+	}
+	tests := []struct {
+		by   []string
+		want []reportRow
+	}{
+		{by: []string{"tag"}, want: []reportRow{
+			row(time.Hour, 2, untagged),
+			row(90*time.Minute, 2, "billing"),
+			row(90*time.Minute, 2, "dev"),
+		}},
+		{by: []string{"folder"}, want: []reportRow{
+			row(time.Hour, 2, "Root"),
+			row(90*time.Minute, 2, "Root > Work"),
+		}},
+		{by: []string{"day"}, want: []reportRow{
+			row(75*time.Minute, 2, "2026-10-19"),
+			row(30*time.Minute, 1, "2026-10-20"),
+			row(45*time.Minute, 1, "2026-10-21"),
+		}},
+		{by: []string{"tag", "week"}, want: []reportRow{
+			row(time.Hour, 2, untagged, "2026-W43"),
+			row(90*time.Minute, 2, "billing", "2026-W43"),
+			row(90*time.Minute, 2, "dev", "2026-W43"),
+		}},
+		{by: []string{"folder", "day"}, want: []reportRow{
+			row(15*time.Minute, 1, "Root", "2026-10-19"),
+			row(45*time.Minute, 1, "Root", "2026-10-21"),
+			row(time.Hour, 1, "Root > Work", "2026-10-19"),
+			row(30*time.Minute, 1, "Root > Work", "2026-10-20"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.by, "+"), func(t *testing.T) {
+			r := buildReport(root, tt.by, at(19, 0, 0), at(26, 0, 0), at(21, 10, 45))
+			if !reflect.DeepEqual(r.Rows, tt.want) {
+				t.Errorf("rows = %v, want %v", r.Rows, tt.want)
+			}
+			// tagged time shows under each tag but counts once
+			if r.Total != 150*time.Minute || r.Entries != 4 {
+				t.Errorf("total = %s in %d entries, want 2h30m in 4", r.Total, r.Entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// currentSchemaVersion is the version written by this build, see FORMAT.md.
+const currentSchemaVersion = 13
+
+// fileDoc and the types below are the on-disk format. They are kept apart
+// from TaskFolder/Task so the UI types can change without touching the file.
+type fileDoc struct {
+	SchemaVersion int `json:"schema_version"`
+	// Revision goes up by one with every save, so a session can tell that
+	// someone else saved since it last read the file.
+	Revision int64      `json:"revision"`
+	Root     *folderDoc `json:"root"`
+}
+
+type folderDoc struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Desc        string       `json:"desc,omitempty"`
+	Status      statusDoc    `json:"status"`
+	CreatedAt   *time.Time   `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time   `json:"updated_at,omitempty"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
+	Tags        []string     `json:"tags,omitempty"`
+	Events      []*eventDoc  `json:"events,omitempty"`
+	Folders     []*folderDoc `json:"folders,omitempty"`
+	Tasks       []*taskDoc   `json:"tasks,omitempty"`
+	// Trash is only written on the root.
+	Trash []*trashDoc `json:"trash,omitempty"`
+}
+
+type statusDoc struct {
+	Completed int `json:"completed"`
+	Total     int `json:"total"`
+	Overdue   int `json:"overdue"`
+}
+
+type taskDoc struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Desc        string         `json:"desc,omitempty"`
+	Completed   bool           `json:"completed,omitempty"`
+	State       string         `json:"state,omitempty"`
+	DueDate     *time.Time     `json:"due_date,omitempty"`
+	StartDate   *time.Time     `json:"start_date,omitempty"`
+	Scheduled   *time.Time     `json:"scheduled_date,omitempty"`
+	DeferUntil  *time.Time     `json:"defer_until,omitempty"`
+	Priority    int            `json:"priority,omitempty"`
+	Overdue     bool           `json:"overdue,omitempty"`
+	CreatedAt   *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time     `json:"updated_at,omitempty"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+	Recurrence  string         `json:"recurrence,omitempty"`
+	Completions []time.Time    `json:"completions,omitempty"`
+	DependsOn   []string       `json:"depends_on,omitempty"`
+	Checklist   []*checkDoc    `json:"checklist,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	TimeEntries []*timeDoc     `json:"time_entries,omitempty"`
+	Estimate    int            `json:"estimate_minutes,omitempty"`
+	Reminders   []*reminderDoc `json:"reminders,omitempty"`
+	Events      []*eventDoc    `json:"events,omitempty"`
+}
+
+type reminderDoc struct {
+	ID      string     `json:"id"`
+	At      *time.Time `json:"at,omitempty"`
+	Before  int        `json:"before_minutes,omitempty"`
+	Snoozed *time.Time `json:"snoozed_until,omitempty"`
+	Fired   *time.Time `json:"fired_at,omitempty"`
+}
+
+type timeDoc struct {
+	ID    string     `json:"id"`
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+type checkDoc struct {
+	ID     string     `json:"id"`
+	Name   string     `json:"name"`
+	Done   bool       `json:"done,omitempty"`
+	DoneAt *time.Time `json:"done_at,omitempty"`
+}
+
+type eventDoc struct {
+	At    time.Time `json:"at"`
+	Actor string    `json:"actor,omitempty"`
+	Field string    `json:"field"`
+	Old   string    `json:"old,omitempty"`
+	New   string    `json:"new,omitempty"`
+}
+
+type trashDoc struct {
+	ParentID   string     `json:"parent_id"`
+	ParentPath string     `json:"parent_path"`
+	Index      int        `json:"index"`
+	DeletedAt  time.Time  `json:"deleted_at"`
+	Task       *taskDoc   `json:"task,omitempty"`
+	Folder     *folderDoc `json:"folder,omitempty"`
+}
+
+// docTime maps the zero time to an omitted field.
+func docTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func fromDocTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+func newFileDoc(root *TaskFolder, revision int64) *fileDoc {
+	return &fileDoc{SchemaVersion: currentSchemaVersion, Revision: revision, Root: toFolderDoc(root)}
+}
+
+func toFolderDoc(f *TaskFolder) *folderDoc {
+	d := &folderDoc{
+		ID:          f.ID,
+		Name:        f.Name,
+		Desc:        f.Desc,
+		Status:      statusDoc{Completed: f.Status.Completed, Total: f.Status.Total, Overdue: f.Status.Overdue},
+		CreatedAt:   docTime(f.CreatedAt),
+		UpdatedAt:   docTime(f.UpdatedAt),
+		CompletedAt: docTime(f.CompletedAt),
+		Tags:        f.Tags,
+		Events:      toEventDocs(f.Events),
+	}
+	for _, child := range f.ChildrenTaskFolders {
+		d.Folders = append(d.Folders, toFolderDoc(child))
+	}
+	for _, t := range f.ChildrenTasks {
+		d.Tasks = append(d.Tasks, toTaskDoc(t))
+	}
+	for _, t := range f.Trash {
+		d.Trash = append(d.Trash, toTrashDoc(t))
+	}
+	return d
+}
+
+func toTrashDoc(t *TrashedItem) *trashDoc {
+	d := &trashDoc{ParentID: t.ParentID, ParentPath: t.ParentPath, Index: t.Index, DeletedAt: t.DeletedAt}
+	switch v := t.item().(type) {
+	case *Task:
+		d.Task = toTaskDoc(v)
+	case *TaskFolder:
+		d.Folder = toFolderDoc(v)
+	}
+	return d
+}
+
+func toTaskDoc(t *Task) *taskDoc {
+	return &taskDoc{
+		ID:          t.ID,
+		Name:        t.Name,
+		Desc:        t.Desc,
+		Completed:   t.Completed,
+		State:       t.State,
+		DueDate:     docTime(t.DueDate),
+		StartDate:   docTime(t.StartDate),
+		Scheduled:   docTime(t.ScheduledDate),
+		DeferUntil:  docTime(t.DeferUntil),
+		Priority:    t.Priority,
+		Overdue:     t.Overdue,
+		CreatedAt:   docTime(t.CreatedAt),
+		UpdatedAt:   docTime(t.UpdatedAt),
+		CompletedAt: docTime(t.CompletedAt),
+		Recurrence:  t.Recurrence,
+		Completions: t.Completions,
+		DependsOn:   t.DependsOn,
+		Checklist:   toCheckDocs(t.Checklist),
+		Tags:        t.Tags,
+		TimeEntries: toTimeDocs(t.TimeEntries),
+		Estimate:    int(t.Estimate / time.Minute),
+		Reminders:   toReminderDocs(t.Reminders),
+		Events:      toEventDocs(t.Events),
+	}
+}
+
+func toCheckDocs(steps []CheckItem) []*checkDoc {
+	var out []*checkDoc
+	for _, c := range steps {
+		out = append(out, &checkDoc{ID: c.ID, Name: c.Name, Done: c.Done, DoneAt: docTime(c.DoneAt)})
+	}
+	return out
+}
+
+func toEventDocs(events []Event) []*eventDoc {
+	var out []*eventDoc
+	for _, e := range events {
+		out = append(out, &eventDoc{At: e.At, Actor: e.Actor, Field: e.Field, Old: e.Old, New: e.New})
+	}
+	return out
+}
+
+// fromFolderDoc builds the UI tree, without parent links or progress bars,
+// reconstructFolderFromJSON fills those in.
+func fromFolderDoc(d *folderDoc) *TaskFolder {
+	f := &TaskFolder{
+		ID:          d.ID,
+		Name:        d.Name,
+		Desc:        d.Desc,
+		Status:      Status{Completed: d.Status.Completed, Total: d.Status.Total, Overdue: d.Status.Overdue},
+		CreatedAt:   fromDocTime(d.CreatedAt),
+		UpdatedAt:   fromDocTime(d.UpdatedAt),
+		CompletedAt: fromDocTime(d.CompletedAt),
+		Tags:        d.Tags,
+		Events:      fromEventDocs(d.Events),
+	}
+	for _, child := range d.Folders {
+		f.ChildrenTaskFolders = append(f.ChildrenTaskFolders, fromFolderDoc(child))
+	}
+	for _, t := range d.Tasks {
+		f.ChildrenTasks = append(f.ChildrenTasks, fromTaskDoc(t))
+	}
+	for _, t := range d.Trash {
+		f.Trash = append(f.Trash, fromTrashDoc(t))
+	}
+	return f
+}
+
+func fromTrashDoc(d *trashDoc) *TrashedItem {
+	t := &TrashedItem{ParentID: d.ParentID, ParentPath: d.ParentPath, Index: d.Index, DeletedAt: d.DeletedAt}
+	switch item := itemFromDocs(d.Task, d.Folder).(type) {
+	case *Task:
+		t.Task = item
+	case *TaskFolder:
+		t.Folder = item
+	}
+	return t
+}
+
+func fromTaskDoc(d *taskDoc) *Task {
+	return &Task{
+		ID:            d.ID,
+		Name:          d.Name,
+		Desc:          d.Desc,
+		Completed:     d.Completed,
+		State:         d.State,
+		DueDate:       fromDocTime(d.DueDate),
+		StartDate:     fromDocTime(d.StartDate),
+		ScheduledDate: fromDocTime(d.Scheduled),
+		DeferUntil:    fromDocTime(d.DeferUntil),
+		Priority:      d.Priority,
+		Overdue:       d.Overdue,
+		CreatedAt:     fromDocTime(d.CreatedAt),
+		UpdatedAt:     fromDocTime(d.UpdatedAt),
+		CompletedAt:   fromDocTime(d.CompletedAt),
+		Recurrence:    d.Recurrence,
+		Completions:   d.Completions,
+		DependsOn:     d.DependsOn,
+		Checklist:     fromCheckDocs(d.Checklist),
+		Tags:          d.Tags,
+		TimeEntries:   fromTimeDocs(d.TimeEntries),
+		Estimate:      time.Duration(d.Estimate) * time.Minute,
+		Reminders:     fromReminderDocs(d.Reminders),
+		Events:        fromEventDocs(d.Events),
+	}
+}
+
+func fromCheckDocs(docs []*checkDoc) []CheckItem {
+	var out []CheckItem
+	for _, d := range docs {
+		out = append(out, CheckItem{ID: d.ID, Name: d.Name, Done: d.Done, DoneAt: fromDocTime(d.DoneAt)})
+	}
+	return out
+}
+
+func toTimeDocs(entries []TimeEntry) []*timeDoc {
+	var out []*timeDoc
+	for _, e := range entries {
+		out = append(out, &timeDoc{ID: e.ID, Start: e.Start, End: docTime(e.End)})
+	}
+	return out
+}
+
+func toReminderDocs(reminders []Reminder) []*reminderDoc {
+	var out []*reminderDoc
+	for _, r := range reminders {
+		out = append(out, &reminderDoc{ID: r.ID, At: docTime(r.At), Before: int(r.Before / time.Minute), Snoozed: docTime(r.Snoozed), Fired: docTime(r.Fired)})
+	}
+	return out
+}
+
+func fromReminderDocs(docs []*reminderDoc) []Reminder {
+	var out []Reminder
+	for _, d := range docs {
+		out = append(out, Reminder{ID: d.ID, At: fromDocTime(d.At), Before: time.Duration(d.Before) * time.Minute, Snoozed: fromDocTime(d.Snoozed), Fired: fromDocTime(d.Fired)})
+	}
+	return out
+}
+
+func fromTimeDocs(docs []*timeDoc) []TimeEntry {
+	var out []TimeEntry
+	for _, d := range docs {
+		out = append(out, TimeEntry{ID: d.ID, Start: d.Start, End: fromDocTime(d.End)})
+	}
+	return out
+}
+
+func fromEventDocs(docs []*eventDoc) []Event {
+	var out []Event
+	for _, d := range docs {
+		out = append(out, Event{At: d.At, Actor: d.Actor, Field: d.Field, Old: d.Old, New: d.New})
+	}
+	return out
+}
+
+// migrations[i] upgrades a raw document from version i to i+1.
+var migrations = []func(doc map[string]any) (map[string]any, error){
+	migrateV0ToV1,
+	migrateV1ToV2,
+	migrateV2ToV3,
+	migrateV3ToV4,
+	migrateV4ToV5,
+	migrateV5ToV6,
+	migrateV6ToV7,
+	migrateV7ToV8,
+	migrateV8ToV9,
+	migrateV9ToV10,
+	migrateV10ToV11,
+	migrateV11ToV12,
+	migrateV12ToV13,
+}
+
+// decodeDocument migrates data to the current version and decodes it. It
+// also returns the version data was written in.
+func decodeDocument(data []byte) (*TaskFolder, int, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, 0, err
+	}
+	version := 0
+	if v, ok := raw["schema_version"].(float64); ok {
+		version = int(v)
+	}
+	if version > currentSchemaVersion {
+		return nil, version, fmt.Errorf("schema version %d is newer than this build supports (%d)", version, currentSchemaVersion)
+	}
+	for v := version; v < currentSchemaVersion; v++ {
+		var err error
+		if raw, err = migrations[v](raw); err != nil {
+			return nil, version, fmt.Errorf("error migrating from schema version %d: %w", v, err)
+		}
+		raw["schema_version"] = v + 1
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, version, err
+	}
+	var doc fileDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, version, err
+	}
+	if doc.Root == nil {
+		doc.Root = &folderDoc{}
+	}
+	return fromFolderDoc(doc.Root), version, nil
+}
+
+// decodeFolder decodes a folder written on its own (e.g. in the journal) at
+// the given schema version.
+func decodeFolder(data json.RawMessage, version int) (*TaskFolder, error) {
+	if version > 0 {
+		data = json.RawMessage(fmt.Sprintf(`{"schema_version":%d,"root":%s}`, version, data))
+	}
+	// version 0 folders are whole version 0 documents already
+	root, _, err := decodeDocument(data)
+	return root, err
+}
+
+// migrateV0ToV1 converts the original format, which was TaskFolder marshalled
+// as-is, into the first versioned document.
+func migrateV0ToV1(doc map[string]any) (map[string]any, error) {
+	return map[string]any{"root": migrateV0Folder(doc)}, nil
+}
+
+func migrateV0Folder(f map[string]any) map[string]any {
+	out := map[string]any{
+		"name": f["Name"],
+		"desc": f["Desc"],
+	}
+	if st, ok := f["Status"].(map[string]any); ok {
+		out["status"] = map[string]any{
+			"completed": st["Completed"],
+			"total":     st["Total"],
+			"overdue":   st["Overdue"],
+		}
+	}
+	var folders []any
+	if children, ok := f["children_task_folders"].([]any); ok {
+		for _, child := range children {
+			if c, ok := child.(map[string]any); ok {
+				folders = append(folders, migrateV0Folder(c))
+			}
+		}
+	}
+	out["folders"] = folders
+	var tasks []any
+	if children, ok := f["children_tasks"].([]any); ok {
+		for _, child := range children {
+			t, ok := child.(map[string]any)
+			if !ok {
+				continue
+			}
+			task := map[string]any{
+				"name":      t["Name"],
+				"desc":      t["Desc"],
+				"completed": t["Completed"],
+				"priority":  t["Priority"],
+				"overdue":   t["Overdue"],
+			}
+			if due, ok := t["DueDate"].(string); ok && due != "" && due != (time.Time{}).Format(time.RFC3339) {
+				task["due_date"] = due
+			}
+			tasks = append(tasks, task)
+		}
+	}
+	out["tasks"] = tasks
+	return out
+}
+
+// migrateV1ToV2 gives every folder and task an ID, with the migration time as
+// its creation time since the real one was never recorded.
+func migrateV1ToV2(doc map[string]any) (map[string]any, error) {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	var walk func(f map[string]any)
+	stamp := func(item map[string]any) {
+		if id, _ := item["id"].(string); id == "" {
+			item["id"] = newID()
+		}
+		if _, ok := item["created_at"]; !ok {
+			item["created_at"] = now
+		}
+		if _, ok := item["updated_at"]; !ok {
+			item["updated_at"] = now
+		}
+	}
+	walk = func(f map[string]any) {
+		stamp(f)
+		if tasks, ok := f["tasks"].([]any); ok {
+			for _, t := range tasks {
+				if task, ok := t.(map[string]any); ok {
+					stamp(task)
+				}
+			}
+		}
+		if folders, ok := f["folders"].([]any); ok {
+			for _, c := range folders {
+				if child, ok := c.(map[string]any); ok {
+					walk(child)
+				}
+			}
+		}
+	}
+	root, ok := doc["root"].(map[string]any)
+	if !ok {
+		root = map[string]any{}
+		doc["root"] = root
+	}
+	walk(root)
+	return doc, nil
+}
+
+// migrateV2ToV3 only bumps the version: version 3 adds the root's trash, which
+// older builds would silently drop on their next save.
+func migrateV2ToV3(doc map[string]any) (map[string]any, error) {
+	return doc, nil
+}
+
+// migrateV3ToV4 starts the revision counter. Older builds don't bump it, so
+// they must not write version 4 files.
+func migrateV3ToV4(doc map[string]any) (map[string]any, error) {
+	doc["revision"] = 0
+	return doc, nil
+}
+
+// migrateV4ToV5 only bumps the version: version 5 adds the items' event logs,
+// which older builds would silently drop on their next save.
+func migrateV4ToV5(doc map[string]any) (map[string]any, error) {
+	return doc, nil
+}
+
+// migrateV5ToV6 only bumps the version: version 6 adds repeat rules and
+// their completion history, which older builds would silently drop.
+func migrateV5ToV6(doc map[string]any) (map[string]any, error) {
+	return doc, nil
+}
+
+// migrateV6ToV7 only bumps the version: version 7 adds dependencies between
+// tasks, which older builds would silently drop.
+func migrateV6ToV7(doc map[string]any) (map[string]any, error) {
+	return doc, nil
+}
+
+// migrateV7ToV8 only bumps the version: version 8 adds the tasks'
+// checklists, which older builds would silently drop.
+func migrateV7ToV8(doc map[string]any) (map[string]any, error) {
+	return doc, nil
+}
+
+// migrateV8ToV9 only bumps the version: version 9 adds tags to tasks and
+// folders, which older builds would silently drop.
+func migrateV8ToV9(doc map[string]any) (map[string]any, error) {
+	return doc, nil
+}
+
+// migrateV9ToV10 only bumps the version: version 10 adds the lifecycle state
+// of tasks, which older builds would silently drop. Tasks without one are in
+// the first state, or done when completed.
+func migrateV9ToV10(doc map[string]any) (map[string]any, error) {
+	return doc, nil
+}
+
+// migrateV10ToV11 only bumps the version: version 11 adds start, scheduled
+// and defer until dates to tasks, which older builds would silently drop.
+func migrateV10ToV11(doc map[string]any) (map[string]any, error) {
+	return doc, nil
+}
+
+// migrateV11ToV12 only bumps the version: version 12 adds time entries and
+// estimates to tasks, which older builds would silently drop.
+func migrateV11ToV12(doc map[string]any) (map[string]any, error) {
+	return doc, nil
+}
+
+// migrateV12ToV13 only bumps the version: version 13 adds reminders to
+// tasks, which older builds would silently drop.
+func migrateV12ToV13(doc map[string]any) (map[string]any, error) {
+	return doc, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrations(t *testing.T) {
+	if len(migrations) != currentSchemaVersion {
+		t.Fatalf("%d migrations for schema version %d", len(migrations), currentSchemaVersion)
+	}
+	tests := []struct {
+		name    string
+		data    string
+		version int
+		wantErr string
+	}{
+		{
+			name: "unversioned UI structs",
+			data: `{"Name":"Root","Desc":"","Status":{"Completed":1,"Total":2,"Overdue":0},"Progress":{"Width":40},
+				"children_task_folders":[{"Name":"Work","children_tasks":[{"Name":"Report","Priority":3,"DueDate":"2026-10-20T09:00:00Z"}]}],
+				"children_tasks":[{"Name":"Milk","Completed":true,"DueDate":"0001-01-01T00:00:00Z"}]}`,
+			version: 0,
+		},
+		{
+			name: "version 1 without ids",
+			data: `{"schema_version":1,"root":{"name":"Root","folders":[{"name":"Work","tasks":[{"name":"Report","priority":3,"due_date":"2026-10-20T09:00:00Z"}]}],
+				"tasks":[{"name":"Milk","completed":true}]}}`,
+			version: 1,
+		},
+		{
+			name: "version 2",
+			data: `{"schema_version":2,"root":{"id":"r","name":"Root","folders":[{"id":"w","name":"Work","tasks":[{"id":"t1","name":"Report","priority":3,"due_date":"2026-10-20T09:00:00Z"}]}],
+				"tasks":[{"id":"t2","name":"Milk","completed":true}]}}`,
+			version: 2,
+		},
+		{
+			name:    "newer than this build",
+			data:    `{"schema_version":99,"root":{}}`,
+			wantErr: "newer than this build",
+		},
+	}
+	due := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, version, err := decodeDocument([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decodeDocument() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeDocument() error = %v", err)
+			}
+			if version != tt.version {
+				t.Errorf("version = %d, want %d", version, tt.version)
+			}
+			if root.Name != "Root" || len(root.ChildrenTaskFolders) != 1 || len(root.ChildrenTasks) != 1 {
+				t.Fatalf("root = %+v, want Root with one folder and one task", root)
+			}
+			work := root.ChildrenTaskFolders[0]
+			if work.Name != "Work" || len(work.ChildrenTasks) != 1 {
+				t.Fatalf("folder = %+v, want Work with one task", work)
+			}
+			report, milk := work.ChildrenTasks[0], root.ChildrenTasks[0]
+			if report.Name != "Report" || report.Priority != 3 || !report.DueDate.Equal(due) {
+				t.Errorf("task = %+v, want Report, priority 3, due %s", report, due)
+			}
+			if milk.Name != "Milk" || !milk.Completed || !milk.DueDate.IsZero() {
+				t.Errorf("task = %+v, want Milk completed without a due date", milk)
+			}
+			for _, id := range []string{root.ID, work.ID, report.ID, milk.ID} {
+				if id == "" {
+					t.Error("an item has no ID after migrating")
+				}
+			}
+		})
+	}
+}
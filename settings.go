@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+)
+
+var settings_path = "settings.json"
+
+// Settings is read from settings.json, missing fields keep their defaults.
+type Settings struct {
+	// HistorySize bounds how many changes can be undone.
+	HistorySize int `json:"history_size"`
+	// PersistHistory keeps the undo/redo history next to the task file so it
+	// survives restarts.
+	PersistHistory bool `json:"persist_history"`
+	// TrashRetentionDays is how long deleted items stay in the trash before
+	// they are purged at startup, 0 keeps them until purged by hand.
+	TrashRetentionDays int `json:"trash_retention_days"`
+	// Watch reloads the task file when another process changes it.
+	Watch bool `json:"watch"`
+	// OnExternalChange is "reload" to take on outside changes right away or
+	// "prompt" to ask first.
+	OnExternalChange string `json:"on_external_change"`
+	// BackupSaves is how many of the latest saves are kept as backups, 0
+	// turns them off.
+	BackupSaves int `json:"backup_saves"`
+	// BackupDays is how many daily snapshots are kept, 0 turns them off.
+	BackupDays int `json:"backup_days"`
+	// Git commits every save to a git repository around the task file.
+	Git bool `json:"git"`
+	// GitRemote is where todoit sync pulls from and pushes to.
+	GitRemote string `json:"git_remote"`
+	// EventLogSize is how many changes each item's log keeps, 0 turns the
+	// log off.
+	EventLogSize int `json:"event_log_size"`
+	// EventLogDays drops logged changes older than this, 0 keeps them.
+	EventLogDays int `json:"event_log_days"`
+	// Actor is the name changes are logged under, the system user by
+	// default.
+	Actor string `json:"actor"`
+	// DueCheckSeconds is how often due dates are checked while ToDoIt is
+	// open, 0 turns the checks off.
+	DueCheckSeconds int `json:"due_check_seconds"`
+	// DueSoonMinutes is how long before its due date a task counts as due
+	// soon.
+	DueSoonMinutes int `json:"due_soon_minutes"`
+	// StatusScope is "subtree" to count the tasks of every folder below a
+	// folder in its status, or "tasks" to count only its own.
+	StatusScope string `json:"status_scope"`
+	// Notifier is the command todoit daemon runs for a reminder, e.g.
+	// ["notify-send"], printing it when empty. SnoozeMinutes is how long Z
+	// puts reminders off.
+	Notifier      []string `json:"notifier"`
+	SnoozeMinutes int      `json:"snooze_minutes"`
+	// States are the lifecycle states of tasks, see TaskState.
+	States []TaskState `json:"states"`
+	// Workspaces are named task files to pick from at startup and switch
+	// between with w.
+	Workspaces []Workspace `json:"workspaces"`
+}
+
+// Workspace is a named task file, Store works like the --store flag.
+type Workspace struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Store string `json:"store"`
+}
+
+func (s Settings) workspace(name string) (Workspace, bool) {
+	for _, ws := range s.Workspaces {
+		if ws.Name == name {
+			return ws, true
+		}
+	}
+	return Workspace{}, false
+}
+
+// actor is who changes made in this session are logged as.
+func (s Settings) actor() string {
+	if s.Actor != "" {
+		return s.Actor
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func defaultSettings() Settings {
+	return Settings{
+		HistorySize:        100,
+		TrashRetentionDays: 30,
+		OnExternalChange:   "reload",
+		BackupSaves:        10,
+		BackupDays:         7,
+		GitRemote:          "origin",
+		EventLogSize:       100,
+		EventLogDays:       365,
+		StatusScope:        "subtree",
+		DueCheckSeconds:    60,
+		DueSoonMinutes:     60,
+		SnoozeMinutes:      10,
+		States:             defaultStates(),
+	}
+}
+
+func loadSettings(path string) (Settings, error) {
+	s := defaultSettings()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return s, nil
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	if s.OnExternalChange != "reload" && s.OnExternalChange != "prompt" {
+		return s, fmt.Errorf("error parsing %s: on_external_change must be \"reload\" or \"prompt\"", path)
+	}
+	if s.StatusScope != "subtree" && s.StatusScope != "tasks" {
+		return s, fmt.Errorf("error parsing %s: status_scope must be \"subtree\" or \"tasks\"", path)
+	}
+	if s.SnoozeMinutes <= 0 {
+		return s, fmt.Errorf("error parsing %s: snooze_minutes must be at least 1", path)
+	}
+	if err := checkStates(s.States); err != nil {
+		return s, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	names := map[string]bool{}
+	for _, ws := range s.Workspaces {
+		if ws.Name == "" || ws.Path == "" {
+			return s, fmt.Errorf("error parsing %s: every workspace needs a name and a path", path)
+		}
+		if names[ws.Name] {
+			return s, fmt.Errorf("error parsing %s: workspace %q is listed twice", path, ws.Name)
+		}
+		names[ws.Name] = true
+	}
+	return s, nil
+}
@@ -0,0 +1,778 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMigrations[i] upgrades a database from PRAGMA user_version i to i+1.
+var sqliteMigrations = []string{
+	sqliteSchemaV1,
+	sqliteSchemaV2,
+	sqliteSchemaV3,
+	sqliteSchemaV4,
+	sqliteSchemaV5,
+	sqliteSchemaV6,
+	sqliteSchemaV7,
+	sqliteSchemaV8,
+	sqliteSchemaV9,
+	sqliteSchemaV10,
+	sqliteSchemaV11,
+	sqliteSchemaV12,
+	sqliteSchemaV13,
+}
+
+const sqliteSchemaV1 = `
+CREATE TABLE IF NOT EXISTS folders (
+	id        INTEGER PRIMARY KEY,
+	parent_id INTEGER REFERENCES folders(id) ON DELETE CASCADE,
+	position  INTEGER NOT NULL DEFAULT 0,
+	name      TEXT NOT NULL DEFAULT '',
+	desc      TEXT NOT NULL DEFAULT '',
+	completed INTEGER NOT NULL DEFAULT 0,
+	total     INTEGER NOT NULL DEFAULT 0,
+	overdue   INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS folders_parent ON folders(parent_id, position);
+CREATE TABLE IF NOT EXISTS tasks (
+	id        INTEGER PRIMARY KEY,
+	folder_id INTEGER NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+	position  INTEGER NOT NULL DEFAULT 0,
+	name      TEXT NOT NULL DEFAULT '',
+	desc      TEXT NOT NULL DEFAULT '',
+	completed INTEGER NOT NULL DEFAULT 0,
+	due_date  TEXT,
+	priority  INTEGER NOT NULL DEFAULT 0,
+	overdue   INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS tasks_folder ON tasks(folder_id, position);
+`
+
+const sqliteSchemaV2 = `
+ALTER TABLE folders ADD COLUMN uid TEXT;
+ALTER TABLE folders ADD COLUMN created_at TEXT;
+ALTER TABLE folders ADD COLUMN updated_at TEXT;
+ALTER TABLE folders ADD COLUMN completed_at TEXT;
+CREATE UNIQUE INDEX folders_uid ON folders(uid);
+ALTER TABLE tasks ADD COLUMN uid TEXT;
+ALTER TABLE tasks ADD COLUMN created_at TEXT;
+ALTER TABLE tasks ADD COLUMN updated_at TEXT;
+ALTER TABLE tasks ADD COLUMN completed_at TEXT;
+CREATE UNIQUE INDEX tasks_uid ON tasks(uid);
+`
+
+// sqliteSchemaV3 adds the trash. Trashed items are kept whole as their trash
+// entry's JSON, they are only ever read back all at once.
+const sqliteSchemaV3 = `
+CREATE TABLE IF NOT EXISTS trash (
+	uid        TEXT PRIMARY KEY,
+	deleted_at TEXT NOT NULL,
+	entry      TEXT NOT NULL
+);
+`
+
+// sqliteSchemaV4 adds the revision counter, see StaleError.
+const sqliteSchemaV4 = `
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+INSERT OR IGNORE INTO meta (key, value) VALUES ('revision', 0);
+`
+
+// sqliteSchemaV5 adds the items' event logs, kept as the JSON of their
+// entries like the trash.
+const sqliteSchemaV5 = `
+ALTER TABLE folders ADD COLUMN events TEXT;
+ALTER TABLE tasks ADD COLUMN events TEXT;
+`
+
+// sqliteSchemaV6 adds the tasks' repeat rules and the JSON list of when
+// their instances were completed.
+const sqliteSchemaV6 = `
+ALTER TABLE tasks ADD COLUMN recurrence TEXT NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN completions TEXT;
+`
+
+// sqliteSchemaV7 adds the JSON list of task IDs a task depends on.
+const sqliteSchemaV7 = `
+ALTER TABLE tasks ADD COLUMN depends_on TEXT;
+`
+
+// sqliteSchemaV8 adds the tasks' checklists, kept as the JSON of their steps.
+const sqliteSchemaV8 = `
+ALTER TABLE tasks ADD COLUMN checklist TEXT;
+`
+
+// sqliteSchemaV9 adds the tags of folders and tasks as JSON lists.
+const sqliteSchemaV9 = `
+ALTER TABLE folders ADD COLUMN tags TEXT;
+ALTER TABLE tasks ADD COLUMN tags TEXT;
+`
+
+// sqliteSchemaV10 adds the lifecycle state of tasks.
+const sqliteSchemaV10 = `
+ALTER TABLE tasks ADD COLUMN state TEXT NOT NULL DEFAULT '';
+`
+
+// sqliteSchemaV11 adds the start, scheduled and defer until dates of tasks.
+const sqliteSchemaV11 = `
+ALTER TABLE tasks ADD COLUMN start_date TEXT;
+ALTER TABLE tasks ADD COLUMN scheduled_date TEXT;
+ALTER TABLE tasks ADD COLUMN defer_until TEXT;
+`
+
+// sqliteSchemaV12 adds the tasks' time entries, kept as JSON, and their
+// estimates in minutes.
+const sqliteSchemaV12 = `
+ALTER TABLE tasks ADD COLUMN time_entries TEXT;
+ALTER TABLE tasks ADD COLUMN estimate_minutes INTEGER NOT NULL DEFAULT 0;
+`
+
+// sqliteSchemaV13 adds the tasks' reminders, kept as JSON.
+const sqliteSchemaV13 = `
+ALTER TABLE tasks ADD COLUMN reminders TEXT;
+`
+
+// SQLiteStore keeps folders and tasks as rows so a mutation only touches the
+// rows it changed instead of rewriting the whole tree. Rows are addressed by
+// the items' IDs.
+type SQLiteStore struct {
+	Path string
+	db   *sql.DB
+	// dataVersion is PRAGMA data_version as of the last Load or Save, it only
+	// moves when another connection commits.
+	dataVersion int64
+	// revision is the stored revision as of the last Load or write, writes
+	// are refused once the database moved past it.
+	revision int64
+}
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", path, err)
+	}
+	// data_version is per connection, keep a single one so our own writes
+	// never look like someone else's
+	db.SetMaxOpenConns(1)
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error migrating %s: %w", path, err)
+	}
+	return &SQLiteStore{Path: path, db: db}, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func migrateSQLite(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf("schema version %d is newer than this build supports (%d)", version, len(sqliteMigrations))
+	}
+	for v := version; v < len(sqliteMigrations); v++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[v]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("schema version %d: %w", v+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, v+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Load() (*TaskFolder, error) {
+	if err := s.db.QueryRow(`SELECT value FROM meta WHERE key = 'revision'`).Scan(&s.revision); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", s.Path, err)
+	}
+	rows, err := s.db.Query(`SELECT id, parent_id, uid, name, desc, completed, total, overdue, created_at, updated_at, completed_at, events, tags FROM folders ORDER BY parent_id, position`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading folders: %w", err)
+	}
+	byID := map[int64]*TaskFolder{}
+	parents := map[int64]int64{}
+	var order []int64
+	var root *TaskFolder
+	for rows.Next() {
+		var id int64
+		var parent sql.NullInt64
+		var uid, created, updated, completed, events, tags sql.NullString
+		f := &TaskFolder{}
+		if err := rows.Scan(&id, &parent, &uid, &f.Name, &f.Desc, &f.Status.Completed, &f.Status.Total, &f.Status.Overdue, &created, &updated, &completed, &events, &tags); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error reading folders: %w", err)
+		}
+		f.ID = uid.String
+		if err := scanTimes(map[*time.Time]sql.NullString{&f.CreatedAt: created, &f.UpdatedAt: updated, &f.CompletedAt: completed}); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("folder %d: %w", id, err)
+		}
+		if f.Events, err = scanEvents(events); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("folder %d: %w", id, err)
+		}
+		if f.Tags, err = scanStrings(tags, "tags"); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("folder %d: %w", id, err)
+		}
+		byID[id] = f
+		if parent.Valid {
+			parents[id] = parent.Int64
+			order = append(order, id)
+		} else if root == nil {
+			root = f
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading folders: %w", err)
+	}
+	for _, id := range order {
+		f, parent := byID[id], byID[parents[id]]
+		if parent == nil {
+			return nil, fmt.Errorf("folder %d has a missing parent", id)
+		}
+		f.Parent = parent
+		parent.ChildrenTaskFolders = append(parent.ChildrenTaskFolders, f)
+	}
+
+	rows, err = s.db.Query(`SELECT id, folder_id, uid, name, desc, completed, due_date, priority, overdue, created_at, updated_at, completed_at, events, recurrence, completions, depends_on, checklist, tags, state, start_date, scheduled_date, defer_until, time_entries, estimate_minutes, reminders FROM tasks ORDER BY folder_id, position`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tasks: %w", err)
+	}
+	for rows.Next() {
+		var id, folderID int64
+		var uid, due, created, updated, completed, events, completions, dependsOn, checklist, tags, start, scheduled, deferUntil, timeEntries, reminders sql.NullString
+		var estimate int64
+		t := &Task{}
+		if err := rows.Scan(&id, &folderID, &uid, &t.Name, &t.Desc, &t.Completed, &due, &t.Priority, &t.Overdue, &created, &updated, &completed, &events, &t.Recurrence, &completions, &dependsOn, &checklist, &tags, &t.State, &start, &scheduled, &deferUntil, &timeEntries, &estimate, &reminders); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error reading tasks: %w", err)
+		}
+		t.ID = uid.String
+		if err := scanTimes(map[*time.Time]sql.NullString{&t.DueDate: due, &t.CreatedAt: created, &t.UpdatedAt: updated, &t.CompletedAt: completed, &t.StartDate: start, &t.ScheduledDate: scheduled, &t.DeferUntil: deferUntil}); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("task %d: %w", id, err)
+		}
+		if t.Events, err = scanEvents(events); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("task %d: %w", id, err)
+		}
+		if t.Completions, err = scanCompletions(completions); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("task %d: %w", id, err)
+		}
+		if t.DependsOn, err = scanStrings(dependsOn, "depends_on"); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("task %d: %w", id, err)
+		}
+		if t.Checklist, err = scanChecklist(checklist); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("task %d: %w", id, err)
+		}
+		if t.Tags, err = scanStrings(tags, "tags"); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("task %d: %w", id, err)
+		}
+		if t.TimeEntries, err = scanTimeEntries(timeEntries); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("task %d: %w", id, err)
+		}
+		t.Estimate = time.Duration(estimate) * time.Minute
+		if t.Reminders, err = scanReminders(reminders); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("task %d: %w", id, err)
+		}
+		folder := byID[folderID]
+		if folder == nil {
+			rows.Close()
+			return nil, fmt.Errorf("task %d has a missing folder", id)
+		}
+		t.ParentFolder = folder
+		folder.ChildrenTasks = append(folder.ChildrenTasks, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading tasks: %w", err)
+	}
+
+	if root == nil {
+		root = &TaskFolder{}
+	}
+	if root.Trash, err = s.loadTrash(); err != nil {
+		return nil, err
+	}
+	// rows written before IDs existed get one now
+	if assignMissingIDs(root, time.Now()) {
+		if err := s.Save(root); err != nil {
+			return nil, err
+		}
+	}
+	reconstructFolderFromJSON(root)
+	if err := s.db.QueryRow(`PRAGMA data_version`).Scan(&s.dataVersion); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", s.Path, err)
+	}
+	return root, nil
+}
+
+func (s *SQLiteStore) Changed() (bool, error) {
+	var version int64
+	if err := s.db.QueryRow(`PRAGMA data_version`).Scan(&version); err != nil {
+		return false, fmt.Errorf("error reading %s: %w", s.Path, err)
+	}
+	return version != s.dataVersion, nil
+}
+
+// Save replaces every row with the given tree.
+func (s *SQLiteStore) Save(root *TaskFolder) error {
+	err := s.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM tasks`); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM folders`); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM trash`); err != nil {
+			return err
+		}
+		for _, t := range root.Trash {
+			if err := s.insertTrash(tx, t); err != nil {
+				return err
+			}
+		}
+		return s.insertFolder(tx, root, 0)
+	})
+	if err != nil {
+		return err
+	}
+	// the tree on disk is ours again
+	if err := s.db.QueryRow(`PRAGMA data_version`).Scan(&s.dataVersion); err != nil {
+		return fmt.Errorf("error reading %s: %w", s.Path, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) SaveChange(root *TaskFolder, change Change) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		switch change.Kind {
+		case ChangeCreate, ChangeRestore:
+			for _, item := range change.Items {
+				if _, err := tx.Exec(`DELETE FROM trash WHERE uid = ?`, itemID(item)); err != nil {
+					return err
+				}
+				var err error
+				switch v := item.(type) {
+				case *Task:
+					err = s.insertTask(tx, v, len(change.Folder.ChildrenTasks)-1)
+				case *TaskFolder:
+					err = s.insertFolder(tx, v, len(change.Folder.ChildrenTaskFolders)-1)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			// restored items may land in the middle of the folder
+			if err := s.renumber(tx, change.Folder); err != nil {
+				return err
+			}
+		case ChangeEdit, ChangeToggle, ChangeRecur:
+			for _, item := range change.Items {
+				var err error
+				switch v := item.(type) {
+				case *Task:
+					err = s.updateTask(tx, v)
+				case *TaskFolder:
+					err = s.updateFolder(tx, v)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		case ChangeDelete, ChangeTrash:
+			for _, item := range change.Items {
+				var err error
+				switch v := item.(type) {
+				case *Task:
+					_, err = tx.Exec(`DELETE FROM tasks WHERE uid = ?`, v.ID)
+				case *TaskFolder:
+					_, err = tx.Exec(`DELETE FROM folders WHERE uid = ?`, v.ID)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if err := s.renumber(tx, change.Folder); err != nil {
+				return err
+			}
+			if change.Kind == ChangeTrash {
+				for _, item := range change.Items {
+					i := findTrashed(root, itemID(item))
+					if i < 0 {
+						return fmt.Errorf("%q is missing from the trash", itemName(item))
+					}
+					if err := s.insertTrash(tx, root.Trash[i]); err != nil {
+						return err
+					}
+				}
+			}
+		case ChangePurge:
+			for _, item := range change.Items {
+				if _, err := tx.Exec(`DELETE FROM trash WHERE uid = ?`, itemID(item)); err != nil {
+					return err
+				}
+			}
+		case ChangeSort:
+			if err := s.renumber(tx, change.Folder); err != nil {
+				return err
+			}
+		case ChangeMove:
+			for _, item := range change.Items {
+				var err error
+				switch v := item.(type) {
+				case *Task:
+					if _, err = tx.Exec(`UPDATE tasks SET folder_id = (SELECT id FROM folders WHERE uid = ?) WHERE uid = ?`, change.Folder.ID, v.ID); err == nil {
+						err = s.updateTask(tx, v)
+					}
+				case *TaskFolder:
+					if _, err = tx.Exec(`UPDATE folders SET parent_id = (SELECT id FROM folders WHERE uid = ?) WHERE uid = ?`, change.Folder.ID, v.ID); err == nil {
+						err = s.updateFolder(tx, v)
+					}
+				}
+				if err != nil {
+					return err
+				}
+			}
+			for _, f := range []*TaskFolder{change.From, change.Folder} {
+				if err := s.renumber(tx, f); err != nil {
+					return err
+				}
+			}
+			if err := s.updateAncestors(tx, change.From); err != nil {
+				return err
+			}
+		}
+		// counters and timestamps live on the folder the change happened in,
+		// the folders above it count its tasks too
+		return s.updateAncestors(tx, change.Folder)
+	})
+}
+
+func (s *SQLiteStore) updateAncestors(tx *sql.Tx, f *TaskFolder) error {
+	for ; f != nil; f = f.Parent {
+		if err := s.updateFolder(tx, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inTx runs fn in a write transaction and bumps the revision, unless another
+// session wrote since the last Load or write.
+func (s *SQLiteStore) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	var revision int64
+	if err := tx.QueryRow(`SELECT value FROM meta WHERE key = 'revision'`).Scan(&revision); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error reading %s: %w", s.Path, err)
+	}
+	if revision != s.revision {
+		tx.Rollback()
+		return &StaleError{Path: s.Path}
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error writing %s: %w", s.Path, err)
+	}
+	if _, err := tx.Exec(`UPDATE meta SET value = ? WHERE key = 'revision'`, revision+1); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error writing %s: %w", s.Path, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing to %s: %w", s.Path, err)
+	}
+	s.revision = revision + 1
+	return nil
+}
+
+func (s *SQLiteStore) insertFolder(tx *sql.Tx, f *TaskFolder, position int) error {
+	var parent sql.NullInt64
+	if f.Parent != nil {
+		if err := tx.QueryRow(`SELECT id FROM folders WHERE uid = ?`, f.Parent.ID).Scan(&parent); err != nil {
+			return fmt.Errorf("folder %q has an unsaved parent: %w", f.Name, err)
+		}
+	}
+	events, err := sqlEvents(f.Events)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO folders (parent_id, position, uid, name, desc, completed, total, overdue, created_at, updated_at, completed_at, events, tags) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		parent, position, f.ID, f.Name, f.Desc, f.Status.Completed, f.Status.Total, f.Status.Overdue, sqlTime(f.CreatedAt), sqlTime(f.UpdatedAt), sqlTime(f.CompletedAt), events, sqlStrings(f.Tags))
+	if err != nil {
+		return err
+	}
+	for i, child := range f.ChildrenTaskFolders {
+		if err := s.insertFolder(tx, child, i); err != nil {
+			return err
+		}
+	}
+	for i, t := range f.ChildrenTasks {
+		if err := s.insertTask(tx, t, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) insertTrash(tx *sql.Tx, t *TrashedItem) error {
+	data, err := json.Marshal(toTrashDoc(t))
+	if err != nil {
+		return fmt.Errorf("error encoding %q: %w", itemName(t.item()), err)
+	}
+	_, err = tx.Exec(`INSERT OR REPLACE INTO trash (uid, deleted_at, entry) VALUES (?, ?, ?)`, itemID(t.item()), sqlTime(t.DeletedAt), string(data))
+	return err
+}
+
+func (s *SQLiteStore) loadTrash() ([]*TrashedItem, error) {
+	rows, err := s.db.Query(`SELECT entry FROM trash ORDER BY deleted_at, rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading trash: %w", err)
+	}
+	defer rows.Close()
+	var out []*TrashedItem
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("error reading trash: %w", err)
+		}
+		var d trashDoc
+		if err := json.Unmarshal([]byte(data), &d); err != nil {
+			return nil, fmt.Errorf("error reading trash: %w", err)
+		}
+		out = append(out, fromTrashDoc(&d))
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) insertTask(tx *sql.Tx, t *Task, position int) error {
+	events, err := sqlEvents(t.Events)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO tasks (folder_id, position, uid, name, desc, completed, due_date, priority, overdue, created_at, updated_at, completed_at, events, recurrence, completions, depends_on, checklist, tags, state, start_date, scheduled_date, defer_until, time_entries, estimate_minutes, reminders)
+		SELECT id, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? FROM folders WHERE uid = ?`,
+		position, t.ID, t.Name, t.Desc, t.Completed, sqlTime(t.DueDate), t.Priority, t.Overdue, sqlTime(t.CreatedAt), sqlTime(t.UpdatedAt), sqlTime(t.CompletedAt), events, t.Recurrence, sqlCompletions(t.Completions), sqlStrings(t.DependsOn), sqlChecklist(t.Checklist), sqlStrings(t.Tags), t.State, sqlTime(t.StartDate), sqlTime(t.ScheduledDate), sqlTime(t.DeferUntil), sqlTimeEntries(t.TimeEntries), int64(t.Estimate/time.Minute), sqlReminders(t.Reminders), t.ParentFolder.ID)
+	return err
+}
+
+func (s *SQLiteStore) updateTask(tx *sql.Tx, t *Task) error {
+	events, err := sqlEvents(t.Events)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`UPDATE tasks SET name = ?, desc = ?, completed = ?, due_date = ?, priority = ?, overdue = ?, updated_at = ?, completed_at = ?, events = ?, recurrence = ?, completions = ?, depends_on = ?, checklist = ?, tags = ?, state = ?, start_date = ?, scheduled_date = ?, defer_until = ?, time_entries = ?, estimate_minutes = ?, reminders = ? WHERE uid = ?`,
+		t.Name, t.Desc, t.Completed, sqlTime(t.DueDate), t.Priority, t.Overdue, sqlTime(t.UpdatedAt), sqlTime(t.CompletedAt), events, t.Recurrence, sqlCompletions(t.Completions), sqlStrings(t.DependsOn), sqlChecklist(t.Checklist), sqlStrings(t.Tags), t.State, sqlTime(t.StartDate), sqlTime(t.ScheduledDate), sqlTime(t.DeferUntil), sqlTimeEntries(t.TimeEntries), int64(t.Estimate/time.Minute), sqlReminders(t.Reminders), t.ID)
+	return expectRow(res, err, "task", t.Name)
+}
+
+func (s *SQLiteStore) updateFolder(tx *sql.Tx, f *TaskFolder) error {
+	events, err := sqlEvents(f.Events)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`UPDATE folders SET name = ?, desc = ?, completed = ?, total = ?, overdue = ?, updated_at = ?, completed_at = ?, events = ?, tags = ? WHERE uid = ?`,
+		f.Name, f.Desc, f.Status.Completed, f.Status.Total, f.Status.Overdue, sqlTime(f.UpdatedAt), sqlTime(f.CompletedAt), events, sqlStrings(f.Tags), f.ID)
+	return expectRow(res, err, "folder", f.Name)
+}
+
+func expectRow(res sql.Result, err error, kind, name string) error {
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%s %q was never saved", kind, name)
+	}
+	return nil
+}
+
+// renumber writes the current order of f's children back to their rows.
+func (s *SQLiteStore) renumber(tx *sql.Tx, f *TaskFolder) error {
+	for i, child := range f.ChildrenTaskFolders {
+		if _, err := tx.Exec(`UPDATE folders SET position = ? WHERE uid = ?`, i, child.ID); err != nil {
+			return err
+		}
+	}
+	for i, t := range f.ChildrenTasks {
+		if _, err := tx.Exec(`UPDATE tasks SET position = ? WHERE uid = ?`, i, t.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sqlTime(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.Format(time.RFC3339Nano), Valid: true}
+}
+
+// sqlEvents encodes an event log as the JSON written to the file, NULL when
+// it is empty.
+func sqlEvents(events []Event) (sql.NullString, error) {
+	if len(events) == 0 {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(toEventDocs(events))
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("error encoding events: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func scanEvents(src sql.NullString) ([]Event, error) {
+	if !src.Valid {
+		return nil, nil
+	}
+	var docs []*eventDoc
+	if err := json.Unmarshal([]byte(src.String), &docs); err != nil {
+		return nil, fmt.Errorf("bad events: %w", err)
+	}
+	return fromEventDocs(docs), nil
+}
+
+// sqlCompletions encodes a completion history as the JSON written to the
+// file, NULL when it is empty.
+func sqlCompletions(completions []time.Time) sql.NullString {
+	if len(completions) == 0 {
+		return sql.NullString{}
+	}
+	data, _ := json.Marshal(completions)
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+func scanCompletions(src sql.NullString) ([]time.Time, error) {
+	if !src.Valid {
+		return nil, nil
+	}
+	var out []time.Time
+	if err := json.Unmarshal([]byte(src.String), &out); err != nil {
+		return nil, fmt.Errorf("bad completions: %w", err)
+	}
+	return out, nil
+}
+
+// sqlStrings encodes a list such as a task's dependencies or tags as JSON,
+// NULL when it is empty.
+func sqlStrings(list []string) sql.NullString {
+	if len(list) == 0 {
+		return sql.NullString{}
+	}
+	data, _ := json.Marshal(list)
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+func scanStrings(src sql.NullString, column string) ([]string, error) {
+	if !src.Valid {
+		return nil, nil
+	}
+	var out []string
+	if err := json.Unmarshal([]byte(src.String), &out); err != nil {
+		return nil, fmt.Errorf("bad %s: %w", column, err)
+	}
+	return out, nil
+}
+
+// sqlChecklist encodes a checklist as the JSON written to the file, NULL when
+// it is empty.
+func sqlChecklist(steps []CheckItem) sql.NullString {
+	if len(steps) == 0 {
+		return sql.NullString{}
+	}
+	data, _ := json.Marshal(toCheckDocs(steps))
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+func scanChecklist(src sql.NullString) ([]CheckItem, error) {
+	if !src.Valid {
+		return nil, nil
+	}
+	var docs []*checkDoc
+	if err := json.Unmarshal([]byte(src.String), &docs); err != nil {
+		return nil, fmt.Errorf("bad checklist: %w", err)
+	}
+	return fromCheckDocs(docs), nil
+}
+
+func sqlReminders(reminders []Reminder) sql.NullString {
+	if len(reminders) == 0 {
+		return sql.NullString{}
+	}
+	data, _ := json.Marshal(toReminderDocs(reminders))
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+func scanReminders(src sql.NullString) ([]Reminder, error) {
+	if !src.Valid {
+		return nil, nil
+	}
+	var docs []*reminderDoc
+	if err := json.Unmarshal([]byte(src.String), &docs); err != nil {
+		return nil, fmt.Errorf("bad reminders: %w", err)
+	}
+	return fromReminderDocs(docs), nil
+}
+
+func sqlTimeEntries(entries []TimeEntry) sql.NullString {
+	if len(entries) == 0 {
+		return sql.NullString{}
+	}
+	data, _ := json.Marshal(toTimeDocs(entries))
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+func scanTimeEntries(src sql.NullString) ([]TimeEntry, error) {
+	if !src.Valid {
+		return nil, nil
+	}
+	var docs []*timeDoc
+	if err := json.Unmarshal([]byte(src.String), &docs); err != nil {
+		return nil, fmt.Errorf("bad time entries: %w", err)
+	}
+	return fromTimeDocs(docs), nil
+}
+
+// scanTimes parses NULL-able time columns into their fields.
+func scanTimes(cols map[*time.Time]sql.NullString) error {
+	for dst, src := range cols {
+		if !src.Valid {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, src.String)
+		if err != nil {
+			return fmt.Errorf("bad time %q: %w", src.String, err)
+		}
+		*dst = t
+	}
+	return nil
+}
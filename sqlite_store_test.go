@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// sampleTree is a tree using every field the stores persist.
+func sampleTree() *TaskFolder {
+	at := func(day, hour int) time.Time { return time.Date(2026, 10, day, hour, 0, 0, 0, time.UTC) }
+	root := &TaskFolder{ID: "root", Name: "Root", CreatedAt: at(1, 8), UpdatedAt: at(1, 8)}
+	work := &TaskFolder{ID: "work", Name: "Work", Desc: "office", Parent: root, Tags: []string{"job"}, CreatedAt: at(1, 9), UpdatedAt: at(2, 9)}
+	root.ChildrenTaskFolders = []*TaskFolder{work}
+	end := at(3, 11)
+	report := &Task{
+		ID: "report", Name: "Report", Desc: "quarterly", ParentFolder: work,
+		State: "in-progress", DueDate: at(20, 9), StartDate: at(10, 9), ScheduledDate: at(15, 9), DeferUntil: at(5, 9),
+		Priority: 3, Recurrence: "monthly on 20", Completions: []time.Time{at(2, 10)},
+		DependsOn:   []string{"milk"},
+		Checklist:   []CheckItem{{ID: "c1", Name: "draft", Done: true, DoneAt: at(3, 9)}, {ID: "c2", Name: "send"}},
+		Tags:        []string{"job", "writing"},
+		TimeEntries: []TimeEntry{{ID: "e1", Start: at(3, 10), End: end}},
+		Estimate:    90 * time.Minute,
+		Reminders:   []Reminder{{ID: "r1", Before: 30 * time.Minute, Fired: at(4, 8)}, {ID: "r2", At: at(19, 18), Snoozed: at(19, 19)}},
+		Events:      []Event{{At: at(2, 9), Actor: "alice", Field: "name", Old: "Draft", New: "Report"}},
+		CreatedAt:   at(2, 8), UpdatedAt: at(3, 12),
+	}
+	work.ChildrenTasks = []*Task{report}
+	milk := &Task{ID: "milk", Name: "Milk", ParentFolder: root, Completed: true, CompletedAt: at(2, 18), CreatedAt: at(2, 17), UpdatedAt: at(2, 18)}
+	root.ChildrenTasks = []*Task{milk}
+	return root
+}
+
+func TestJSONSQLiteRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+	}{
+		{name: "json to sqlite", from: "json", to: "sqlite"},
+		{name: "sqlite to json", from: "sqlite", to: "json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			want, err := json.Marshal(toFolderDoc(sampleTree()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			root := sampleTree()
+			for i, kind := range []string{tt.from, tt.to} {
+				store, err := openStore(filepath.Join(dir, "tasks."+kind), kind)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := store.Save(root); err != nil {
+					t.Fatalf("%s Save() error = %v", kind, err)
+				}
+				if root, err = store.Load(); err != nil {
+					t.Fatalf("%s Load() error = %v", kind, err)
+				}
+				got, err := json.Marshal(toFolderDoc(root))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != string(want) {
+					t.Fatalf("after store %d (%s):\n got %s\nwant %s", i+1, kind, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"go.dalton.dog/bubbleup"
+	"slices"
+	"strings"
+)
+
+// TaskState is a step of the task lifecycle, the states are configured in
+// the settings.
+type TaskState struct {
+	Name  string `json:"name"`
+	Icon  string `json:"icon"`
+	Color string `json:"color"`
+	// Done counts a task in this state as completed, Cancelled leaves it out
+	// of the completion counts. Either closes the task.
+	Done      bool `json:"done"`
+	Cancelled bool `json:"cancelled"`
+	// Next are the states a task may move on to, any other state when empty.
+	Next []string `json:"next"`
+}
+
+func (s TaskState) closed() bool { return s.Done || s.Cancelled }
+
+func (s TaskState) FilterValue() string { return s.Name }
+func (s TaskState) Title() string       { return s.badge() }
+func (s TaskState) Description() string {
+	switch {
+	case s.Done:
+		return "completes the task"
+	case s.Cancelled:
+		return "closes the task without counting it"
+	}
+	return ""
+}
+
+// badge is the state as shown on a task, in its colour.
+func (s TaskState) badge() string {
+	label := strings.TrimSpace(s.Icon + " " + s.Name)
+	if s.Color == "" {
+		return label
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color(s.Color)).Render(label)
+}
+
+func defaultStates() []TaskState {
+	return []TaskState{
+		{Name: "todo", Icon: "○"},
+		{Name: "in-progress", Icon: "▶", Color: "33"},
+		{Name: "waiting", Icon: "⏳", Color: "172"},
+		{Name: "blocked", Icon: "🚧", Color: "166"},
+		{Name: "done", Icon: "✓", Color: "70", Done: true, Next: []string{"todo", "in-progress"}},
+		{Name: "cancelled", Icon: "✗", Color: "244", Cancelled: true, Next: []string{"todo"}},
+	}
+}
+
+// taskStates are the states of the settings in use, the first one being
+// where new and reopened tasks start.
+var taskStates = defaultStates()
+
+// checkStates reports what is wrong with a set of states, nil when nothing
+// is.
+func checkStates(states []TaskState) error {
+	if len(states) == 0 {
+		return fmt.Errorf("there must be at least one state")
+	}
+	names := map[string]bool{}
+	for _, s := range states {
+		if s.Name == "" {
+			return fmt.Errorf("every state needs a name")
+		}
+		if names[s.Name] {
+			return fmt.Errorf("state %q is listed twice", s.Name)
+		}
+		if s.Done && s.Cancelled {
+			return fmt.Errorf("state %q can't be both done and cancelled", s.Name)
+		}
+		names[s.Name] = true
+	}
+	if states[0].closed() {
+		return fmt.Errorf("the first state, %q, is where tasks start and can't be done or cancelled", states[0].Name)
+	}
+	if !slices.ContainsFunc(states, func(s TaskState) bool { return s.Done }) {
+		return fmt.Errorf("one of the states must be done")
+	}
+	for _, s := range states {
+		for _, next := range s.Next {
+			if !names[next] {
+				return fmt.Errorf("state %q leads to %q, which isn't a state", s.Name, next)
+			}
+		}
+	}
+	return nil
+}
+
+func stateNamed(name string) (TaskState, bool) {
+	i := slices.IndexFunc(taskStates, func(s TaskState) bool { return s.Name == name })
+	if i < 0 {
+		return TaskState{}, false
+	}
+	return taskStates[i], true
+}
+
+// doneState is the state enter completes a task with.
+func doneState() TaskState {
+	i := slices.IndexFunc(taskStates, func(s TaskState) bool { return s.Done })
+	return taskStates[i]
+}
+
+// state is the state t is in. Tasks from before states existed, or in a
+// state the settings no longer have, are in the first state or done
+// depending on whether they are completed.
+func (t *Task) state() TaskState {
+	if s, ok := stateNamed(t.State); ok && s.closed() == t.Completed {
+		return s
+	}
+	if t.Completed {
+		return doneState()
+	}
+	return taskStates[0]
+}
+
+// setState moves t to s, completing or reopening it as s says.
+func (t *Task) setState(s TaskState) {
+	if t.Completed != s.closed() {
+		t.setCompletionStatus(s.closed())
+	}
+	t.State = s.Name
+}
+
+// nextStates are the states t may move on to, in the order of the settings.
+func (t *Task) nextStates() []TaskState {
+	from := t.state()
+	var out []TaskState
+	for _, s := range taskStates {
+		if s.Name != from.Name && (len(from.Next) == 0 || slices.Contains(from.Next, s.Name)) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// cycledState is the state after t's among those it may move on to, going
+// round in the order of the settings.
+func (t *Task) cycledState() (TaskState, bool) {
+	next := t.nextStates()
+	if len(next) == 0 {
+		return TaskState{}, false
+	}
+	at := slices.IndexFunc(taskStates, func(s TaskState) bool { return s.Name == t.state().Name })
+	for i := 1; i <= len(taskStates); i++ {
+		s := taskStates[(at+i)%len(taskStates)]
+		if slices.ContainsFunc(next, func(n TaskState) bool { return n.Name == s.Name }) {
+			return s, true
+		}
+	}
+	return next[0], true
+}
+
+// stateCommand moves a task from one state to another.
+type stateCommand struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (c *stateCommand) apply(root *TaskFolder) (Change, error)  { return c.set(root, c.To) }
+func (c *stateCommand) revert(root *TaskFolder) (Change, error) { return c.set(root, c.From) }
+
+func (c *stateCommand) set(root *TaskFolder, name string) (Change, error) {
+	t := findTask(root, c.ID)
+	if t == nil {
+		return Change{}, fmt.Errorf("task %s no longer exists", c.ID)
+	}
+	s, ok := stateNamed(name)
+	if !ok {
+		return Change{}, fmt.Errorf("there is no state %q in the settings", name)
+	}
+	t.setState(s)
+	return Change{Kind: ChangeToggle, Folder: t.ParentFolder, Items: []list.Item{t}}, nil
+}
+
+func (c *stateCommand) String() string { return fmt.Sprintf("mark %q %s", c.Name, c.To) }
+
+// moveToState moves t to s. Completing a blocked task takes force, and
+// completing a repeating one moves it on to its next instance instead.
+func (m *model) moveToState(t *Task, s TaskState, force bool) tea.Cmd {
+	if s.Done && !t.Completed {
+		if len(t.BlockedBy) > 0 && !force {
+			return m.alert.NewAlertCmd(bubbleup.ErrorKey, fmt.Sprintf("Blocked by %s, F completes it anyway", strings.Join(t.BlockedBy, ", ")))
+		}
+		if t.Recurrence != "" {
+			return m.completeTask(t, force)
+		}
+	}
+	cmd := m.execute(&stateCommand{ID: t.ID, Name: t.Name, From: t.state().Name, To: s.Name})
+	m.statusString = fmt.Sprintf("%s is now %s", t.Name, s.Name)
+	m.recreateList(m.currentFolder, m.list.GlobalIndex())
+	return cmd
+}
+
+// showStates lists the states t may move on to for picking one.
+func (m *model) showStates(t *Task) tea.Cmd {
+	next := t.nextStates()
+	if len(next) == 0 {
+		return m.alert.NewAlertCmd(bubbleup.InfoKey, t.Name+" can't leave "+t.state().Name)
+	}
+	var items []list.Item
+	for _, s := range next {
+		items = append(items, s)
+	}
+	m.stateMode, m.stateTask = true, t.ID
+	m.statusString = "Pick a state: enter moves the task there, esc cancels"
+	m.list.SetItems(items)
+	m.list.Title = fmt.Sprintf("%s \n %s →", t.Name, t.state().Name)
+	m.list.Select(0)
+	return nil
+}
+
+// updateStates handles a key in the state picker, reporting whether it did.
+func (m *model) updateStates(msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "enter":
+		s, ok := m.list.SelectedItem().(TaskState)
+		if !ok {
+			return nil, true
+		}
+		m.stateMode = false
+		t := findTask(m.rootFolder, m.stateTask)
+		if t == nil {
+			m.recreateList(m.currentFolder, 0)
+			return m.alert.NewAlertCmd(bubbleup.ErrorKey, "That task no longer exists"), true
+		}
+		m.recreateListAt(m.currentFolder, t.ID)
+		return m.moveToState(t, s, false), true
+	case "esc", "S":
+		m.stateMode = false
+		m.statusString = "Left the state unchanged"
+		t := findTask(m.rootFolder, m.stateTask)
+		if t == nil {
+			m.recreateList(m.currentFolder, 0)
+		} else {
+			m.recreateListAt(m.currentFolder, t.ID)
+		}
+		return nil, true
+	case "ctrl+c", "q":
+		return tea.Quit, true
+	}
+	return nil, false
+}
+
+// printStates is the count of tasks in each state, those in the first state
+// left out, e.g. "▶ 2 in-progress, ✗ 1 cancelled".
+func (s Status) printStates() string {
+	var parts []string
+	for _, st := range taskStates[1:] {
+		if n := s.States[st.Name]; n > 0 {
+			parts = append(parts, strings.TrimSpace(fmt.Sprintf("%s %d %s", st.Icon, n, st.Name)))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/gofrs/flock"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Store is the persistence backend behind the TUI. model.Update only ever
+// talks to a Store, so new backends can be added without touching it.
+type Store interface {
+	// Load reads the whole tree and returns its root folder.
+	Load() (*TaskFolder, error)
+	// Save writes the whole tree.
+	Save(root *TaskFolder) error
+	// SaveChange persists a single mutation made to the tree rooted at root.
+	SaveChange(root *TaskFolder, change Change) error
+	// Changed reports whether something else wrote to the store since it was
+	// last loaded or saved.
+	Changed() (bool, error)
+}
+
+type ChangeKind int
+
+const (
+	ChangeCreate ChangeKind = iota
+	ChangeEdit
+	ChangeToggle
+	ChangeDelete
+	ChangeSort
+	ChangeMove
+	// ChangeTrash moves Items from Folder into the trash, ChangeRestore moves
+	// them back into Folder and ChangePurge drops them from the trash.
+	ChangeTrash
+	ChangeRestore
+	ChangePurge
+	// ChangeRecur completes an instance of a repeating task and moves it on
+	// to the next one.
+	ChangeRecur
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeCreate:
+		return "create"
+	case ChangeEdit:
+		return "edit"
+	case ChangeToggle:
+		return "toggle"
+	case ChangeDelete:
+		return "delete"
+	case ChangeSort:
+		return "sort"
+	case ChangeMove:
+		return "move"
+	case ChangeTrash:
+		return "trash"
+	case ChangeRestore:
+		return "restore"
+	case ChangePurge:
+		return "purge"
+	case ChangeRecur:
+		return "recur"
+	}
+	return "unknown"
+}
+
+// touchesTrash reports whether the change modifies the trash, which is kept on
+// the root folder.
+func (k ChangeKind) touchesTrash() bool {
+	return k == ChangeTrash || k == ChangeRestore || k == ChangePurge
+}
+
+// Change describes one mutation of the tree. Folder is the folder the change
+// happened in, Items are the tasks/folders that were affected (empty for
+// sorts). Moves also set From, the folder the items left.
+type Change struct {
+	Kind   ChangeKind
+	Folder *TaskFolder
+	From   *TaskFolder
+	Items  []list.Item
+}
+
+func (c Change) String() string {
+	var names []string
+	for _, item := range c.Items {
+		switch v := item.(type) {
+		case *Task:
+			names = append(names, v.Name)
+		case *TaskFolder:
+			names = append(names, v.Name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("%s in %s", c.Kind, c.Folder.returnPath())
+	}
+	if c.From != nil {
+		return fmt.Sprintf("%s %v from %s to %s", c.Kind, names, c.From.returnPath(), c.Folder.returnPath())
+	}
+	return fmt.Sprintf("%s %v in %s", c.Kind, names, c.Folder.returnPath())
+}
+
+// StaleError is returned by a save when another session wrote to the store
+// since this one last loaded or saved it. Nothing was written, the caller
+// has to merge with what is stored first.
+type StaleError struct {
+	Path string
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("%s was changed by another session", e.Path)
+}
+
+// openStore picks a backend by name, or by the file extension of path when
+// kind is empty.
+func openStore(path, kind string) (Store, error) {
+	if kind == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".db", ".sqlite", ".sqlite3":
+			kind = "sqlite"
+		default:
+			kind = "json"
+		}
+	}
+	switch kind {
+	case "json":
+		return NewJSONStore(path), nil
+	case "sqlite":
+		return NewSQLiteStore(path)
+	}
+	return nil, fmt.Errorf("unknown store %q (json, sqlite)", kind)
+}
+
+// JSONStore keeps the whole tree in a single JSON file. Every save is first
+// appended to a write-ahead journal next to the file, then the snapshot is
+// replaced atomically and the previous one is kept as the last good copy.
+type JSONStore struct {
+	Path    string
+	journal *journal
+	// corrupt is set when Load found an unreadable file, saving is refused
+	// so it is never overwritten before the user chose how to recover.
+	corrupt bool
+	// seen is the hash of the file as last loaded or written.
+	seen [sha256.Size]byte
+	// revision is the file's revision as last loaded or written, saves are
+	// refused once the file moved past it.
+	revision int64
+	// lock serialises sessions sharing the file, see lockPath.
+	lock *flock.Flock
+}
+
+func NewJSONStore(path string) *JSONStore {
+	return &JSONStore{Path: path, lock: flock.New(path + ".lock")}
+}
+
+func (s *JSONStore) journalPath() string  { return s.Path + ".journal" }
+func (s *JSONStore) snapshotPath() string { return s.Path + ".bak" }
+
+// fileRevision reads the revision of the file on disk, 0 when there is none.
+func fileRevision(path string) (int64, error) {
+	data, err := readFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	var doc struct {
+		Revision int64 `json:"revision"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return 0, &CorruptError{Path: path, Err: err}
+	}
+	return doc.Revision, nil
+}
+
+func (s *JSONStore) Load() (*TaskFolder, error) {
+	s.corrupt = false
+	j, err := openJournal(s.journalPath())
+	if err != nil {
+		return nil, err
+	}
+	s.journal = j
+	if err := s.lock.RLock(); err != nil {
+		return nil, fmt.Errorf("error locking %s: %w", s.Path, err)
+	}
+	root, version, err := loadIntoTaskFolder(s.Path)
+	if err == nil {
+		s.revision, err = fileRevision(s.Path)
+	}
+	if err == nil {
+		s.seen, err = hashFile(s.Path)
+	}
+	s.lock.Unlock()
+	if err != nil {
+		var corrupt *CorruptError
+		if errors.As(err, &corrupt) {
+			s.corrupt = true
+		}
+		return nil, err
+	}
+	pending, err := j.pending()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range pending {
+		if root, err = applyJournalEntry(root, e); err != nil {
+			return nil, err
+		}
+	}
+	root.Parent = nil
+	reconstructFolderFromJSON(root)
+	if version < currentSchemaVersion {
+		if err := s.backupOriginal(version); err != nil {
+			return nil, err
+		}
+	}
+	if assignMissingIDs(root, time.Now()) || len(pending) > 0 || version < currentSchemaVersion {
+		// the snapshot was stale, in an older format or missing IDs, rewrite it
+		if err := s.Save(root); err != nil {
+			return nil, err
+		}
+	}
+	if version < currentSchemaVersion {
+		// older entries would be migrated again on every replay
+		if err := s.journal.compact(root); err != nil {
+			return nil, err
+		}
+	}
+	return root, nil
+}
+
+func (s *JSONStore) Changed() (bool, error) {
+	sum, err := hashFile(s.Path)
+	if err != nil {
+		return false, err
+	}
+	return sum != s.seen, nil
+}
+
+func hashFile(path string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return [sha256.Size]byte{}, nil
+	}
+	if err != nil {
+		return [sha256.Size]byte{}, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return sha256.Sum256(data), nil
+}
+
+func (s *JSONStore) Save(root *TaskFolder) error {
+	return s.write(root, "save", nil, root)
+}
+
+func (s *JSONStore) SaveChange(root *TaskFolder, change Change) error {
+	folder := change.Folder
+	if change.From != nil {
+		// a move touches two folders, journal the subtree holding both
+		folder = commonAncestor(change.From, change.Folder)
+	}
+	if change.Kind.touchesTrash() {
+		folder = root
+	}
+	path, err := folderPath(folder)
+	if err != nil {
+		return err
+	}
+	return s.write(root, change.Kind.String(), path, folder)
+}
+
+func (s *JSONStore) write(root *TaskFolder, op string, path []int, folder *TaskFolder) error {
+	if s.corrupt {
+		return fmt.Errorf("refusing to overwrite corrupt %s, recover it first", s.Path)
+	}
+	if err := s.lock.Lock(); err != nil {
+		return fmt.Errorf("error locking %s: %w", s.Path, err)
+	}
+	defer s.lock.Unlock()
+	revision, err := fileRevision(s.Path)
+	if err != nil {
+		return err
+	}
+	if revision != s.revision {
+		return &StaleError{Path: s.Path}
+	}
+	// git can swap the file for one that counts its revisions separately
+	if sum, err := hashFile(s.Path); err != nil {
+		return err
+	} else if sum != s.seen {
+		return &StaleError{Path: s.Path}
+	}
+	if s.journal == nil {
+		j, err := openJournal(s.journalPath())
+		if err != nil {
+			return err
+		}
+		s.journal = j
+	}
+	// without a base the journal can't rebuild the tree on its own
+	if !s.journal.hasBase {
+		op, path, folder = journalBase, nil, root
+	}
+	if _, err := s.journal.append(op, path, folder); err != nil {
+		return err
+	}
+	if err := s.keepSnapshot(); err != nil {
+		return err
+	}
+	if err := MarshalToFile(s.Path, newFileDoc(root, revision+1)); err != nil {
+		return err
+	}
+	s.revision = revision + 1
+	sum, err := hashFile(s.Path)
+	if err != nil {
+		return err
+	}
+	s.seen = sum
+	if _, err := s.journal.append(journalCheckpoint, nil, nil); err != nil {
+		return err
+	}
+	if s.journal.count > journalCompactAt {
+		return s.journal.compact(root)
+	}
+	return nil
+}
+
+// keepSnapshot hard-links the current file as the last good snapshot before
+// it gets replaced.
+func (s *JSONStore) keepSnapshot() error {
+	if _, err := os.Stat(s.Path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	bak := s.snapshotPath()
+	if err := os.Remove(bak); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error rotating snapshot: %w", err)
+	}
+	if err := os.Link(s.Path, bak); err != nil {
+		data, rerr := os.ReadFile(s.Path)
+		if rerr != nil {
+			return fmt.Errorf("error keeping snapshot: %w", rerr)
+		}
+		return writeFileAtomic(bak, data, activeVault.filePerm())
+	}
+	return nil
+}
+
+// backupOriginal keeps a copy of a file written in an older schema before it
+// gets upgraded.
+func (s *JSONStore) backupOriginal(version int) error {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return fmt.Errorf("error backing up %s: %w", s.Path, err)
+	}
+	bak := fmt.Sprintf("%s.v%d.bak", s.Path, version)
+	if _, err := os.Stat(bak); err == nil {
+		bak = fmt.Sprintf("%s.v%d-%s.bak", s.Path, version, time.Now().Format("20060102-150405"))
+	}
+	if err := writeFileAtomic(bak, data, activeVault.filePerm()); err != nil {
+		return fmt.Errorf("error backing up %s: %w", s.Path, err)
+	}
+	return nil
+}
+
+// RecoverFromJournal rebuilds the tree from the journal alone.
+func (s *JSONStore) RecoverFromJournal() (*TaskFolder, error) {
+	j, err := openJournal(s.journalPath())
+	if err != nil {
+		return nil, err
+	}
+	s.journal = j
+	return s.recover(j.rebuild)
+}
+
+// RecoverFromSnapshot loads the last good snapshot kept by the previous save.
+func (s *JSONStore) RecoverFromSnapshot() (*TaskFolder, error) {
+	return s.recover(func() (*TaskFolder, error) {
+		if _, err := os.Stat(s.snapshotPath()); err != nil {
+			return nil, fmt.Errorf("no snapshot to recover from: %w", err)
+		}
+		root, _, err := loadIntoTaskFolder(s.snapshotPath())
+		return root, err
+	})
+}
+
+// recover moves the corrupt file aside and saves the recovered tree in its
+// place.
+func (s *JSONStore) recover(load func() (*TaskFolder, error)) (*TaskFolder, error) {
+	root, err := load()
+	if err != nil {
+		return nil, err
+	}
+	root.Parent = nil
+	reconstructFolderFromJSON(root)
+	aside := fmt.Sprintf("%s.corrupt-%s", s.Path, time.Now().Format("20060102-150405"))
+	if err := os.Rename(s.Path, aside); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error moving corrupt file aside: %w", err)
+	}
+	s.corrupt = false
+	if err := s.Save(root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
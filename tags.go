@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"go.dalton.dog/bubbleup"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// parseTags splits what was typed in the tags field on commas and spaces,
+// dropping duplicates.
+func parseTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.FieldsFunc(s, func(c rune) bool { return c == ',' || c == ' ' }) {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+var tagColors = []string{"33", "36", "70", "99", "135", "166", "172", "204"}
+
+// tagChip renders a tag in a colour of its own, the same every time.
+func tagChip(tag string) string {
+	h := fnv.New32a()
+	h.Write([]byte(tag))
+	color := tagColors[h.Sum32()%uint32(len(tagColors))]
+	return lipgloss.NewStyle().Foreground(lipgloss.Color("0")).Background(lipgloss.Color(color)).Padding(0, 1).Render(tag)
+}
+
+func tagChips(tags []string) string {
+	var chips []string
+	for _, tag := range tags {
+		chips = append(chips, tagChip(tag))
+	}
+	return strings.Join(chips, " ")
+}
+
+func itemTags(item list.Item) []string {
+	switch v := item.(type) {
+	case *Task:
+		return v.Tags
+	case *TaskFolder:
+		return v.Tags
+	}
+	return nil
+}
+
+// tagCounts counts how many tasks and folders carry each tag, leaving out
+// the trash.
+func tagCounts(root *TaskFolder) map[string]int {
+	counts := map[string]int{}
+	var walk func(f *TaskFolder)
+	walk = func(f *TaskFolder) {
+		for _, tag := range f.Tags {
+			counts[tag]++
+		}
+		for _, t := range f.ChildrenTasks {
+			for _, tag := range t.Tags {
+				counts[tag]++
+			}
+		}
+		for _, child := range f.ChildrenTaskFolders {
+			walk(child)
+		}
+	}
+	walk(root)
+	return counts
+}
+
+// knownTags are the tags in use, sorted.
+func knownTags(root *TaskFolder) []string {
+	var tags []string
+	for tag := range tagCounts(root) {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// suggestTags offers to complete the last tag being typed with the known
+// ones, tab taking the suggestion.
+func (ui *CreateNewUI) suggestTags() {
+	value := ui.taskTagsInput.Value()
+	last := value[strings.LastIndexAny(value, ", ")+1:]
+	ui.tagMatches = nil
+	var suggestions []string
+	if last != "" {
+		typed := parseTags(value)
+		for _, tag := range ui.knownTags {
+			if strings.HasPrefix(tag, last) && tag != last && !slices.Contains(typed, tag) {
+				ui.tagMatches = append(ui.tagMatches, tag)
+				suggestions = append(suggestions, value[:len(value)-len(last)]+tag)
+			}
+		}
+	}
+	ui.taskTagsInput.SetSuggestions(suggestions)
+}
+
+// tagHint lists the known tags matching what is being typed.
+func (ui *CreateNewUI) tagHint() string {
+	if !ui.taskTagsInput.Focused() || len(ui.tagMatches) == 0 {
+		return ""
+	}
+	return "tab completes: " + tagChips(ui.tagMatches)
+}
+
+// tagEntry is a tag in the tag browser.
+type tagEntry struct {
+	Name  string
+	Count int
+}
+
+func (t *tagEntry) FilterValue() string { return t.Name }
+func (t *tagEntry) Title() string       { return tagChip(t.Name) }
+func (t *tagEntry) Description() string {
+	if t.Count == 1 {
+		return "1 item"
+	}
+	return fmt.Sprintf("%d items", t.Count)
+}
+
+// showTags lists every tag in use, most used first.
+func (m *model) showTags() tea.Cmd {
+	counts := tagCounts(m.rootFolder)
+	if len(counts) == 0 {
+		return m.alert.NewAlertCmd(bubbleup.InfoKey, "No tags yet, add some with e")
+	}
+	var entries []*tagEntry
+	for tag, n := range counts {
+		entries = append(entries, &tagEntry{Name: tag, Count: n})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	var items []list.Item
+	for _, e := range entries {
+		items = append(items, e)
+	}
+	m.tagMode, m.openTag = true, ""
+	m.statusString = "Tags: enter lists what carries one, esc leaves"
+	m.list.SetItems(items)
+	m.list.Title = fmt.Sprintf("Tags \n %d in use", len(items))
+	m.list.Select(0)
+	return nil
+}
+
+// taggedItems are the folders and tasks carrying tag wherever they are, in
+// tree order.
+func taggedItems(root *TaskFolder, tag string) []list.Item {
+	var out []list.Item
+	var walk func(f *TaskFolder)
+	walk = func(f *TaskFolder) {
+		for _, child := range f.ChildrenTaskFolders {
+			if slices.Contains(child.Tags, tag) {
+				out = append(out, child)
+			}
+		}
+		for _, t := range f.ChildrenTasks {
+			if slices.Contains(t.Tags, tag) {
+				out = append(out, t)
+			}
+		}
+		for _, child := range f.ChildrenTaskFolders {
+			walk(child)
+		}
+	}
+	walk(root)
+	return out
+}
+
+// showTagged lists everything carrying tag.
+func (m *model) showTagged(tag string) {
+	items := taggedItems(m.rootFolder, tag)
+	m.openTag = tag
+	m.statusString = "enter opens the item's folder, esc goes back to the tags"
+	m.list.SetItems(items)
+	m.list.Title = fmt.Sprintf("Tagged %s \n %d items", tag, len(items))
+	m.list.Select(0)
+}
+
+// updateTags handles a key in the tag browser, reporting whether it did.
+func (m *model) updateTags(msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "enter":
+		switch v := m.list.SelectedItem().(type) {
+		case *tagEntry:
+			m.showTagged(v.Name)
+		case *Task:
+			m.tagMode = false
+			m.recreateListAt(v.ParentFolder, v.ID)
+			m.statusString = "Opened " + v.ParentFolder.returnPath()
+		case *TaskFolder:
+			m.tagMode = false
+			m.recreateList(v, 0)
+		}
+		return nil, true
+	case "esc", "#":
+		if m.openTag != "" && msg.String() == "esc" {
+			return m.showTags(), true
+		}
+		m.tagMode = false
+		m.statusString = "Left the tags"
+		m.recreateList(m.currentFolder, 0)
+		return nil, true
+	case "ctrl+c", "q":
+		return tea.Quit, true
+	}
+	return nil, false
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"go.dalton.dog/bubbleup"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TimeEntry is a stretch of time spent on a task. End is zero while its
+// timer runs.
+type TimeEntry struct {
+	ID    string
+	Start time.Time
+	End   time.Time
+}
+
+func (e *TimeEntry) running() bool { return e.End.IsZero() }
+
+func (e *TimeEntry) duration(now time.Time) time.Duration {
+	if e.running() {
+		return now.Sub(e.Start)
+	}
+	return e.End.Sub(e.Start)
+}
+
+func (e *TimeEntry) FilterValue() string { return e.Start.Local().Format("02/01/06") }
+func (e *TimeEntry) Title() string {
+	if e.running() {
+		return "⏱ running since " + e.Start.Local().Format("02/01/06 15:04")
+	}
+	return e.Start.Local().Format("02/01/06 15:04") + " – " + e.End.Local().Format("15:04")
+}
+func (e *TimeEntry) Description() string { return formatDuration(e.duration(time.Now())) }
+
+// formatDuration renders d in hours and minutes, e.g. "1h05m" or "12m".
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// formatClock renders d as a running clock, e.g. "01:02:03".
+func formatClock(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
+
+// tracked is the time recorded on t, a running timer up to now.
+func (t *Task) tracked(now time.Time) time.Duration {
+	var total time.Duration
+	for i := range t.TimeEntries {
+		total += t.TimeEntries[i].duration(now)
+	}
+	return total
+}
+
+// trackedDone is the time of t's finished entries, what folders count.
+func (t *Task) trackedDone() time.Duration {
+	var total time.Duration
+	for _, e := range t.TimeEntries {
+		if !e.running() {
+			total += e.End.Sub(e.Start)
+		}
+	}
+	return total
+}
+
+func (t *Task) runningEntry() *TimeEntry {
+	for i := range t.TimeEntries {
+		if t.TimeEntries[i].running() {
+			return &t.TimeEntries[i]
+		}
+	}
+	return nil
+}
+
+// effortLine compares the time spent on t with its estimate, e.g.
+// "⏱ 1h20m of 2h00m", empty when there is neither.
+func (t *Task) effortLine(now time.Time) string {
+	spent := t.tracked(now)
+	if spent == 0 && t.Estimate == 0 && t.runningEntry() == nil {
+		return ""
+	}
+	s := "⏱ " + formatDuration(spent)
+	if t.Estimate > 0 {
+		s += " of " + formatDuration(t.Estimate)
+		if spent > t.Estimate {
+			s = renderWarning(s + ", over estimate")
+		}
+	}
+	if e := t.runningEntry(); e != nil {
+		s += " ● " + formatClock(e.duration(now))
+	}
+	return s
+}
+
+// printEffort is the time spent in a folder against its estimates, empty
+// when nothing was tracked or estimated.
+func (s Status) printEffort() string {
+	switch {
+	case s.Estimate > 0:
+		return "⏱ " + formatDuration(s.Spent) + " of " + formatDuration(s.Estimate)
+	case s.Spent > 0:
+		return "⏱ " + formatDuration(s.Spent)
+	}
+	return ""
+}
+
+// runningTask is the task whose timer runs, nil when none does.
+func runningTask(root *TaskFolder) *Task {
+	for _, t := range indexTasks(root) {
+		if t.runningEntry() != nil {
+			return t
+		}
+	}
+	return nil
+}
+
+// estimate reads the estimate field of the form, zero when it is empty.
+func (ui *CreateNewUI) estimate() (time.Duration, error) {
+	value := strings.TrimSpace(ui.taskEstimateInput.Value())
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid estimate, e.g. 45m or 2h30m")
+	}
+	return d.Round(time.Minute), nil
+}
+
+func formEstimate(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(d.String(), "0s")
+}
+
+// timerTickMsg redraws the running clock.
+type timerTickMsg time.Time
+
+// scheduleTimerTick keeps the clock going while a timer runs, making sure
+// only one tick is pending at a time.
+func (m *model) scheduleTimerTick() tea.Cmd {
+	if m.timerTicking || m.rootFolder == nil || runningTask(m.rootFolder) == nil {
+		return nil
+	}
+	m.timerTicking = true
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg { return timerTickMsg(t) })
+}
+
+// timerLine is the running clock shown above the status, empty when no
+// timer runs.
+func (m *model) timerLine() string {
+	if m.rootFolder == nil {
+		return ""
+	}
+	t := runningTask(m.rootFolder)
+	if t == nil {
+		return ""
+	}
+	return renderNotice(fmt.Sprintf("⏱ %s %s", t.Name, formatClock(t.runningEntry().duration(time.Now())))) + "\n"
+}
+
+// editTimeEntries replaces the time entries of t with what change makes of a
+// copy of them, as one undoable edit.
+func (m *model) editTimeEntries(t *Task, change func(entries []TimeEntry) []TimeEntry) tea.Cmd {
+	edit := &editCommand{ID: t.ID, Before: fieldsOf(t)}
+	edit.After = edit.Before
+	edit.After.TimeEntries = toTimeDocs(change(slices.Clone(t.TimeEntries)))
+	return m.execute(edit)
+}
+
+// toggleTimer starts a timer on t, stopping the one running elsewhere, or
+// stops t's timer and records the entry.
+func (m *model) toggleTimer(t *Task) tea.Cmd {
+	now := time.Now()
+	if e := t.runningEntry(); e != nil {
+		id, spent := e.ID, e.duration(now)
+		cmd := m.editTimeEntries(t, func(entries []TimeEntry) []TimeEntry {
+			for i := range entries {
+				if entries[i].ID == id {
+					entries[i].End = now
+				}
+			}
+			return entries
+		})
+		m.statusString = fmt.Sprintf("Stopped %s after %s", t.Name, formatDuration(spent))
+		return cmd
+	}
+	var cmds []tea.Cmd
+	if other := runningTask(m.rootFolder); other != nil {
+		cmds = append(cmds, m.toggleTimer(other))
+	}
+	cmds = append(cmds, m.editTimeEntries(t, func(entries []TimeEntry) []TimeEntry {
+		return append(entries, TimeEntry{ID: newID(), Start: now})
+	}))
+	m.statusString = "Started a timer on " + t.Name + ", T stops it"
+	return tea.Batch(cmds...)
+}
+
+// timeTask is the task whose time entries are on screen, nil once it is gone.
+func (m *model) timeTask() *Task {
+	return findTask(m.rootFolder, m.timeTaskID)
+}
+
+// showTimeEntries drills into the time entries of t.
+func (m *model) showTimeEntries(t *Task) tea.Cmd {
+	m.timeMode, m.timeTaskID = true, t.ID
+	m.statusString = "Time entries: n adds, e edits, d removes, T starts/stops the timer, esc leaves"
+	m.recreateTimeList(0)
+	return nil
+}
+
+// recreateTimeList lists the time entries of the open task again, leaving
+// when the task no longer exists.
+func (m *model) recreateTimeList(selected int) {
+	t := m.timeTask()
+	if t == nil {
+		m.leaveTimeEntries()
+		return
+	}
+	var items []list.Item
+	for i := range t.TimeEntries {
+		items = append(items, &t.TimeEntries[i])
+	}
+	m.list.SetItems(items)
+	title := fmt.Sprintf("%s > %s \n %s tracked", t.ParentFolder.returnPath(), t.Name, formatDuration(t.tracked(time.Now())))
+	if t.Estimate > 0 {
+		title += " of " + formatDuration(t.Estimate) + " estimated"
+	}
+	m.list.Title = title
+	m.list.Select(selected)
+}
+
+// leaveTimeEntries goes back to the task's folder with the task selected.
+func (m *model) leaveTimeEntries() {
+	m.timeMode, m.timeInputActive = false, false
+	t := m.timeTask()
+	if t == nil {
+		m.recreateList(m.currentFolder, 0)
+		return
+	}
+	m.recreateListAt(t.ParentFolder, t.ID)
+}
+
+// parseTimeEntry reads an entry typed as its start and how long it took,
+// e.g. "18/10/26 09:00 1h30m". Without a duration the entry is running.
+func parseTimeEntry(s string) (start time.Time, took time.Duration, err error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 && len(fields) != 3 {
+		return start, 0, fmt.Errorf("type the start and how long, e.g. 18/10/26 09:00 1h30m")
+	}
+	if start, err = time.ParseInLocation("02/01/06 15:04", fields[0]+" "+fields[1], time.Local); err != nil {
+		return start, 0, fmt.Errorf("invalid start, use DD/MM/YY HH:MM")
+	}
+	if len(fields) == 3 {
+		if took, err = time.ParseDuration(fields[2]); err != nil || took <= 0 {
+			return start, 0, fmt.Errorf("invalid duration %q, e.g. 45m or 1h30m", fields[2])
+		}
+	}
+	return start, took, nil
+}
+
+// startTimeInput asks for a new entry, or new times for the entry with the
+// given ID.
+func (m *model) startTimeInput(id, value string) {
+	m.timeInputActive, m.timeEditID = true, id
+	m.timeInput.SetValue(value)
+	m.timeInput.Focus()
+}
+
+// entryValue is an entry as typed in the input.
+func entryValue(e *TimeEntry) string {
+	s := e.Start.Local().Format("02/01/06 15:04")
+	if !e.running() {
+		s += " " + formEstimate(e.End.Sub(e.Start).Round(time.Minute))
+	}
+	return s
+}
+
+// updateTimeEntries handles a key in the time entries, reporting whether it
+// did. Anything else goes on to the list.
+func (m *model) updateTimeEntries(msg tea.KeyMsg) (tea.Cmd, bool) {
+	index := m.list.Index()
+	t := m.timeTask()
+	if t == nil {
+		m.leaveTimeEntries()
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, "That task no longer exists"), true
+	}
+	if m.timeInputActive {
+		switch msg.String() {
+		case "enter":
+			start, took, err := parseTimeEntry(m.timeInput.Value())
+			if err != nil {
+				return m.alert.NewAlertCmd(bubbleup.ErrorKey, err.Error()), true
+			}
+			m.timeInputActive = false
+			m.timeInput.Blur()
+			entry := TimeEntry{ID: m.timeEditID, Start: start}
+			if took > 0 {
+				entry.End = start.Add(took)
+			} else if e := t.runningEntry(); e != nil && e.ID != entry.ID {
+				return m.alert.NewAlertCmd(bubbleup.ErrorKey, "A timer already runs on "+t.Name+", give the entry a duration"), true
+			}
+			var cmd tea.Cmd
+			if entry.ID == "" {
+				entry.ID = newID()
+				cmd = m.editTimeEntries(t, func(entries []TimeEntry) []TimeEntry { return append(entries, entry) })
+				index = len(t.TimeEntries) - 1
+			} else {
+				cmd = m.editTimeEntries(t, func(entries []TimeEntry) []TimeEntry {
+					for i := range entries {
+						if entries[i].ID == entry.ID {
+							entries[i] = entry
+						}
+					}
+					return entries
+				})
+			}
+			m.recreateTimeList(index)
+			return cmd, true
+		case "esc":
+			m.timeInputActive = false
+			m.timeInput.Blur()
+			return nil, true
+		}
+		var cmd tea.Cmd
+		m.timeInput, cmd = m.timeInput.Update(msg)
+		return cmd, true
+	}
+	entry, _ := m.list.SelectedItem().(*TimeEntry)
+	switch msg.String() {
+	case "n":
+		m.startTimeInput("", time.Now().Add(-30*time.Minute).Format("02/01/06 15:04")+" 30m")
+		return nil, true
+	case "e":
+		if entry != nil {
+			m.startTimeInput(entry.ID, entryValue(entry))
+		}
+		return nil, true
+	case "d":
+		if entry == nil {
+			return nil, true
+		}
+		id := entry.ID
+		cmd := m.editTimeEntries(t, func(entries []TimeEntry) []TimeEntry {
+			return slices.DeleteFunc(entries, func(e TimeEntry) bool { return e.ID == id })
+		})
+		m.recreateTimeList(max(index-1, 0))
+		return cmd, true
+	case "T":
+		cmd := m.toggleTimer(t)
+		m.recreateTimeList(len(t.TimeEntries) - 1)
+		return cmd, true
+	case "u":
+		cmd := m.undo()
+		m.recreateTimeList(index)
+		return cmd, true
+	case "ctrl+r":
+		cmd := m.redo()
+		m.recreateTimeList(index)
+		return cmd, true
+	case "esc", "E", "b":
+		m.leaveTimeEntries()
+		m.statusString = "Left the time entries"
+		return nil, true
+	case "ctrl+c", "q":
+		return tea.Quit, true
+	}
+	return nil, false
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TrashedItem is a deleted task or folder, kept on the root until it is
+// restored or purged. It remembers where it was so it can go back there.
+type TrashedItem struct {
+	Task       *Task
+	Folder     *TaskFolder
+	ParentID   string
+	ParentPath string
+	Index      int
+	DeletedAt  time.Time
+}
+
+func newTrashedItem(parent *TaskFolder, item list.Item, index int, now time.Time) *TrashedItem {
+	t := &TrashedItem{ParentID: parent.ID, ParentPath: namePath(parent), Index: index, DeletedAt: now}
+	switch v := item.(type) {
+	case *Task:
+		v.ParentFolder = nil
+		t.Task = v
+	case *TaskFolder:
+		v.Parent = nil
+		t.Folder = v
+	}
+	return t
+}
+
+func (t *TrashedItem) item() list.Item {
+	if t.Task != nil {
+		return t.Task
+	}
+	return t.Folder
+}
+
+func (t *TrashedItem) FilterValue() string { return itemName(t.item()) }
+func (t *TrashedItem) Title() string {
+	if t.Folder != nil {
+		return t.Folder.Title()
+	}
+	return "📝 " + t.Task.Title()
+}
+func (t *TrashedItem) Description() string {
+	return fmt.Sprintf("from %s, deleted %s", t.ParentPath, t.DeletedAt.Format("02/01/06 15:04"))
+}
+
+// namePath is the readable location of f, e.g. "Root > Work > Sprint".
+func namePath(f *TaskFolder) string {
+	var parts []string
+	for ; f != nil && f.Parent != nil; f = f.Parent {
+		parts = append([]string{strings.TrimPrefix(f.Name, "📁 ")}, parts...)
+	}
+	return strings.Join(append([]string{"Root"}, parts...), " > ")
+}
+
+func findTrashed(root *TaskFolder, id string) int {
+	for i, t := range root.Trash {
+		if itemID(t.item()) == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// takeFromTrash removes the entry for id from the trash and returns it.
+func takeFromTrash(root *TaskFolder, id string) (*TrashedItem, error) {
+	i := findTrashed(root, id)
+	if i < 0 {
+		return nil, fmt.Errorf("item %s is no longer in the trash", id)
+	}
+	var t *TrashedItem
+	root.Trash, t = SlicePop(root.Trash, i)
+	return t, nil
+}
+
+// restoreFromTrash puts a trashed item back at its old position, or at the
+// top level when its folder is gone.
+func restoreFromTrash(root *TaskFolder, id string) (*TaskFolder, list.Item, error) {
+	t, err := takeFromTrash(root, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	parent := findFolder(root, t.ParentID)
+	if parent == nil {
+		parent = root
+	}
+	item := t.item()
+	insertItem(parent, t.Index, item)
+	return parent, item, nil
+}
+
+// expiredTrash returns the entries deleted more than days ago, none when days
+// is 0.
+func expiredTrash(root *TaskFolder, days int, now time.Time) []*TrashedItem {
+	if days <= 0 {
+		return nil
+	}
+	var out []*TrashedItem
+	for _, t := range root.Trash {
+		if now.Sub(t.DeletedAt) > time.Duration(days)*24*time.Hour {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// purgeTrash drops entries from the trash for good. Purging can't be undone.
+func purgeTrash(root *TaskFolder, entries []*TrashedItem) Change {
+	change := Change{Kind: ChangePurge, Folder: root}
+	for _, t := range entries {
+		if i := findTrashed(root, itemID(t.item())); i >= 0 {
+			root.Trash, _ = SlicePop(root.Trash, i)
+			change.Items = append(change.Items, t.item())
+		}
+	}
+	return change
+}
+
+type restoreCommand struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	ParentID   string    `json:"parent_id"`
+	ParentPath string    `json:"parent_path"`
+	Index      int       `json:"index"`
+	DeletedAt  time.Time `json:"deleted_at"`
+}
+
+func newRestoreCommand(t *TrashedItem) *restoreCommand {
+	return &restoreCommand{ID: itemID(t.item()), Name: itemName(t.item()), ParentID: t.ParentID, ParentPath: t.ParentPath, Index: t.Index, DeletedAt: t.DeletedAt}
+}
+
+func (c *restoreCommand) apply(root *TaskFolder) (Change, error) {
+	parent, item, err := restoreFromTrash(root, c.ID)
+	if err != nil {
+		return Change{}, err
+	}
+	return Change{Kind: ChangeRestore, Folder: parent, Items: []list.Item{item}}, nil
+}
+
+func (c *restoreCommand) revert(root *TaskFolder) (Change, error) {
+	if findTrashed(root, c.ID) >= 0 {
+		return Change{}, fmt.Errorf("item %s is already in the trash", c.ID)
+	}
+	var parent *TaskFolder
+	if t := findTask(root, c.ID); t != nil {
+		parent = t.ParentFolder
+	} else if f := findFolder(root, c.ID); f != nil && f.Parent != nil {
+		parent = f.Parent
+	} else {
+		return Change{}, fmt.Errorf("item %s no longer exists", c.ID)
+	}
+	item, _, err := removeItem(parent, c.ID)
+	if err != nil {
+		return Change{}, err
+	}
+	// the folder it was restored into may be a fallback, keep the original
+	trashed := newTrashedItem(parent, item, c.Index, c.DeletedAt)
+	trashed.ParentID, trashed.ParentPath = c.ParentID, c.ParentPath
+	root.Trash = append(root.Trash, trashed)
+	return Change{Kind: ChangeTrash, Folder: parent, Items: []list.Item{item}}, nil
+}
+
+func (c *restoreCommand) String() string { return fmt.Sprintf("restore %q", c.Name) }
+
+// recreateTrashList shows the trash, most recently deleted first.
+func (m *model) recreateTrashList(selectedItem int) {
+	trashed := make([]*TrashedItem, len(m.rootFolder.Trash))
+	copy(trashed, m.rootFolder.Trash)
+	sort.SliceStable(trashed, func(i, j int) bool { return trashed[i].DeletedAt.After(trashed[j].DeletedAt) })
+	var items []list.Item
+	for _, t := range trashed {
+		items = append(items, t)
+	}
+	m.list.SetItems(items)
+	m.list.Title = fmt.Sprintf("Trash \n %d items", len(items))
+	m.list.Select(selectedItem)
+}
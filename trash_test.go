@@ -0,0 +1,119 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+func TestRestoreFromTrash(t *testing.T) {
+	tests := []struct {
+		name       string
+		id, parent string
+		before     func(root *TaskFolder)
+		wantParent string
+		wantIndex  int
+	}{
+		{name: "task back in its folder", id: "report", parent: "work", wantParent: "work", wantIndex: 0},
+		{name: "folder back at its position", id: "work", parent: "root", wantParent: "root", wantIndex: 0},
+		{
+			name:   "task back at its index",
+			id:     "report",
+			parent: "work",
+			before: func(root *TaskFolder) {
+				work := findFolder(root, "work")
+				insertItem(work, -1, &Task{ID: "later", Name: "Later"})
+			},
+			wantParent: "work",
+			wantIndex:  0,
+		},
+		{
+			name:   "task to the top level when its folder is gone",
+			id:     "report",
+			parent: "work",
+			before: func(root *TaskFolder) {
+				removeItem(root, "work")
+			},
+			wantParent: "root",
+			wantIndex:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := sampleTree()
+			var item list.Item
+			if task := findTask(root, tt.id); task != nil {
+				item = task
+			} else {
+				item = findFolder(root, tt.id)
+			}
+			c := newDeleteCommand(findFolder(root, tt.parent), []list.Item{item})
+			if _, err := c.apply(root); err != nil {
+				t.Fatal(err)
+			}
+			if tt.before != nil {
+				tt.before(root)
+			}
+			got, restored, err := restoreFromTrash(root, tt.id)
+			if err != nil {
+				t.Fatalf("restoreFromTrash() error = %v", err)
+			}
+			if got.ID != tt.wantParent {
+				t.Errorf("restored into %s, want %s", got.ID, tt.wantParent)
+			}
+			var index int
+			switch v := restored.(type) {
+			case *Task:
+				index = slices.Index(got.ChildrenTasks, v)
+			case *TaskFolder:
+				index = slices.Index(got.ChildrenTaskFolders, v)
+			}
+			if index != tt.wantIndex {
+				t.Errorf("restored at %d, want %d", index, tt.wantIndex)
+			}
+			if len(root.Trash) != 0 {
+				t.Errorf("trash = %d entries, want none", len(root.Trash))
+			}
+		})
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	now := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		days int
+		want []string
+	}{
+		{name: "auto-purge off", days: 0},
+		{name: "older than a week", days: 7, want: []string{"report"}},
+		{name: "older than a day", days: 1, want: []string{"report", "milk"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := sampleTree()
+			work := findFolder(root, "work")
+			report, milk := findTask(root, "report"), findTask(root, "milk")
+			removeItem(work, "report")
+			removeItem(root, "milk")
+			root.Trash = []*TrashedItem{
+				newTrashedItem(work, report, 0, now.Add(-10*24*time.Hour)),
+				newTrashedItem(root, milk, 0, now.Add(-2*24*time.Hour)),
+				newTrashedItem(root, &Task{ID: "fresh", Name: "Fresh"}, 0, now.Add(-time.Hour)),
+			}
+			change := purgeTrash(root, expiredTrash(root, tt.days, now))
+			var got []string
+			for _, item := range change.Items {
+				got = append(got, itemID(item))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("purged %v, want %v", got, tt.want)
+			}
+			if len(root.Trash) != 3-len(tt.want) {
+				t.Errorf("trash = %d entries, want %d", len(root.Trash), 3-len(tt.want))
+			}
+		})
+	}
+}
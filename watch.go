@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/fsnotify/fsnotify"
+	"go.dalton.dog/bubbleup"
+	"path/filepath"
+	"time"
+)
+
+// watchDebounce groups the bursts of events editors (and atomic saves)
+// produce into a single reload.
+const watchDebounce = 200 * time.Millisecond
+
+// fileChangedMsg names the watcher it came from, so one still in flight from
+// a workspace that was switched away from can be told apart.
+type fileChangedMsg struct {
+	watcher *fileWatcher
+}
+
+// fileWatcher watches the directory holding the task file, since editors and
+// our own saves replace the file instead of writing to it.
+type fileWatcher struct {
+	watcher *fsnotify.Watcher
+	changes chan struct{}
+	done    chan struct{}
+}
+
+func newFileWatcher(path string) (*fileWatcher, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error starting file watcher: %w", err)
+	}
+	if err := w.Add(filepath.Dir(abs)); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("error watching %s: %w", path, err)
+	}
+	fw := &fileWatcher{watcher: w, changes: make(chan struct{}, 1), done: make(chan struct{})}
+	go fw.run(filepath.Base(abs))
+	return fw, nil
+}
+
+func (fw *fileWatcher) run(name string) {
+	var timer *time.Timer
+	for {
+		select {
+		case e, ok := <-fw.watcher.Events:
+			if !ok {
+				return
+			}
+			// SQLite commits land in the -wal file first
+			if base := filepath.Base(e.Name); base != name && base != name+"-wal" {
+				continue
+			}
+			if e.Op == fsnotify.Chmod {
+				continue
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(watchDebounce, fw.notify)
+		case _, ok := <-fw.watcher.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+func (fw *fileWatcher) notify() {
+	select {
+	case fw.changes <- struct{}{}:
+	default:
+	}
+}
+
+// wait blocks until the next change, it has to be re-issued after every
+// fileChangedMsg. It gives up once the watcher is closed.
+func (fw *fileWatcher) wait() tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case <-fw.changes:
+			return fileChangedMsg{watcher: fw}
+		case <-fw.done:
+			return nil
+		}
+	}
+}
+
+func (fw *fileWatcher) Close() error {
+	close(fw.done)
+	return fw.watcher.Close()
+}
+
+// externalChange decides what to do after the watcher saw the file change.
+// Our own saves trigger it too, the store tells them apart.
+func (m *model) externalChange() tea.Cmd {
+	wait := m.watcher.wait()
+	changed, err := m.store.Changed()
+	if err != nil {
+		return tea.Batch(wait, m.alert.NewAlertCmd(bubbleup.ErrorKey, err.Error()))
+	}
+	if !changed || m.merge != nil {
+		return wait
+	}
+	if m.settings.OnExternalChange == "prompt" {
+		m.changePrompt = true
+		m.statusString = "Tasks changed on disk: (r) reload them / (k) keep mine and overwrite / (esc) decide later"
+		return wait
+	}
+	return tea.Batch(wait, m.reload(), m.alert.NewAlertCmd(bubbleup.InfoKey, "Reloaded changes from disk"))
+}
+
+// reload re-reads the store into the model.
+func (m *model) reload() tea.Cmd {
+	root, err := m.store.Load()
+	if err != nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, "Reload failed: "+err.Error())
+	}
+	m.synced = toFolderDoc(root)
+	m.changePrompt = false
+	m.adopt(root)
+	return m.scheduleTimerTick()
+}
+
+// overwrite saves this session's tree over whatever is stored.
+func (m *model) overwrite() tea.Cmd {
+	// loading first takes on the stored revision, so the save isn't refused
+	if _, err := m.store.Load(); err != nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, "Save failed: "+err.Error())
+	}
+	if err := m.store.Save(m.rootFolder); err != nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, "Save failed: "+err.Error())
+	}
+	return m.saved("keep this session's tasks over the changes on disk")
+}
+
+// adopt shows root in place of the current tree, staying in the same folder
+// with the same item selected when they still exist.
+func (m *model) adopt(root *TaskFolder) {
+	selectedID := itemID(m.list.SelectedItem())
+	folder := root
+	for f := m.currentFolder; f != nil; f = f.Parent {
+		if found := findFolder(root, f.ID); found != nil {
+			folder = found
+			break
+		}
+	}
+	rollupStatus(root, m.settings)
+	m.rootFolder = root
+	m.deletionMode, m.itemsToDelete = false, nil
+	m.sortMode = false
+	if m.cutItem != nil {
+		cutID := itemID(m.cutItem)
+		m.cutItem = nil
+		if t := findTask(root, cutID); t != nil {
+			m.cutItem = t
+		} else if f := findFolder(root, cutID); f != nil {
+			m.cutItem = f
+		}
+	}
+	if m.trashMode {
+		m.currentFolder = folder
+		m.recreateTrashList(0)
+	} else if m.checklistMode {
+		m.currentFolder = folder
+		m.recreateChecklist(0)
+	} else if m.timeMode {
+		m.currentFolder = folder
+		m.recreateTimeList(0)
+	} else if m.reportMode {
+		m.currentFolder = folder
+		m.refreshReport()
+	} else {
+		m.recreateList(folder, 0)
+	}
+	for i, item := range m.list.Items() {
+		if itemID(item) == selectedID {
+			m.list.Select(i)
+			break
+		}
+	}
+}
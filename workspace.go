@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"go.dalton.dog/bubbleup"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// workspaceItem is a workspace in the picker.
+type workspaceItem struct {
+	Workspace
+	open bool
+}
+
+func (w *workspaceItem) FilterValue() string { return w.Name }
+func (w *workspaceItem) Title() string {
+	if w.open {
+		return "🗂 " + w.Name + " (open)"
+	}
+	return "🗂 " + w.Name
+}
+func (w *workspaceItem) Description() string { return w.Path }
+
+// workspaceState remembers which workspace was used last and the folder that
+// was open in each.
+type workspaceState struct {
+	Last    string            `json:"last"`
+	Folders map[string]string `json:"folders"`
+}
+
+// workspaceStatePath sits next to the settings file, e.g. settings.state.json.
+func workspaceStatePath() string {
+	return strings.TrimSuffix(settings_path, ".json") + ".state.json"
+}
+
+func loadWorkspaceState() workspaceState {
+	state := workspaceState{Folders: map[string]string{}}
+	data, err := os.ReadFile(workspaceStatePath())
+	if err != nil {
+		return state
+	}
+	// a broken state file only loses the remembered folders
+	json.Unmarshal(data, &state)
+	if state.Folders == nil {
+		state.Folders = map[string]string{}
+	}
+	return state
+}
+
+func (s workspaceState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(workspaceStatePath(), data, 0644)
+}
+
+// purgeExpired drops trash entries and logged changes older than the
+// retention settings.
+func purgeExpired(store Store, root *TaskFolder, settings Settings) error {
+	if expired := expiredTrash(root, settings.TrashRetentionDays, time.Now()); len(expired) > 0 {
+		if err := store.SaveChange(root, purgeTrash(root, expired)); err != nil {
+			return fmt.Errorf("error purging trash: %w", err)
+		}
+	}
+	if pruneEventLogs(root, settings, time.Now()) {
+		if err := store.Save(root); err != nil {
+			return fmt.Errorf("error pruning change logs: %w", err)
+		}
+	}
+	return nil
+}
+
+// attach puts root, loaded from store at config_path, on screen together
+// with the undo history, backups and watcher that belong to the file. For a
+// workspace the folder open when it was last left is opened again.
+func (m *model) attach(workspace string, store Store, root *TaskFolder) {
+	m.workspace = workspace
+	rollupStatus(root, m.settings)
+	m.store, m.rootFolder, m.synced = store, root, toFolderDoc(root)
+	m.vaults[config_path] = activeVault
+	m.backups = newBackups(config_path, m.settings)
+	m.history = newHistory(m.settings.HistorySize, "")
+	m.cutItem, m.dependent, m.itemsToDelete, m.dueSoonAlerted, m.lastDueCheck = nil, nil, nil, nil, time.Time{}
+	m.deletionMode, m.sortMode, m.trashMode, m.backupMode, m.workspaceMode, m.historyMode, m.eventMode, m.unblockedMode, m.checklistMode, m.tagMode, m.stateMode, m.timeMode, m.reportMode, m.checkInputActive, m.timeInputActive, m.changePrompt = false, false, false, false, false, false, false, false, false, false, false, false, false, false, false, false
+	folder := root
+	if f := findFolder(root, m.state.Folders[workspace]); workspace != "" && f != nil {
+		folder = f
+	}
+	m.recreateList(folder, 0)
+	m.statusString = "Press P to preview an Item!"
+	if workspace != "" {
+		m.statusString = "Workspace " + workspace + ", press P to preview an Item!"
+	}
+	var err error
+	if m.settings.PersistHistory {
+		if m.history, err = loadHistory(m.settings.HistorySize, config_path+".history"); err != nil {
+			m.statusString = err.Error()
+		}
+	}
+	if m.settings.Watch {
+		if m.watcher, err = newFileWatcher(config_path); err != nil {
+			m.statusString = err.Error()
+		}
+	}
+	m.git = nil
+	if m.settings.Git {
+		if _, ok := store.(*JSONStore); !ok {
+			m.statusString = "git mode is only supported by the json store"
+		} else if m.git, err = openGitRepo(config_path); err != nil {
+			m.statusString = err.Error()
+		} else if err := m.git.commit("record changes made outside ToDoIt"); err != nil {
+			m.statusString = err.Error()
+		}
+	}
+}
+
+// detach lets go of the open task file, remembering where we were in it.
+func (m *model) detach() error {
+	if m.watcher != nil {
+		m.watcher.Close()
+		m.watcher = nil
+	}
+	if m.git != nil {
+		m.git.wait()
+	}
+	if c, ok := m.store.(io.Closer); ok {
+		c.Close()
+	}
+	if m.workspace == "" {
+		return nil
+	}
+	m.state.Last = m.workspace
+	if m.currentFolder != nil {
+		m.state.Folders[m.workspace] = m.currentFolder.ID
+	}
+	return m.state.save()
+}
+
+// showWorkspaces opens the picker, with the open or else the last used
+// workspace selected.
+func (m *model) showWorkspaces() tea.Cmd {
+	if len(m.settings.Workspaces) == 0 {
+		return m.alert.NewAlertCmd(bubbleup.InfoKey, "No workspaces in "+settings_path)
+	}
+	selected := m.workspace
+	if selected == "" {
+		selected = m.state.Last
+	}
+	var items []list.Item
+	index := 0
+	for i, ws := range m.settings.Workspaces {
+		items = append(items, &workspaceItem{Workspace: ws, open: ws.Name == m.workspace && m.rootFolder != nil})
+		if ws.Name == selected {
+			index = i
+		}
+	}
+	m.workspaceMode = true
+	m.statusString = "Workspaces: enter opens the selected one, esc leaves"
+	m.list.SetItems(items)
+	m.list.Title = fmt.Sprintf("Workspaces \n %d in %s", len(items), settings_path)
+	m.list.Select(index)
+	return nil
+}
+
+// openWorkspace switches to ws, asking for its passphrase first when it is
+// encrypted and hasn't been unlocked yet.
+func (m *model) openWorkspace(ws Workspace) tea.Cmd {
+	if ws.Name == m.workspace && m.rootFolder != nil {
+		m.workspaceMode = false
+		m.recreateList(m.currentFolder, 0)
+		return nil
+	}
+	if data, err := os.ReadFile(ws.Path); err == nil && isSealed(data) && m.vaults[ws.Path] == nil {
+		input := textinput.New()
+		input.EchoMode = textinput.EchoPassword
+		input.EchoCharacter = '•'
+		input.Width = 40
+		input.Focus()
+		m.unlock = &passphraseModel{prompt: "Passphrase for workspace " + ws.Name, input: input}
+		m.unlocking = ws
+		return textinput.Blink
+	}
+	return m.switchWorkspace(ws)
+}
+
+// unlockWorkspace checks the passphrase typed for the workspace being
+// unlocked and opens it.
+func (m *model) unlockWorkspace() tea.Cmd {
+	data, err := os.ReadFile(m.unlocking.Path)
+	if err != nil {
+		m.unlock = nil
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, err.Error())
+	}
+	v, err := unlockVault(m.unlock.input.Value(), data)
+	if errors.Is(err, errWrongPassphrase) {
+		m.unlock.prompt = "Wrong passphrase, try again"
+		m.unlock.input.Reset()
+		return nil
+	}
+	m.unlock = nil
+	if err != nil {
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, err.Error())
+	}
+	m.vaults[m.unlocking.Path] = v
+	return m.switchWorkspace(m.unlocking)
+}
+
+func (m *model) switchWorkspace(ws Workspace) tea.Cmd {
+	previous := activeVault
+	activeVault = m.vaults[ws.Path]
+	store, err := openStore(ws.Path, ws.Store)
+	var root *TaskFolder
+	if err == nil {
+		if root, err = store.Load(); err == nil {
+			err = purgeExpired(store, root, m.settings)
+		}
+	}
+	if err != nil {
+		activeVault = previous
+		if c, ok := store.(io.Closer); ok {
+			c.Close()
+		}
+		var corrupt *CorruptError
+		if errors.As(err, &corrupt) {
+			err = fmt.Errorf("%w, start todoit -w %s to recover it", err, ws.Name)
+		}
+		return m.alert.NewAlertCmd(bubbleup.ErrorKey, "Can't open "+ws.Name+": "+err.Error())
+	}
+	var cmd tea.Cmd
+	if err := m.detach(); err != nil {
+		cmd = m.alert.NewAlertCmd(bubbleup.WarnKey, err.Error())
+	}
+	config_path = ws.Path
+	m.attach(ws.Name, store, root)
+	if m.watcher != nil {
+		cmd = tea.Batch(cmd, m.watcher.wait())
+	}
+	if due := m.checkDueDates(time.Now()); due != nil {
+		return tea.Batch(cmd, due)
+	}
+	return tea.Batch(cmd, m.alert.NewAlertCmd(bubbleup.InfoKey, "Switched to "+ws.Name))
+}